@@ -0,0 +1,151 @@
+package AI
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// guard applies the retry policy and circuit breaker of one provider.
+// Text and image calls to a provider share its guard, since both fail when
+// it is down.
+type guard struct {
+	retry   RetryPolicy
+	breaker *CircuitBreaker
+}
+
+func (g *guard) call(ctx context.Context, fn func() error) error {
+	trial, err := g.breaker.allow()
+	if err != nil {
+		return err
+	}
+	err = g.retry.do(ctx, g.breaker.Name, fn)
+	g.breaker.record(ctx, trial, err)
+	return err
+}
+
+type textLink struct {
+	provider TextGenerator
+	guard    *guard
+}
+
+type imageLink struct {
+	provider MealImageAnalyzer
+	guard    *guard
+}
+
+// TextChain asks its providers in order until one succeeds.
+type TextChain struct {
+	links []textLink
+}
+
+// Name lists the providers of the chain
+func (c *TextChain) Name() string {
+	names := make([]string, len(c.links))
+	for i, l := range c.links {
+		names[i] = l.provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// GenerateText returns the text of the first provider that succeeds, with
+// its name in the Provider field.
+func (c *TextChain) GenerateText(ctx context.Context, prompt string) (Generation, error) {
+	var errs []error
+	for _, l := range c.links {
+		var result Generation
+		err := l.guard.call(ctx, func() error {
+			var err error
+			result, err = l.provider.GenerateText(ctx, prompt)
+			return err
+		})
+		if err == nil {
+			return result, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", l.provider.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("↪️ %s failed to generate text, trying the next provider: %v", l.provider.Name(), err)
+	}
+	return Generation{}, fmt.Errorf("no AI provider could generate text: %w", errors.Join(errs...))
+}
+
+// errStreamInterrupted wraps the failure of a stream that already passed
+// text on. It hides the cause from retries and fallbacks, which would
+// repeat that text; the circuit breaker still counts it as a failure.
+type errStreamInterrupted struct {
+	err error
+}
+
+func (e errStreamInterrupted) Error() string { return "stream interrupted: " + e.err.Error() }
+
+// StreamText streams the text of the first provider that starts answering.
+// Providers are retried and skipped like GenerateText does only until the
+// first token; a failure after it ends the stream.
+func (c *TextChain) StreamText(ctx context.Context, prompt string, onToken func(string) error) (Generation, error) {
+	var errs []error
+	for _, l := range c.links {
+		var result Generation
+		started := false
+		err := l.guard.call(ctx, func() error {
+			var err error
+			result, err = l.provider.StreamText(ctx, prompt, func(token string) error {
+				started = true
+				return onToken(token)
+			})
+			if err != nil && started {
+				return errStreamInterrupted{err}
+			}
+			return err
+		})
+		if err == nil {
+			return result, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", l.provider.Name(), err))
+		if started || ctx.Err() != nil {
+			break
+		}
+		log.Printf("↪️ %s failed to stream text, trying the next provider: %v", l.provider.Name(), err)
+	}
+	return Generation{}, fmt.Errorf("no AI provider could stream text: %w", errors.Join(errs...))
+}
+
+// ImageChain asks its providers in order until one succeeds.
+type ImageChain struct {
+	links []imageLink
+}
+
+// Name lists the providers of the chain
+func (c *ImageChain) Name() string {
+	names := make([]string, len(c.links))
+	for i, l := range c.links {
+		names[i] = l.provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// AnalyzeMealImage returns the analysis of the first provider that
+// succeeds, with its name in the Provider field.
+func (c *ImageChain) AnalyzeMealImage(ctx context.Context, imgData []byte, imgType string) (*MealAnalysis, error) {
+	var errs []error
+	for _, l := range c.links {
+		var result *MealAnalysis
+		err := l.guard.call(ctx, func() error {
+			var err error
+			result, err = l.provider.AnalyzeMealImage(ctx, imgData, imgType)
+			return err
+		})
+		if err == nil {
+			return result, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", l.provider.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("↪️ %s failed to analyse the meal image, trying the next provider: %v", l.provider.Name(), err)
+	}
+	return nil, fmt.Errorf("no AI provider could analyse the meal image: %w", errors.Join(errs...))
+}
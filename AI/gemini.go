@@ -2,43 +2,51 @@ package AI
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-var client *genai.Client
+// GeminiProvider generates text and analyses meal photos with the Gemini API
+type GeminiProvider struct {
+	client      *genai.Client
+	TextModel   string
+	VisionModel string
+}
 
-// InitializeModel sets up the Gemini AI model client
-func InitializeModel(key string) {
-	ctx := context.Background()
-	var err error
-	client, err = genai.NewClient(ctx, option.WithAPIKey(key))
+// NewGeminiProvider sets up a Gemini client with the default models
+func NewGeminiProvider(ctx context.Context, key string) (*GeminiProvider, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(key))
 	if err != nil {
-		log.Fatalf("❌ Failed to initialize Gemini client: %v", err)
+		return nil, fmt.Errorf("failed to initialize Gemini client: %w", err)
 	}
 	log.Println("✅ Gemini AI client initialized successfully")
+	return &GeminiProvider{
+		client:      client,
+		TextModel:   "gemini-1.5-pro",
+		VisionModel: "gemini-1.5-pro",
+	}, nil
 }
 
 // ListModels prints the available models from the generative AI API
-func ListModels() error {
-	if client == nil {
-		return fmt.Errorf("AI client not initialized")
-	}
-
-	ctx := context.Background()
-	modelIterator := client.ListModels(ctx)
+func (p *GeminiProvider) ListModels(ctx context.Context) error {
+	modelIterator := p.client.ListModels(ctx)
 	log.Println("📋 Listing available models:")
 
 	for {
 		model, err := modelIterator.Next()
+		if err == iterator.Done {
+			break
+		}
 		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
 			log.Printf("❌ Error listing models: %v", err)
 			return err
 		}
@@ -47,109 +55,128 @@ func ListModels() error {
 	return nil
 }
 
-// GenImageAI takes image data and returns structured food calorie info
-func GenImageAI(imgData []byte, imgType string) (map[string]interface{}, error) {
-	if client == nil {
-		err := fmt.Errorf("AI client not initialized")
-		log.Println("❌", err)
-		return nil, err
+// Name identifies Gemini in logs and recorded results
+func (p *GeminiProvider) Name() string { return "gemini" }
+
+// GenerateText returns the completion of prompt
+func (p *GeminiProvider) GenerateText(ctx context.Context, prompt string) (Generation, error) {
+	resp, err := p.client.GenerativeModel(p.TextModel).GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		log.Printf("❌ Gemini GenerateContent error: %v", err)
+		return Generation{}, p.apiError(err)
 	}
 
-	vmodel := client.GenerativeModel("gemini-pro-vision")
-	ctx := context.Background()
-
-	prompt := `
-You are an expert in nutritionist where you need to see the food items from the image
-and calculate the total calories, also provide the details of every food items with calories intake
-is below JSON format. 
-NOTE: Don't include anything apart from below format, like number of food items or irrelevant text )
-NOTE: Don't use bold words
-NOTE: Don't include "'''JSON" in the output
-{
-	"Food Item 1": no of calories (integer)
-	"Food Item 2": no of calories (integer)
-	"Total calories": (integer)
-}
-`
-	resp, err := vmodel.GenerateContent(ctx, genai.Text(prompt), genai.ImageData(imgType, imgData))
+	text, err := responseText(resp)
 	if err != nil {
-		log.Printf("❌ GenImageAI GenerateContent error: %v", err)
-		return nil, err
+		log.Printf("❌ %v", err)
+		return Generation{}, err
 	}
+	log.Println("✅ Response generated successfully")
+	return Generation{Text: text, Provider: p.Name()}, nil
+}
 
-	log.Println("✅ Image content generated successfully")
+// StreamText streams the completion of prompt to onToken
+func (p *GeminiProvider) StreamText(ctx context.Context, prompt string, onToken func(string) error) (Generation, error) {
+	responses := p.client.GenerativeModel(p.TextModel).GenerateContentStream(ctx, genai.Text(prompt))
 
-	var jsonData []byte
-	if jsonData, err = json.Marshal(resp); err != nil {
-		log.Printf("❌ Failed to marshal AI response: %v", err)
-		return nil, err
-	}
+	var text strings.Builder
+	for {
+		resp, err := responses.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("❌ Gemini GenerateContentStream error: %v", err)
+			return Generation{}, p.apiError(err)
+		}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		log.Printf("❌ Failed to unmarshal AI response: %v", err)
-		return nil, err
+		token, err := responseText(resp)
+		if err != nil {
+			// Chunks may carry only metadata
+			continue
+		}
+		text.WriteString(token)
+		if err := onToken(token); err != nil {
+			return Generation{}, err
+		}
 	}
-
-	// Extract result string
-	value, ok := data["Candidates"].([]interface{})[0].(map[string]interface{})["Content"].(map[string]interface{})["Parts"].([]interface{})[0].(string)
-	if !ok {
-		log.Println("❌ Failed to extract result from AI response")
-		return nil, fmt.Errorf("invalid AI response format")
+	if text.Len() == 0 {
+		return Generation{}, fmt.Errorf("no response from Gemini API")
 	}
+	log.Println("✅ Response streamed successfully")
+	return Generation{Text: text.String(), Provider: p.Name()}, nil
+}
 
-	var meal map[string]interface{}
-	if err := json.Unmarshal([]byte(value), &meal); err != nil {
-		log.Printf("❌ Failed to parse meal data: %v", err)
+// AnalyzeMealImage takes image data and returns the foods in it with their
+// portion, calories and macro- and micronutrients
+func (p *GeminiProvider) AnalyzeMealImage(ctx context.Context, imgData []byte, imgType string) (*MealAnalysis, error) {
+	// This SDK has no JSON mode, so answers rely on the prompt and are
+	// cleaned up by ParseMealAnalysis
+	result, err := analyzeMeal(p.Name(), func(prompt string) (string, error) {
+		resp, err := p.client.GenerativeModel(p.VisionModel).GenerateContent(ctx, genai.Text(prompt), genai.ImageData(imgType, imgData))
+		if err != nil {
+			log.Printf("❌ Gemini GenerateContent error: %v", err)
+			return "", p.apiError(err)
+		}
+		return responseText(resp)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	log.Println("✅ Parsed meal data successfully")
-	return meal, nil
+	return result, nil
 }
 
-// GenAI takes user text data and returns a short diet suggestion
-func GenAI(userData string) (string, error) {
-	if client == nil {
-		err := fmt.Errorf("AI client not initialized")
-		log.Println("❌", err)
-		return "", err
+// apiError converts the gRPC status of a failed call to an APIError with
+// the matching HTTP status, so it is retried like a Groq error would be.
+func (p *GeminiProvider) apiError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
 	}
 
-	model := client.GenerativeModel("models/gemini-1.5-pro-001")
-	ctx := context.Background()
-
-	prompt := fmt.Sprintf(`
-You are an expert nutritionist, named "Blissful Bites", where you assess users data (along with the calories if they have been tracking) and suggest very very short diet plans (in a nutshell, in few lines~) accordingly.
-%s
-`, userData)
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		log.Printf("❌ GenAI GenerateContent error: %v", err)
-		return "", err
+	var code int
+	switch s.Code() {
+	case codes.ResourceExhausted:
+		code = http.StatusTooManyRequests
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	case codes.Internal, codes.Unknown:
+		code = http.StatusInternalServerError
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		code = http.StatusBadRequest
+	case codes.PermissionDenied, codes.Unauthenticated:
+		code = http.StatusForbidden
+	default:
+		return err
 	}
 
-	log.Println("✅ User content generated successfully")
-
-	var jsonData []byte
-	if jsonData, err = json.Marshal(resp); err != nil {
-		log.Printf("❌ Failed to marshal AI response: %v", err)
-		return "", err
+	apiErr := &APIError{Provider: p.Name(), StatusCode: code}
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			apiErr.RetryAfter = info.RetryDelay.AsDuration()
+		}
 	}
+	return fmt.Errorf("%w: %s", apiErr, s.Message())
+}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		log.Printf("❌ Failed to unmarshal AI response: %v", err)
-		return "", err
+// responseText joins the text parts of the first candidate of resp
+func responseText(resp *genai.GenerateContentResponse) (string, error) {
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return "", fmt.Errorf("no response from Gemini API")
 	}
 
-	value, ok := data["Candidates"].([]interface{})[0].(map[string]interface{})["Content"].(map[string]interface{})["Parts"].([]interface{})[0].(string)
-	if !ok {
-		log.Println("❌ Failed to extract suggestion text from AI response")
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if t, ok := part.(genai.Text); ok {
+			text.WriteString(string(t))
+		}
+	}
+	if text.Len() == 0 {
 		return "", fmt.Errorf("invalid AI response format")
 	}
-
-	log.Println("✅ Diet suggestion generated")
-	return value, nil
+	return text.String(), nil
 }
@@ -1,21 +1,38 @@
 package AI
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
-var groqApiKey string
+const groqURL = "https://api.groq.com/openai/v1/chat/completions"
 
-// InitializeGroqModel sets up the Groq API key
-func InitializeGroqModel(key string) {
-	groqApiKey = key
+// GroqProvider generates text and analyses meal photos with the Groq API
+type GroqProvider struct {
+	APIKey      string
+	TextModel   string
+	VisionModel string
+	HTTPClient  *http.Client
+}
+
+// NewGroqProvider sets up a Groq client with the default models
+func NewGroqProvider(key string) *GroqProvider {
 	log.Println("✅ Groq AI client initialized successfully")
+	return &GroqProvider{
+		APIKey:      key,
+		TextModel:   "llama-3.3-70b-versatile",
+		VisionModel: "meta-llama/llama-4-scout-17b-16e-instruct",
+		HTTPClient:  &http.Client{Timeout: 2 * time.Minute},
+	}
 }
 
 type Message struct {
@@ -36,8 +53,15 @@ type TextContent struct {
 }
 
 type GroqRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+}
+
+// ResponseFormat of type json_object makes the model answer with valid JSON
+type ResponseFormat struct {
+	Type string `json:"type"`
 }
 
 type GroqResponse struct {
@@ -48,47 +72,13 @@ type GroqResponse struct {
 	} `json:"choices"`
 }
 
-// GenGroqAI takes user text data and returns a short diet suggestion
-func GenGroqAI(userData string) (string, error) {
-	if groqApiKey == "" {
-		err := fmt.Errorf("groq AI client not initialized")
-		log.Println("❌", err)
-		return "", err
-	}
-
-	prompt := fmt.Sprintf(`You are Blissful Bites, a friendly Indian nutritionist who specializes in traditional Indian vegetarian diets. Write a personalized Indian diet plan in a warm, conversational tone. Consider:
-
-1. Current Stats:
-   - Weight, height, and BMI
-   - Activity level
-   - Any health conditions
-
-2. Goals:
-   - Weight goals (loss/gain/maintenance)
-   - Fitness objectives
-   - Following authentic Indian vegetarian cuisine
-
-For the diet plan:
-- Suggest authentic, home-cooked Indian vegetarian meals
-- Include regional dishes from across India (North, South, East, West)
-- Recommend common Indian ingredients and preparations
-- Balance traditional wisdom with modern nutritional science
-- Keep portions realistic for an Indian household
-- Include common Indian measurements (katori, chammach)
-
-IMPORTANT FORMATTING:
-- Write in complete sentences like you're speaking to a friend
-- DO NOT use asterisks, bullet points, or markdown formatting
-- Create clear meal sections with natural transitions
-- Mention specific dishes by name (various dals, sabzis, rotis, idli, dosa, etc.)
-- Include both everyday meals and some special dishes
-- Suggest freshly made items, not packaged foods
-
-User Data:
-%s`, userData)
+// Name identifies Groq in logs and recorded results
+func (p *GroqProvider) Name() string { return "groq" }
 
+// GenerateText returns the completion of prompt
+func (p *GroqProvider) GenerateText(ctx context.Context, prompt string) (Generation, error) {
 	request := GroqRequest{
-		Model: "llama-3.3-70b-versatile",
+		Model: p.TextModel,
 		Messages: []Message{
 			{
 				Role:    "user",
@@ -97,104 +87,117 @@ User Data:
 		},
 	}
 
-	return sendGroqRequest(request)
+	text, err := p.send(ctx, request)
+	if err != nil {
+		return Generation{}, err
+	}
+	return Generation{Text: text, Provider: p.Name()}, nil
+}
+
+// groqStreamChunk is one server-sent event of a streamed completion
+type groqStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
 }
 
-// AnalyzeImageWithGroq takes image data and returns structured food calorie info
-func AnalyzeImageWithGroq(imgData []byte, imgType string) (map[string]interface{}, error) {
-	if groqApiKey == "" {
-		err := fmt.Errorf("groq AI client not initialized")
-		log.Println("❌", err)
-		return nil, err
+// StreamText streams the completion of prompt to onToken
+func (p *GroqProvider) StreamText(ctx context.Context, prompt string, onToken func(string) error) (Generation, error) {
+	resp, err := p.post(ctx, GroqRequest{
+		Model: p.TextModel,
+		Messages: []Message{
+			{
+				Role:    "user",
+				Content: prompt,
+			},
+		},
+		Stream: true,
+	})
+	if err != nil {
+		return Generation{}, err
 	}
+	defer resp.Body.Close()
 
+	var text strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			log.Println("✅ Response streamed successfully")
+			return Generation{Text: text.String(), Provider: p.Name()}, nil
+		}
+
+		var chunk groqStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			log.Printf("❌ Failed to unmarshal stream chunk: %v", err)
+			return Generation{}, err
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		token := chunk.Choices[0].Delta.Content
+		text.WriteString(token)
+		if err := onToken(token); err != nil {
+			return Generation{}, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("❌ Failed to read stream: %v", err)
+		return Generation{}, err
+	}
+	return Generation{}, fmt.Errorf("groq stream ended without completing")
+}
+
+// AnalyzeMealImage takes image data and returns the foods in it with their
+// portion, calories and macro- and micronutrients
+func (p *GroqProvider) AnalyzeMealImage(ctx context.Context, imgData []byte, imgType string) (*MealAnalysis, error) {
 	// Convert image to base64
 	base64Img := base64.StdEncoding.EncodeToString(imgData)
 	dataURI := fmt.Sprintf("data:image/%s;base64,%s", imgType, base64Img)
 
-	prompt := `As a precision nutritionist, analyze this food image and provide detailed nutritional information. Focus on:
-
-1. Identify all visible food items
-2. Calculate accurate calorie content for each item
-3. Consider portion sizes and preparation methods
-4. Account for visible ingredients and likely preparation methods
-
-Provide the analysis in this exact JSON format:
-{
-    "Food Item 1": calories (integer),
-    "Food Item 2": calories (integer),
-    ...
-    "Total calories": sum_of_all_calories (integer)
-}
-
-Requirements:
-- Use precise calorie values
-- Include ALL visible food items
-- Consider serving sizes
-- Include ONLY the JSON output, no additional text
-- Ensure all calorie values are integers
-- Always include the "Total calories" field`
-
-	request := GroqRequest{
-		Model: "llama-3.3-70b-versatile",
-		Messages: []Message{
-			{
-				Role: "user",
-				Content: []any{
-					TextContent{
-						Type: "text",
-						Text: prompt,
-					},
-					ImageContent{
-						Type: "image",
-						ImageURL: struct {
-							URL string `json:"url"`
-						}{
-							URL: dataURI,
+	result, err := analyzeMeal(p.Name(), func(prompt string) (string, error) {
+		return p.send(ctx, GroqRequest{
+			Model: p.VisionModel,
+			Messages: []Message{
+				{
+					Role: "user",
+					Content: []any{
+						TextContent{
+							Type: "text",
+							Text: prompt,
+						},
+						ImageContent{
+							Type: "image_url",
+							ImageURL: struct {
+								URL string `json:"url"`
+							}{
+								URL: dataURI,
+							},
 						},
 					},
 				},
 			},
-		},
-	}
-
-	response, err := sendGroqRequest(request)
+			ResponseFormat: &ResponseFormat{Type: "json_object"},
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse the response as JSON
-	var result map[string]interface{}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		log.Printf("❌ Failed to parse meal data: %v", err)
-		return nil, err
-	}
-
 	log.Println("✅ Parsed meal data successfully")
 	return result, nil
 }
 
-// sendGroqRequest sends a request to the Groq API and returns the response content
-func sendGroqRequest(request GroqRequest) (string, error) {
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		log.Printf("❌ Failed to marshal request: %v", err)
-		return "", err
-	}
-
-	req, err := http.NewRequest("POST", "https://api.groq.com/openai/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("❌ Failed to create request: %v", err)
-		return "", err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+groqApiKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// send sends a request to the Groq API and returns the response content
+func (p *GroqProvider) send(ctx context.Context, request GroqRequest) (string, error) {
+	resp, err := p.post(ctx, request)
 	if err != nil {
-		log.Printf("❌ Failed to send request: %v", err)
 		return "", err
 	}
 	defer resp.Body.Close()
@@ -205,11 +208,6 @@ func sendGroqRequest(request GroqRequest) (string, error) {
 		return "", err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("❌ API request failed with status %d: %s", resp.StatusCode, string(body))
-		return "", fmt.Errorf("API request failed with status %d", resp.StatusCode)
-	}
-
 	var groqResp GroqResponse
 	if err := json.Unmarshal(body, &groqResp); err != nil {
 		log.Printf("❌ Failed to unmarshal response: %v", err)
@@ -224,3 +222,40 @@ func sendGroqRequest(request GroqRequest) (string, error) {
 	log.Println("✅ Response generated successfully")
 	return groqResp.Choices[0].Message.Content, nil
 }
+
+// post sends a request to the Groq API and returns the successful response
+// for the caller to read and close
+func (p *GroqProvider) post(ctx context.Context, request GroqRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		log.Printf("❌ Failed to marshal request: %v", err)
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", groqURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("❌ Failed to create request: %v", err)
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		log.Printf("❌ Failed to send request: %v", err)
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		log.Printf("❌ API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, &APIError{
+			Provider:   p.Name(),
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return resp, nil
+}
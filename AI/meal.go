@@ -0,0 +1,162 @@
+package AI
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// MealAnalysis is the nutritional breakdown of a meal photo.
+type MealAnalysis struct {
+	Items         []FoodItem `json:"items"`
+	TotalCalories float64    `json:"total_calories"`
+	// Provider is the AI provider that analysed the photo
+	Provider string `json:"-"`
+}
+
+// FoodItem is one food identified in a meal photo. Masses are in grams and
+// sodium in milligrams, for the estimated portion.
+type FoodItem struct {
+	Name         string  `json:"name"`
+	Portion      string  `json:"portion"`
+	PortionGrams float64 `json:"portion_grams"`
+	Calories     float64 `json:"calories"`
+	Protein      float64 `json:"protein_g"`
+	Carbs        float64 `json:"carbs_g"`
+	Fat          float64 `json:"fat_g"`
+	Fibre        float64 `json:"fibre_g"`
+	Sugar        float64 `json:"sugar_g"`
+	Sodium       float64 `json:"sodium_mg"`
+}
+
+// Upper bounds of a single portion; larger estimates are misreadings
+const (
+	maxPortionGrams = 3000
+	maxCalories     = 5000
+	maxSodiumMg     = 20000
+	// totalTolerance is how far total_calories may be off the sum of the
+	// items, as a fraction of the sum, allowing for rounding
+	totalTolerance = 0.05
+)
+
+// requiredItemFields must be present in every item, even when 0
+var requiredItemFields = []string{"name", "portion", "portion_grams", "calories", "protein_g", "carbs_g", "fat_g", "fibre_g", "sugar_g", "sodium_mg"}
+
+// mealAnalysisSchema is the output format requested from the model. It is
+// enforced by ParseMealAnalysis.
+const mealAnalysisSchema = `{
+    "items": [
+        {
+            "name": "food name (string)",
+            "portion": "portion in common Indian measures, e.g. 2 rotis, 1 katori (string)",
+            "portion_grams": estimated weight in grams (number),
+            "calories": kcal (number),
+            "protein_g": grams (number),
+            "carbs_g": grams (number),
+            "fat_g": grams (number),
+            "fibre_g": grams (number),
+            "sugar_g": grams (number),
+            "sodium_mg": milligrams (number)
+        }
+    ],
+    "total_calories": sum of the calories of all items (number)
+}`
+
+// ParseMealAnalysis decodes a model response into a MealAnalysis and
+// validates it. The JSON object is taken out of code fences and prose;
+// missing fields and fields outside the schema are rejected.
+func ParseMealAnalysis(data []byte) (*MealAnalysis, error) {
+	data = extractJSON(string(data))
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var analysis MealAnalysis
+	if err := decoder.Decode(&analysis); err != nil {
+		return nil, fmt.Errorf("invalid meal analysis: %w", err)
+	}
+
+	// Decoding leaves missing fields at 0, so look for them separately
+	var shape struct {
+		Items         []map[string]json.RawMessage `json:"items"`
+		TotalCalories json.RawMessage              `json:"total_calories"`
+	}
+	if err := json.Unmarshal(data, &shape); err != nil {
+		return nil, fmt.Errorf("invalid meal analysis: %w", err)
+	}
+	var errs []error
+	for i, item := range shape.Items {
+		for _, field := range requiredItemFields {
+			if _, ok := item[field]; !ok {
+				errs = append(errs, fmt.Errorf("item %d: %s is required", i, field))
+			}
+		}
+	}
+	if shape.TotalCalories == nil {
+		errs = append(errs, errors.New("total_calories is required"))
+	}
+
+	if err := analysis.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid meal analysis: %w", err)
+	}
+	return &analysis, nil
+}
+
+// Validate reports every problem of a.
+func (a *MealAnalysis) Validate() error {
+	if len(a.Items) == 0 {
+		return errors.New("at least one item is required")
+	}
+
+	var errs []error
+	for i, item := range a.Items {
+		if strings.TrimSpace(item.Name) == "" {
+			errs = append(errs, fmt.Errorf("item %d: name is required", i))
+		}
+		bounds := []struct {
+			field string
+			value float64
+			max   float64
+		}{
+			{"portion_grams", item.PortionGrams, maxPortionGrams},
+			{"calories", item.Calories, maxCalories},
+			{"protein_g", item.Protein, maxPortionGrams},
+			{"carbs_g", item.Carbs, maxPortionGrams},
+			{"fat_g", item.Fat, maxPortionGrams},
+			{"fibre_g", item.Fibre, maxPortionGrams},
+			{"sugar_g", item.Sugar, maxPortionGrams},
+			{"sodium_mg", item.Sodium, maxSodiumMg},
+		}
+		for _, b := range bounds {
+			if math.IsNaN(b.value) || b.value < 0 || b.value > b.max {
+				errs = append(errs, fmt.Errorf("item %d: %s must be between 0 and %g", i, b.field, b.max))
+			}
+		}
+		if item.Sugar > item.Carbs {
+			errs = append(errs, fmt.Errorf("item %d: sugar_g must not exceed carbs_g", i))
+		}
+		if item.PortionGrams > 0 && item.Protein+item.Carbs+item.Fat+item.Fibre > item.PortionGrams {
+			errs = append(errs, fmt.Errorf("item %d: nutrients must not weigh more than the portion", i))
+		}
+	}
+
+	sum := a.sumCalories()
+	if math.Abs(a.TotalCalories-sum) > math.Max(1, sum*totalTolerance) {
+		errs = append(errs, fmt.Errorf("total_calories %g is not the sum of the item calories %g", a.TotalCalories, sum))
+	}
+	return errors.Join(errs...)
+}
+
+// sumCalories sums the calories of every item.
+func (a *MealAnalysis) sumCalories() float64 {
+	total := 0.0
+	for _, item := range a.Items {
+		total += item.Calories
+	}
+	return total
+}
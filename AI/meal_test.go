@@ -0,0 +1,74 @@
+package AI
+
+import (
+	"strings"
+	"testing"
+)
+
+const validMeal = `{
+	"items": [
+		{"name": "Roti", "portion": "2 rotis", "portion_grams": 80, "calories": 240, "protein_g": 8, "carbs_g": 44, "fat_g": 4, "fibre_g": 6, "sugar_g": 1, "sodium_mg": 380},
+		{"name": "Dal", "portion": "1 katori", "portion_grams": 150, "calories": 180, "protein_g": 11, "carbs_g": 26, "fat_g": 4, "fibre_g": 7, "sugar_g": 2, "sodium_mg": 420}
+	],
+	"total_calories": 420
+}`
+
+// mealWith returns validMeal with old replaced by new.
+func mealWith(old string, new string) string {
+	return strings.Replace(validMeal, old, new, 1)
+}
+
+func TestParseMealAnalysis(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", validMeal, ""},
+		{"fenced", "```json\n" + validMeal + "\n```", ""},
+		{"total within rounding", mealWith(`"total_calories": 420`, `"total_calories": 430`), ""},
+		{"zero fibre", mealWith(`"fibre_g": 6`, `"fibre_g": 0`), ""},
+		{"not JSON", "I can't tell what this is.", "invalid meal analysis"},
+		{"unknown field", mealWith(`"sodium_mg": 380`, `"sodium_mg": 380, "vitamin_c_mg": 2`), `unknown field "vitamin_c_mg"`},
+		{"missing item field", mealWith(`"fibre_g": 6, `, ""), "item 0: fibre_g is required"},
+		{"missing total", mealWith(`,
+	"total_calories": 420`, ""), "total_calories is required"},
+		{"no items", `{"items": [], "total_calories": 0}`, "at least one item is required"},
+		{"blank name", mealWith(`"Roti"`, `" "`), "item 0: name is required"},
+		{"negative calories", mealWith(`"calories": 180`, `"calories": -180`), "item 1: calories must be between 0 and 5000"},
+		{"huge portion", mealWith(`"portion_grams": 150`, `"portion_grams": 4000`), "item 1: portion_grams must be between 0 and 3000"},
+		{"too much sodium", mealWith(`"sodium_mg": 420`, `"sodium_mg": 25000`), "item 1: sodium_mg must be between 0 and 20000"},
+		{"more sugar than carbs", mealWith(`"sugar_g": 2`, `"sugar_g": 30`), "item 1: sugar_g must not exceed carbs_g"},
+		{"nutrients outweigh the portion", mealWith(`"portion_grams": 80`, `"portion_grams": 40`), "item 0: nutrients must not weigh more than the portion"},
+		{"wrong total", mealWith(`"total_calories": 420`, `"total_calories": 600`), "total_calories 600 is not the sum of the item calories 420"},
+	}
+	for _, tt := range tests {
+		analysis, err := ParseMealAnalysis([]byte(tt.data))
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			} else if len(analysis.Items) != 2 || analysis.Items[0].Name != "Roti" {
+				t.Errorf("%s: got items %+v", tt.name, analysis.Items)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseMealAnalysisReportsEveryProblem(t *testing.T) {
+	data := mealWith(`"calories": 240, `, "")
+	data = strings.Replace(data, `"sugar_g": 2`, `"sugar_g": 30`, 1)
+
+	_, err := ParseMealAnalysis([]byte(data))
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, want := range []string{"item 0: calories is required", "item 1: sugar_g must not exceed carbs_g", "total_calories 420 is not the sum"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q is missing %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package AI
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MockProvider answers without calling any API, for development and
+// demos. The same input always gets the same answer.
+type MockProvider struct{}
+
+// mockFoods are the foods a mock meal analysis picks from
+var mockFoods = []FoodItem{
+	{Name: "Dal Tadka", Portion: "1 katori", PortionGrams: 150, Calories: 180, Protein: 9, Carbs: 24, Fat: 5, Fibre: 6, Sugar: 2, Sodium: 420},
+	{Name: "Jeera Rice", Portion: "1 cup", PortionGrams: 160, Calories: 230, Protein: 4, Carbs: 45, Fat: 4, Fibre: 1, Sugar: 0, Sodium: 280},
+	{Name: "Phulka Roti", Portion: "2 rotis", PortionGrams: 80, Calories: 200, Protein: 6, Carbs: 40, Fat: 2, Fibre: 5, Sugar: 1, Sodium: 240},
+	{Name: "Aloo Gobi", Portion: "1 katori", PortionGrams: 150, Calories: 160, Protein: 4, Carbs: 20, Fat: 8, Fibre: 5, Sugar: 4, Sodium: 390},
+	{Name: "Idli", Portion: "3 pieces", PortionGrams: 150, Calories: 175, Protein: 6, Carbs: 36, Fat: 1, Fibre: 2, Sugar: 1, Sodium: 360},
+	{Name: "Sambar", Portion: "1 katori", PortionGrams: 200, Calories: 140, Protein: 7, Carbs: 20, Fat: 4, Fibre: 6, Sugar: 5, Sodium: 520},
+	{Name: "Curd", Portion: "1 katori", PortionGrams: 100, Calories: 60, Protein: 3, Carbs: 5, Fat: 3, Fibre: 0, Sugar: 5, Sodium: 40},
+	{Name: "Cucumber Salad", Portion: "1 plate", PortionGrams: 100, Calories: 20, Protein: 1, Carbs: 4, Fat: 0, Fibre: 1, Sugar: 2, Sodium: 10},
+}
+
+var calorieTargetPattern = regexp.MustCompile(`Daily Calorie Target of (\d+) kcal`)
+
+// Name identifies the mock in logs and recorded results
+func (p *MockProvider) Name() string { return "mock" }
+
+// GenerateText returns a fixed diet plan that follows the calorie target
+// of the prompt, if any
+func (p *MockProvider) GenerateText(ctx context.Context, prompt string) (Generation, error) {
+	if err := ctx.Err(); err != nil {
+		return Generation{}, err
+	}
+
+	target := "1800"
+	if m := calorieTargetPattern.FindStringSubmatch(prompt); m != nil {
+		target = m[1]
+	}
+	log.Println("✅ Mock response generated")
+	text := fmt.Sprintf("Your Personalized Diet Plan\n"+
+		"Daily Calorie Target: %s kcal\n"+
+		"Breakfast (8 am): Start your day with two idlis, a katori of sambar and a glass of buttermilk.\n"+
+		"Lunch (1 pm): Have two phulkas with dal tadka, a katori of aloo gobi and some cucumber salad.\n"+
+		"Snack (5 pm): Enjoy a handful of roasted chana with a cup of green tea.\n"+
+		"Dinner (8 pm): Keep it light with vegetable khichdi and a katori of curd.", target)
+	return Generation{Text: text, Provider: p.Name()}, nil
+}
+
+// StreamText streams the GenerateText plan word by word, with a short pause
+// between words like a real model
+func (p *MockProvider) StreamText(ctx context.Context, prompt string, onToken func(string) error) (Generation, error) {
+	generation, err := p.GenerateText(ctx, prompt)
+	if err != nil {
+		return Generation{}, err
+	}
+
+	for _, word := range strings.SplitAfter(generation.Text, " ") {
+		select {
+		case <-ctx.Done():
+			return Generation{}, ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+		}
+		if err := onToken(word); err != nil {
+			return Generation{}, err
+		}
+	}
+	return generation, nil
+}
+
+// AnalyzeMealImage picks two to four foods from mockFoods based on a hash
+// of the image
+func (p *MockProvider) AnalyzeMealImage(ctx context.Context, imgData []byte, imgType string) (*MealAnalysis, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(imgData)
+	seed := binary.BigEndian.Uint64(sum[:8])
+	count := 2 + int(seed%3)
+	start := int((seed / 3) % uint64(len(mockFoods)))
+
+	analysis := &MealAnalysis{Provider: p.Name()}
+	for i := 0; i < count; i++ {
+		food := mockFoods[(start+i)%len(mockFoods)]
+		analysis.Items = append(analysis.Items, food)
+		analysis.TotalCalories += food.Calories
+	}
+	log.Println("✅ Mock meal analysis generated")
+	return analysis, nil
+}
@@ -0,0 +1,173 @@
+package AI
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TextGenerator writes text, such as diet plans, from a prompt
+type TextGenerator interface {
+	Name() string
+	GenerateText(ctx context.Context, prompt string) (Generation, error)
+	// StreamText passes the text to onToken piece by piece as the model
+	// writes it, and returns it whole at the end. An error from onToken
+	// stops the stream.
+	StreamText(ctx context.Context, prompt string, onToken func(string) error) (Generation, error)
+}
+
+// MealImageAnalyzer identifies the foods in a meal photo and estimates their
+// portion and nutrients
+type MealImageAnalyzer interface {
+	Name() string
+	AnalyzeMealImage(ctx context.Context, imgData []byte, imgType string) (*MealAnalysis, error)
+}
+
+// Generation is generated text with the provider that wrote it
+type Generation struct {
+	Text     string
+	Provider string
+}
+
+// NewProvidersFromEnv returns the text generator named by AI_PROVIDER and
+// the meal image analyzer named by AI_IMAGE_PROVIDER, which defaults to
+// AI_PROVIDER. Either may list several providers, e.g. "groq,gemini", to
+// fall back on the next when one fails. Providers are groq (the default),
+// gemini and mock.
+//
+// Every provider retries transient failures up to AI_RETRY_ATTEMPTS times
+// (3), backing off from AI_RETRY_BASE_DELAY (500ms) to AI_RETRY_MAX_DELAY
+// (8s), and is skipped for AI_BREAKER_COOLDOWN (30s) after
+// AI_BREAKER_THRESHOLD (5) consecutive failed calls.
+func NewProvidersFromEnv(ctx context.Context) (TextGenerator, MealImageAnalyzer, error) {
+	textNames := providerNames(os.Getenv("AI_PROVIDER"), []string{"groq"})
+	imageNames := providerNames(os.Getenv("AI_IMAGE_PROVIDER"), textNames)
+
+	retry := RetryPolicy{
+		Attempts:  envInt("AI_RETRY_ATTEMPTS", 3),
+		BaseDelay: envDuration("AI_RETRY_BASE_DELAY", 500*time.Millisecond),
+		MaxDelay:  envDuration("AI_RETRY_MAX_DELAY", 8*time.Second),
+	}
+	threshold := envInt("AI_BREAKER_THRESHOLD", 5)
+	cooldown := envDuration("AI_BREAKER_COOLDOWN", 30*time.Second)
+
+	// Both roles share the client and guard of a provider
+	providers := map[string]interface{}{}
+	guards := map[string]*guard{}
+	provider := func(name string) (interface{}, *guard, error) {
+		if p, ok := providers[name]; ok {
+			return p, guards[name], nil
+		}
+		p, err := newProvider(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		providers[name] = p
+		guards[name] = &guard{retry: retry, breaker: &CircuitBreaker{Name: name, Threshold: threshold, Cooldown: cooldown}}
+		return p, guards[name], nil
+	}
+
+	text := &TextChain{}
+	for _, name := range textNames {
+		p, g, err := provider(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		text.links = append(text.links, textLink{provider: p.(TextGenerator), guard: g})
+	}
+	images := &ImageChain{}
+	for _, name := range imageNames {
+		p, g, err := provider(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		images.links = append(images.links, imageLink{provider: p.(MealImageAnalyzer), guard: g})
+	}
+	return text, images, nil
+}
+
+// providerNames splits a comma separated provider list, dropping blanks
+// and repeats
+func providerNames(value string, fallback []string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return fallback
+	}
+	return names
+}
+
+func newProvider(ctx context.Context, name string) (interface{}, error) {
+	switch name {
+	case "groq":
+		key := os.Getenv("GROQ_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("GROQ_API_KEY is required for the groq AI provider")
+		}
+		p := NewGroqProvider(key)
+		if model := os.Getenv("GROQ_TEXT_MODEL"); model != "" {
+			p.TextModel = model
+		}
+		if model := os.Getenv("GROQ_VISION_MODEL"); model != "" {
+			p.VisionModel = model
+		}
+		return p, nil
+	case "gemini":
+		key := os.Getenv("GEMINI_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is required for the gemini AI provider")
+		}
+		p, err := NewGeminiProvider(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if model := os.Getenv("GEMINI_TEXT_MODEL"); model != "" {
+			p.TextModel = model
+		}
+		if model := os.Getenv("GEMINI_VISION_MODEL"); model != "" {
+			p.VisionModel = model
+		}
+		return p, nil
+	case "mock":
+		return &MockProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q (groq, gemini or mock)", name)
+	}
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		fmt.Printf("⚠️  Invalid %s %q, using %d\n", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		fmt.Printf("⚠️  Invalid %s %q, using %s\n", name, value, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,186 @@
+package AI
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling a provider whose circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("AI provider circuit open")
+
+// APIError is a failed response of an AI provider's API.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	// RetryAfter is how long the provider asked clients to wait, if it did
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API request failed with status %d", e.Provider, e.StatusCode)
+}
+
+// Temporary reports whether the request may succeed when retried: the
+// provider is rate limiting or failing, not rejecting the request.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout || e.StatusCode >= 500
+}
+
+// transient reports whether err is worth retrying, and how long the
+// provider asked to wait first.
+func transient(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary(), apiErr.RetryAfter
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return true, 0
+	}
+	return false, 0
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// RetryPolicy retries transient failures with jittered exponential backoff.
+type RetryPolicy struct {
+	// Attempts is the most calls made, including the first
+	Attempts int
+	// BaseDelay is the backoff cap of the first retry; it doubles every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff. A Retry-After longer than this gives up
+	// instead, so the next provider of a chain answers sooner.
+	MaxDelay time.Duration
+}
+
+// do calls fn until it succeeds, fails for good, or runs out of attempts.
+func (p RetryPolicy) do(ctx context.Context, name string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		retry, retryAfter := transient(err)
+		if !retry || attempt >= p.Attempts || ctx.Err() != nil {
+			return err
+		}
+		if retryAfter > p.MaxDelay {
+			log.Printf("⏳ %s asked to retry after %s, giving up", name, retryAfter)
+			return err
+		}
+
+		// Full jitter spreads out the retries of concurrent requests
+		backoff := p.BaseDelay << (attempt - 1)
+		if backoff <= 0 || backoff > p.MaxDelay {
+			backoff = p.MaxDelay
+		}
+		delay := time.Duration(rand.Int63n(int64(backoff) + 1))
+		if delay < retryAfter {
+			delay = retryAfter
+		}
+		log.Printf("🔁 %s failed (%v), retrying in %s", name, err, delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// CircuitBreaker stops calling a provider after Threshold consecutive
+// failures. After Cooldown one trial call is let through: success closes
+// the circuit, failure opens it for another Cooldown.
+type CircuitBreaker struct {
+	Name      string
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// allow returns ErrCircuitOpen unless a call may go ahead. trial is set
+// for the one call let through while the circuit is half-open.
+func (b *CircuitBreaker) allow() (trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.Threshold {
+		return false, nil
+	}
+	if b.trial || time.Since(b.openedAt) < b.Cooldown {
+		return false, fmt.Errorf("%w: %s", ErrCircuitOpen, b.Name)
+	}
+	b.trial = true
+	log.Printf("🟡 %s circuit half-open, trying a request", b.Name)
+	return true, nil
+}
+
+// record counts the outcome of a call let through by allow, passing on
+// the trial flag allow returned for it. Calls that started before the
+// circuit opened may finish during the trial; only the trial call itself
+// ends it.
+func (b *CircuitBreaker) record(ctx context.Context, trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial {
+		b.trial = false
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	// Only an unavailable provider counts as a failure; one that rejects a
+	// request or gives an invalid answer is up. A stream that broke off
+	// failed too, unless the caller went away.
+	failed, _ := transient(err)
+	var interrupted errStreamInterrupted
+	if errors.As(err, &interrupted) {
+		if ctx.Err() != nil {
+			return
+		}
+		failed = true
+	}
+	if !failed {
+		if b.failures >= b.Threshold {
+			log.Printf("🟢 %s circuit closed", b.Name)
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+		log.Printf("🔴 %s circuit open for %s", b.Name, b.Cooldown)
+	}
+}
@@ -0,0 +1,206 @@
+package AI
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var (
+	errUnavailable = &APIError{Provider: "test", StatusCode: http.StatusServiceUnavailable}
+	errRejected    = &APIError{Provider: "test", StatusCode: http.StatusBadRequest}
+)
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantRetry      bool
+		wantRetryAfter time.Duration
+	}{
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 3 * time.Second}, true, 3 * time.Second},
+		{"server error", errUnavailable, true, 0},
+		{"request timeout", &APIError{StatusCode: http.StatusRequestTimeout}, true, 0},
+		{"wrapped server error", fmt.Errorf("groq: %w", errUnavailable), true, 0},
+		{"bad request", errRejected, false, 0},
+		{"unauthorized", &APIError{StatusCode: http.StatusUnauthorized}, false, 0},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true, 0},
+		{"deadline exceeded", context.DeadlineExceeded, true, 0},
+		{"cancelled", context.Canceled, false, 0},
+		{"invalid answer", errors.New("invalid meal analysis"), false, 0},
+		{"interrupted stream", errStreamInterrupted{errUnavailable}, false, 0},
+	}
+	for _, tt := range tests {
+		retry, retryAfter := transient(tt.err)
+		if retry != tt.wantRetry || retryAfter != tt.wantRetryAfter {
+			t.Errorf("%s: got (%v, %s), want (%v, %s)", tt.name, retry, retryAfter, tt.wantRetry, tt.wantRetryAfter)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds at once", []error{nil}, 1, nil},
+		{"recovers", []error{errUnavailable, errUnavailable, nil}, 3, nil},
+		{"gives up after the last attempt", []error{errUnavailable, errUnavailable, errUnavailable, nil}, 3, errUnavailable},
+		{"doesn't retry a rejected request", []error{errRejected, nil}, 1, errRejected},
+		{"doesn't wait longer than MaxDelay", []error{&APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}, nil}, 1, nil},
+	}
+	for _, tt := range tests {
+		calls := 0
+		err := policy.do(context.Background(), "test", func() error {
+			err := tt.errs[calls]
+			calls++
+			return err
+		})
+		if calls != tt.wantCalls {
+			t.Errorf("%s: %d calls, want %d", tt.name, calls, tt.wantCalls)
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) || tt.wantErr == nil && calls == len(tt.errs) && err != nil {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRetryPolicyStopsWhenCancelled(t *testing.T) {
+	policy := RetryPolicy{Attempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- policy.do(ctx, "test", func() error {
+			calls++
+			return errUnavailable
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errUnavailable) || calls != 1 {
+			t.Errorf("got %v after %d calls, want the first failure", err, calls)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retry kept waiting after the context was cancelled")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	live := context.Background()
+
+	type call struct {
+		ctx context.Context
+		err error
+	}
+	tests := []struct {
+		name     string
+		calls    []call
+		wantOpen bool
+	}{
+		{"closed below the threshold", []call{{live, errUnavailable}}, false},
+		{"opens at the threshold", []call{{live, errUnavailable}, {live, errUnavailable}}, true},
+		{"success resets the count", []call{{live, errUnavailable}, {live, nil}, {live, errUnavailable}}, false},
+		{"a rejected request means the provider is up", []call{{live, errUnavailable}, {live, errRejected}, {live, errUnavailable}}, false},
+		{"cancelled calls don't count", []call{{live, errUnavailable}, {cancelled, context.Canceled}}, false},
+		{"interrupted streams count", []call{{live, errUnavailable}, {live, errStreamInterrupted{errors.New("EOF")}}}, true},
+		{"streams the caller left don't count", []call{{live, errUnavailable}, {cancelled, errStreamInterrupted{errors.New("EOF")}}}, false},
+	}
+	for _, tt := range tests {
+		b := &CircuitBreaker{Name: "test", Threshold: 2, Cooldown: time.Hour}
+		for _, c := range tt.calls {
+			trial, err := b.allow()
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			b.record(c.ctx, trial, c.err)
+		}
+		_, err := b.allow()
+		if open := errors.Is(err, ErrCircuitOpen); open != tt.wantOpen {
+			t.Errorf("%s: open %v, want %v", tt.name, open, tt.wantOpen)
+		}
+	}
+}
+
+func TestCircuitBreakerTrial(t *testing.T) {
+	ctx := context.Background()
+	open := func() *CircuitBreaker {
+		b := &CircuitBreaker{Name: "test", Threshold: 1, Cooldown: time.Minute}
+		b.record(ctx, false, errUnavailable)
+		return b
+	}
+
+	b := open()
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v during the cooldown, want ErrCircuitOpen", err)
+	}
+
+	// After the cooldown exactly one trial call goes through
+	b.openedAt = time.Now().Add(-time.Minute)
+	trial, err := b.allow()
+	if err != nil || !trial {
+		t.Fatalf("got (%v, %v) after the cooldown, want a trial", trial, err)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v during the trial, want ErrCircuitOpen", err)
+	}
+
+	// A call admitted before the circuit opened doesn't end the trial
+	b.record(ctx, false, errUnavailable)
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v after an earlier call finished, want the trial to continue", err)
+	}
+
+	// A failed trial opens the circuit for another cooldown
+	b.record(ctx, true, errUnavailable)
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v after a failed trial, want ErrCircuitOpen", err)
+	}
+
+	// A successful trial closes it
+	b = open()
+	b.openedAt = time.Now().Add(-time.Minute)
+	trial, _ = b.allow()
+	b.record(ctx, trial, nil)
+	for i := 0; i < 2; i++ {
+		if trial, err := b.allow(); err != nil || trial {
+			t.Errorf("got (%v, %v) after a successful trial, want a closed circuit", trial, err)
+		}
+	}
+}
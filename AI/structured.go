@@ -0,0 +1,90 @@
+package AI
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// AnalysisError is a meal analysis that failed validation, even after the
+// model was asked to correct it.
+type AnalysisError struct {
+	Provider string
+	Err      error
+	// Raw is the last answer of the model
+	Raw string
+}
+
+func (e *AnalysisError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *AnalysisError) Unwrap() error { return e.Err }
+
+// extractJSON returns the first JSON object in a model answer, dropping
+// markdown code fences and any prose around it. Answers without an object
+// are returned trimmed, for the decoder to report.
+func extractJSON(answer string) []byte {
+	text := strings.TrimSpace(answer)
+	if start := strings.Index(text, "```"); start >= 0 {
+		fenced := text[start+3:]
+		// Skip the language tag, e.g. ```json
+		if newline := strings.IndexByte(fenced, '\n'); newline >= 0 {
+			fenced = fenced[newline+1:]
+		}
+		if end := strings.Index(fenced, "```"); end >= 0 {
+			text = strings.TrimSpace(fenced[:end])
+		}
+	}
+
+	start := strings.IndexByte(text, '{')
+	if start < 0 {
+		return []byte(text)
+	}
+	var object json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(text[start:])).Decode(&object); err != nil {
+		return []byte(text[start:])
+	}
+	return object
+}
+
+// analyzeMeal asks a model for a meal analysis with ask, which sends a
+// prompt along with the photo. An invalid answer is sent back once with
+// its problems for the model to correct.
+func analyzeMeal(provider string, ask func(prompt string) (string, error)) (*MealAnalysis, error) {
+	answer, err := ask(mealAnalysisPrompt)
+	if err != nil {
+		return nil, err
+	}
+	analysis, err := ParseMealAnalysis([]byte(answer))
+	if err == nil {
+		analysis.Provider = provider
+		return analysis, nil
+	}
+
+	log.Printf("🔧 %s returned an invalid meal analysis, asking it to correct it: %v", provider, err)
+	answer, err = ask(repairPrompt(answer, err))
+	if err != nil {
+		return nil, err
+	}
+	analysis, err = ParseMealAnalysis([]byte(answer))
+	if err != nil {
+		log.Printf("❌ %s returned an invalid meal analysis again: %v", provider, err)
+		return nil, &AnalysisError{Provider: provider, Err: err, Raw: answer}
+	}
+	analysis.Provider = provider
+	return analysis, nil
+}
+
+func repairPrompt(answer string, problems error) string {
+	var b bytes.Buffer
+	b.WriteString(mealAnalysisPrompt)
+	b.WriteString("\n\nYour previous answer was:\n")
+	b.WriteString(answer)
+	b.WriteString("\n\nIt is invalid because:\n")
+	b.WriteString(problems.Error())
+	b.WriteString("\n\nReply with the corrected JSON only, in exactly the format above.")
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package AI
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		want   string
+	}{
+		{"plain object", `{"a": 1}`, `{"a": 1}`},
+		{"surrounding whitespace", "\n  {\"a\": 1}\n", `{"a": 1}`},
+		{"json fence", "```json\n{\"a\": 1}\n```", `{"a": 1}`},
+		{"bare fence", "```\n{\"a\": 1}\n```", `{"a": 1}`},
+		{"prose around a fence", "Here is the analysis:\n```json\n{\"a\": 1}\n```\nEnjoy your meal!", `{"a": 1}`},
+		{"prose around the object", `The meal contains {"a": {"b": [1, 2]}} in total.`, `{"a": {"b": [1, 2]}}`},
+		{"braces inside strings", `{"name": "dal } rice"} and more`, `{"name": "dal } rice"}`},
+		{"first of two objects", `{"a": 1} {"a": 2}`, `{"a": 1}`},
+		{"truncated object", `Sure: {"a": 1, "b":`, `{"a": 1, "b":`},
+		{"no object", "  I can't see any food in this photo.  ", "I can't see any food in this photo."},
+	}
+	for _, tt := range tests {
+		if got := string(extractJSON(tt.answer)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeMeal(t *testing.T) {
+	errUnreachable := errors.New("connection refused")
+
+	tests := []struct {
+		name        string
+		answers     []string
+		errs        []error
+		wantPrompts int
+		wantErr     bool
+		wantRaw     string
+	}{
+		{"valid at once", []string{validMeal}, nil, 1, false, ""},
+		{"corrected", []string{`{"items": []}`, validMeal}, nil, 2, false, ""},
+		{"invalid twice", []string{`{"items": []}`, "no idea"}, nil, 2, true, "no idea"},
+		{"provider fails", []string{""}, []error{errUnreachable}, 1, true, ""},
+		{"provider fails on the correction", []string{"no idea", ""}, []error{nil, errUnreachable}, 2, true, ""},
+	}
+	for _, tt := range tests {
+		var prompts []string
+		analysis, err := analyzeMeal("test", func(prompt string) (string, error) {
+			i := len(prompts)
+			prompts = append(prompts, prompt)
+			if i < len(tt.errs) && tt.errs[i] != nil {
+				return "", tt.errs[i]
+			}
+			return tt.answers[i], nil
+		})
+
+		if len(prompts) != tt.wantPrompts {
+			t.Errorf("%s: sent %d prompts, want %d", tt.name, len(prompts), tt.wantPrompts)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil {
+			if analysis.Provider != "test" {
+				t.Errorf("%s: provider %q, want %q", tt.name, analysis.Provider, "test")
+			}
+			continue
+		}
+
+		var analysisErr *AnalysisError
+		if isAnalysis := errors.As(err, &analysisErr); isAnalysis != (tt.wantRaw != "") {
+			t.Errorf("%s: got %v, want an AnalysisError %v", tt.name, err, tt.wantRaw != "")
+		} else if isAnalysis && analysisErr.Raw != tt.wantRaw {
+			t.Errorf("%s: raw answer %q, want %q", tt.name, analysisErr.Raw, tt.wantRaw)
+		}
+	}
+}
+
+func TestRepairPrompt(t *testing.T) {
+	prompt := repairPrompt(`{"items": []}`, errors.New("at least one item is required"))
+	for _, want := range []string{mealAnalysisPrompt, `{"items": []}`, "at least one item is required"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("repair prompt is missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package Auth
+
+import (
+	"blissfulbites/DB"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit records action on subject by the authenticated user of the request,
+// or by "anonymous" when there is none.
+func Audit(c *gin.Context, action string, subject string, metadata gin.H) {
+	actor := CurrentUser(c)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	AuditAs(c, actor, action, subject, metadata)
+}
+
+// AuditAs records action on subject by an explicit actor, for requests that
+// are not authenticated yet such as signup and signin.
+func AuditAs(c *gin.Context, actor string, action string, subject string, metadata gin.H) {
+	DB.RecordAudit(c.Request.Context(), actor, action, subject, c.ClientIP(), metadata)
+}
@@ -2,7 +2,9 @@ package Auth
 
 import (
 	"blissfulbites/DB"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -12,8 +14,8 @@ import (
 )
 
 type Auth interface {
-	Login(username, password string) bool
-	Signup(username, password string) bool
+	Login(ctx context.Context, username, password string) bool
+	Signup(ctx context.Context, username, password string) bool
 }
 
 type JSONAuth struct {
@@ -59,7 +61,7 @@ func (ja *JSONAuth) SaveUsers() error {
 	return nil
 }
 
-func (ja *JSONAuth) Login(username, password string) bool {
+func (ja *JSONAuth) Login(ctx context.Context, username, password string) bool {
 	ja.mu.Lock()
 	defer ja.mu.Unlock()
 	for _, user := range ja.users {
@@ -71,7 +73,7 @@ func (ja *JSONAuth) Login(username, password string) bool {
 	return false
 }
 
-func (ja *JSONAuth) Signup(username, password string) bool {
+func (ja *JSONAuth) Signup(ctx context.Context, username, password string) bool {
 	ja.mu.Lock()
 	defer ja.mu.Unlock()
 	for _, user := range ja.users {
@@ -92,26 +94,20 @@ func (ja *JSONAuth) Signup(username, password string) bool {
 	return true
 }
 
-// DBAuth implements Auth interface using PostgreSQL DB
+// DBAuth implements Auth interface on the credential repository. It holds
+// no lock: uniqueness is enforced by the repository and logins may run
+// bcrypt concurrently.
 type DBAuth struct {
-	mu sync.Mutex
+	Credentials DB.CredentialRepository
 }
 
-func NewDBAuth() *DBAuth {
-	return &DBAuth{}
+func NewDBAuth(credentials DB.CredentialRepository) *DBAuth {
+	return &DBAuth{Credentials: credentials}
 }
 
-func (dba *DBAuth) Signup(username, password string) bool {
-	dba.mu.Lock()
-	defer dba.mu.Unlock()
-
-	// Check if email already exists
-	exists, err := DB.CheckEmailExists(username)
-	if err != nil {
-		fmt.Println("Error checking email existence:", err)
-		return false
-	}
-	if exists {
+func (dba *DBAuth) Signup(ctx context.Context, username, password string) bool {
+	// Reject anything that isn't a plain email address or a strong enough password
+	if !ValidEmail(username) || CheckPassword(password) != nil {
 		return false
 	}
 
@@ -122,13 +118,13 @@ func (dba *DBAuth) Signup(username, password string) bool {
 		return false
 	}
 
-	// Insert user credentials into user_credentials table
-	query := `
-		INSERT INTO user_credentials (email, password)
-		VALUES ($1, $2)
-	`
-
-	_, err = DB.DB.Exec(query, username, string(hashedPassword))
+	// Insert user credentials. The insert itself is the uniqueness check:
+	// the account starts with onboarding incomplete until /form is saved.
+	err = dba.Credentials.CreateCredentials(ctx, username, string(hashedPassword))
+	if errors.Is(err, DB.ErrConflict) {
+		fmt.Println("Email already registered:", username)
+		return false
+	}
 	if err != nil {
 		fmt.Println("Error inserting user credentials:", err)
 		return false
@@ -137,14 +133,9 @@ func (dba *DBAuth) Signup(username, password string) bool {
 	return true
 }
 
-func (dba *DBAuth) Login(username, password string) bool {
-	dba.mu.Lock()
-	defer dba.mu.Unlock()
-
-	// Query password hash from user_credentials table
-	var hashedPassword string
-	query := "SELECT password FROM user_credentials WHERE email = $1"
-	err := DB.DB.QueryRow(query, username).Scan(&hashedPassword)
+func (dba *DBAuth) Login(ctx context.Context, username, password string) bool {
+	// Query password hash of the user
+	hashedPassword, err := dba.Credentials.GetPasswordHash(ctx, username)
 	if err != nil {
 		fmt.Println("Error querying user credentials:", err)
 		return false
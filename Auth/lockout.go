@@ -0,0 +1,146 @@
+package Auth
+
+import (
+	"blissfulbites/DB"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// LoginGuard throttles password logins per account and per client IP. An
+// attempt counts as a failure from the moment it starts until it passes.
+// The attempt reaching Threshold failures within Window, and each one after
+// it, locks the key for BaseLockout, doubling up to MaxLockout.
+type LoginGuard struct {
+	AccountThreshold int
+	IPThreshold      int
+	Window           time.Duration
+	BaseLockout      time.Duration
+	MaxLockout       time.Duration
+}
+
+func NewLoginGuard() *LoginGuard {
+	return &LoginGuard{
+		AccountThreshold: 5,
+		IPThreshold:      20,
+		Window:           time.Hour,
+		BaseLockout:      30 * time.Second,
+		MaxLockout:       time.Hour,
+	}
+}
+
+// LoginAttempt is a login attempt counted by LoginGuard.Begin. It counts as
+// a failure of the account and of the IP until Pass is called.
+type LoginAttempt struct {
+	// Wait is how long the caller must wait before trying again when the
+	// attempt was refused, zero when it may go ahead
+	Wait time.Duration
+
+	email   string
+	ip      string
+	account DB.LoginCount
+	client  DB.LoginCount
+}
+
+// Begin counts a login attempt for the account and the client IP before the
+// credentials are checked, so parallel guesses can't get past the threshold.
+// The attempt is refused, with a non-zero Wait, while either one is locked.
+func (lg *LoginGuard) Begin(ctx context.Context, email string, ip string) (*LoginAttempt, error) {
+	a := &LoginAttempt{email: email, ip: ip}
+
+	var err error
+	a.account, err = DB.Accounts.CountLoginAttempt(ctx, DB.LockoutScopeAccount, email, lg.Window, lg.lockout(lg.AccountThreshold))
+	if err != nil {
+		return nil, err
+	}
+	if a.account.Refused {
+		a.Wait = waitFor(a.account.LockedUntil)
+		return a, nil
+	}
+
+	a.client, err = DB.Accounts.CountLoginAttempt(ctx, DB.LockoutScopeIP, ip, lg.Window, lg.lockout(lg.IPThreshold))
+	if err != nil {
+		return nil, errors.Join(err, DB.Accounts.ReleaseLoginAttempt(ctx, DB.LockoutScopeAccount, email, a.account))
+	}
+	if a.client.Refused {
+		a.Wait = waitFor(a.client.LockedUntil)
+		// The account itself wasn't tried
+		return a, DB.Accounts.ReleaseLoginAttempt(ctx, DB.LockoutScopeAccount, email, a.account)
+	}
+	return a, nil
+}
+
+// Fail records the lockouts of the account and the IP that this failed
+// attempt reached the threshold of. The failure itself was already counted.
+func (a *LoginAttempt) Fail(ctx context.Context) error {
+	for _, k := range []struct {
+		scope, key string
+		count      DB.LoginCount
+	}{
+		{DB.LockoutScopeAccount, a.email, a.account},
+		{DB.LockoutScopeIP, a.ip, a.client},
+	} {
+		if k.count.LockedUntil.IsZero() {
+			continue
+		}
+		if err := DB.Accounts.RecordLockout(ctx, k.scope, a.email, a.ip, k.count.Failures, k.count.LockedUntil); err != nil {
+			return err
+		}
+		log.Printf("🔒 Locked %s %s until %s after %d failed logins", k.scope, k.key, k.count.LockedUntil.Format(time.RFC3339), k.count.Failures)
+	}
+	return nil
+}
+
+// Pass takes the attempt back from both counters because its credentials
+// were right. Passing one step of a two-step login doesn't finish it, so the
+// account counter is only reset by RecordSuccess.
+func (a *LoginAttempt) Pass(ctx context.Context) error {
+	return errors.Join(
+		DB.Accounts.ReleaseLoginAttempt(ctx, DB.LockoutScopeAccount, a.email, a.account),
+		DB.Accounts.ReleaseLoginAttempt(ctx, DB.LockoutScopeIP, a.ip, a.client),
+	)
+}
+
+// RecordSuccess resets the account counter after a successful login. The IP
+// counter is left to expire so one valid account can't mask guessing on others.
+func (lg *LoginGuard) RecordSuccess(ctx context.Context, email string) error {
+	return DB.Accounts.ClearLoginFailures(ctx, DB.LockoutScopeAccount, email)
+}
+
+// lockout returns how long a key with the given threshold is locked for at
+// each failure count: from the threshold on, each attempt locks it longer.
+func (lg *LoginGuard) lockout(threshold int) func(failures int) time.Duration {
+	return func(failures int) time.Duration {
+		if failures < threshold {
+			return 0
+		}
+		return lg.lockoutFor(failures - threshold)
+	}
+}
+
+// waitFor returns the time left until until, rounded up to a second so a
+// refused attempt never reports that it may go ahead.
+func waitFor(until time.Time) time.Duration {
+	if d := time.Until(until); d > time.Second {
+		return d
+	}
+	return time.Second
+}
+
+// lockoutFor returns BaseLockout doubled once per failure over the threshold,
+// capped at MaxLockout.
+func (lg *LoginGuard) lockoutFor(excess int) time.Duration {
+	d := float64(lg.BaseLockout) * math.Pow(2, float64(excess))
+	if d > float64(lg.MaxLockout) {
+		return lg.MaxLockout
+	}
+	return time.Duration(d)
+}
+
+// RetryAfterSeconds formats wait for a Retry-After header, rounding up.
+func RetryAfterSeconds(wait time.Duration) string {
+	return fmt.Sprint(int(math.Ceil(wait.Seconds())))
+}
@@ -0,0 +1,84 @@
+package Auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutFor(t *testing.T) {
+	lg := NewLoginGuard()
+
+	tests := []struct {
+		excess int
+		want   time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := lg.lockoutFor(tt.excess); got != tt.want {
+			t.Errorf("lockoutFor(%d) = %s, want %s", tt.excess, got, tt.want)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	lg := NewLoginGuard()
+
+	tests := []struct {
+		name      string
+		threshold int
+		failures  int
+		want      time.Duration
+	}{
+		{"first failure", lg.AccountThreshold, 1, 0},
+		{"below the account threshold", lg.AccountThreshold, lg.AccountThreshold - 1, 0},
+		{"reaching the account threshold", lg.AccountThreshold, lg.AccountThreshold, 30 * time.Second},
+		{"past the account threshold", lg.AccountThreshold, lg.AccountThreshold + 2, 2 * time.Minute},
+		{"below the IP threshold", lg.IPThreshold, lg.AccountThreshold, 0},
+		{"reaching the IP threshold", lg.IPThreshold, lg.IPThreshold, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := lg.lockout(tt.threshold)(tt.failures); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	tests := []struct {
+		name  string
+		until time.Time
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"ended", time.Now().Add(-time.Minute), time.Second, time.Second},
+		{"ending now", time.Now(), time.Second, time.Second},
+		{"locked", time.Now().Add(time.Minute), 59 * time.Second, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := waitFor(tt.until); got < tt.min || got > tt.max {
+			t.Errorf("%s: got %s, want between %s and %s", tt.name, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Minute, "60"},
+	}
+	for _, tt := range tests {
+		if got := RetryAfterSeconds(tt.wait); got != tt.want {
+			t.Errorf("RetryAfterSeconds(%s) = %q, want %q", tt.wait, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package Auth
+
+import (
+	"blissfulbites/DB"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MigrateOptions controls MigrateJSONUsers
+type MigrateOptions struct {
+	// VerifyHashes skips entries whose password is not a valid bcrypt hash
+	VerifyHashes bool
+	// DryRun reports what would happen without writing anything
+	DryRun bool
+}
+
+// MigrateReport summarises a users.json import
+type MigrateReport struct {
+	Imported  []string
+	Unchanged []string
+	Conflicts []string
+	Invalid   map[string]string
+}
+
+// MigrateJSONUsers copies the bcrypt hashes kept by JSONAuth in path into
+// user_credentials. Running it again is safe: users already imported with the
+// same hash are reported as unchanged, and users that exist with a different
+// password are reported as conflicts and left untouched.
+func MigrateJSONUsers(ctx context.Context, path string, opts MigrateOptions) (*MigrateReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	report := &MigrateReport{Invalid: map[string]string{}}
+	seen := map[string]bool{}
+	for _, u := range users {
+		if !ValidEmail(u.Username) {
+			report.Invalid[u.Username] = "not a valid email address"
+			continue
+		}
+		if seen[u.Username] {
+			report.Invalid[u.Username] = "duplicate entry in " + path
+			continue
+		}
+		seen[u.Username] = true
+
+		if opts.VerifyHashes {
+			if _, err := bcrypt.Cost([]byte(u.Password)); err != nil {
+				report.Invalid[u.Username] = "password is not a bcrypt hash: " + err.Error()
+				continue
+			}
+		}
+
+		var inserted bool
+		var existing string
+		if opts.DryRun {
+			existing, err = DB.Accounts.GetPasswordHash(ctx, u.Username)
+			if errors.Is(err, DB.ErrNotFound) {
+				inserted, err = true, nil
+			}
+		} else {
+			inserted, existing, err = DB.Accounts.ImportCredential(ctx, u.Username, u.Password)
+		}
+		if err != nil {
+			return report, err
+		}
+
+		switch {
+		case inserted:
+			report.Imported = append(report.Imported, u.Username)
+		case existing == u.Password:
+			report.Unchanged = append(report.Unchanged, u.Username)
+		default:
+			report.Conflicts = append(report.Conflicts, u.Username)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,349 @@
+package Auth
+
+import (
+	"blissfulbites/DB"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultGoogleIssuer = "https://accounts.google.com"
+	oidcStateCookieName = "bb_oidc"
+	oidcStateTTL        = 10 * time.Minute
+)
+
+// OIDCAuth implements an OpenID Connect authorization-code login with PKCE.
+// The issuer is discovered through /.well-known/openid-configuration, so the
+// same code works against Google and against a local stand-in provider.
+type OIDCAuth struct {
+	Provider     string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	mu     sync.Mutex
+	config *oauth2.Config
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+type oidcClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      json.RawMessage `json:"aud"`
+	Expiry        int64           `json:"exp"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified bool            `json:"email_verified"`
+}
+
+type oidcState struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// NewGoogleAuth builds an OIDCAuth from the GOOGLE_OAUTH_* environment. It
+// returns nil when no client ID is configured. GOOGLE_OIDC_ISSUER overrides
+// the issuer, e.g. to point at a local test provider.
+func NewGoogleAuth() *OIDCAuth {
+	clientID, clientSecret := GetGoogleOAuthCredentials()
+	if clientID == "" {
+		return nil
+	}
+
+	issuer := os.Getenv("GOOGLE_OIDC_ISSUER")
+	if issuer == "" {
+		issuer = defaultGoogleIssuer
+	}
+
+	return &OIDCAuth{
+		Provider:     "google",
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  os.Getenv("GOOGLE_OAUTH_REDIRECT_URL"),
+	}
+}
+
+// LoginHandler starts the authorization-code flow by redirecting the browser
+// to the provider with a fresh state, nonce and PKCE challenge.
+func (oa *OIDCAuth) LoginHandler(c *gin.Context) {
+	config, err := oa.oauthConfig(c.Request.Context())
+	if err != nil {
+		fmt.Println("[OIDC] Discovery failed:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Login provider unavailable"})
+		return
+	}
+
+	st := oidcState{
+		State:    randomString(),
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    randomString(),
+	}
+	if err := setStateCookie(c, st); err != nil {
+		fmt.Println("[OIDC] Failed to store state:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't start login"})
+		return
+	}
+
+	url := config.AuthCodeURL(st.State,
+		oauth2.S256ChallengeOption(st.Verifier),
+		oauth2.SetAuthURLParam("nonce", st.Nonce))
+	c.Redirect(http.StatusFound, url)
+}
+
+// CallbackHandler completes the flow: it checks state, exchanges the code
+// with the PKCE verifier, validates the ID token claims, links or creates the
+// user and issues a session. Users with 2FA get a second factor challenge
+// instead of the session.
+func (oa *OIDCAuth) CallbackHandler(c *gin.Context) {
+	st, ok := readStateCookie(c)
+	setCookie(c, oidcStateCookieName, "", -1)
+	if !ok || c.Query("state") == "" || !hmac.Equal([]byte(c.Query("state")), []byte(st.State)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state"})
+		return
+	}
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was not authorized: " + errParam})
+		return
+	}
+
+	ctx := c.Request.Context()
+	config, err := oa.oauthConfig(ctx)
+	if err != nil {
+		fmt.Println("[OIDC] Discovery failed:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Login provider unavailable"})
+		return
+	}
+
+	token, err := config.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(st.Verifier))
+	if err != nil {
+		fmt.Println("[OIDC] Code exchange failed:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Couldn't complete login"})
+		return
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	claims, err := oa.validateIDToken(rawIDToken, st.Nonce)
+	if err != nil {
+		fmt.Println("[OIDC] Invalid ID token:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Couldn't complete login"})
+		return
+	}
+
+	email, err := oa.resolveUser(c.Request.Context(), claims)
+	if err != nil {
+		fmt.Println("[OIDC] Failed to resolve user:", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Accounts with 2FA finish signing in at /signin/2fa, like password logins
+	mfa, err := DB.Accounts.IsTOTPEnabled(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[OIDC] Failed to read 2FA status:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't complete login"})
+		return
+	}
+	if mfa {
+		AuditAs(c, email, DB.AuditLoginSuccess, email, gin.H{"step": oa.Provider})
+		StartMFAChallenge(c, email)
+		c.Redirect(http.StatusFound, "/login#sso-2fa")
+		return
+	}
+
+	if err := IssueSession(c, email); err != nil {
+		fmt.Println("[OIDC] Failed to issue session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't create session"})
+		return
+	}
+	AuditAs(c, email, DB.AuditLoginSuccess, email, gin.H{"method": oa.Provider})
+	c.Redirect(http.StatusFound, "/login#sso")
+}
+
+// resolveUser returns the local email for the identity in claims, linking it
+// to an existing account with the same verified email or creating one. An
+// unverified password account with that email is reset first, so whoever
+// registered it without owning the email loses access.
+func (oa *OIDCAuth) resolveUser(ctx context.Context, claims *oidcClaims) (string, error) {
+	email, err := DB.Accounts.GetIdentityEmail(ctx, oa.Provider, claims.Subject)
+	if err == nil {
+		return email, nil
+	}
+	if !errors.Is(err, DB.ErrNotFound) {
+		return "", err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return "", fmt.Errorf("a verified email is required to sign in")
+	}
+	reclaimed, err := DB.Accounts.LinkIdentity(ctx, oa.Provider, claims.Subject, claims.Email)
+	if err != nil {
+		return "", err
+	}
+	if reclaimed {
+		log.Printf("🔒 Reset the unverified password account %s before linking it", claims.Email)
+	}
+	log.Printf("🔗 Linked %s identity to %s", oa.Provider, claims.Email)
+	return claims.Email, nil
+}
+
+// validateIDToken checks the claims of an ID token received directly from
+// the token endpoint. Per OpenID Connect Core 3.1.3.7 the TLS connection to
+// the token endpoint authenticates the issuer, so the signature is not
+// re-verified here.
+func (oa *OIDCAuth) validateIDToken(raw string, nonce string) (*oidcClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token payload: %w", err)
+	}
+
+	var claims oidcClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token claims: %w", err)
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != oa.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if !audienceContains(claims.Audience, oa.ClientID) {
+		return nil, fmt.Errorf("token not issued for this client")
+	}
+	if time.Now().Unix() >= claims.Expiry {
+		return nil, fmt.Errorf("token expired")
+	}
+	if !hmac.Equal([]byte(claims.Nonce), []byte(nonce)) {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("missing subject")
+	}
+	return &claims, nil
+}
+
+// oauthConfig lazily discovers the provider endpoints so a provider outage
+// at startup does not disable the login permanently.
+func (oa *OIDCAuth) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+
+	if oa.config != nil {
+		return oa.config, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", oa.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery failed with status %d", resp.StatusCode)
+	}
+
+	var doc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid discovery document: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != oa.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", doc.Issuer, oa.Issuer)
+	}
+
+	oa.config = &oauth2.Config{
+		ClientID:     oa.ClientID,
+		ClientSecret: oa.ClientSecret,
+		RedirectURL:  oa.RedirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  doc.AuthorizationEndpoint,
+			TokenURL: doc.TokenEndpoint,
+		},
+	}
+	return oa.config, nil
+}
+
+func audienceContains(raw json.RawMessage, clientID string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == clientID
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err == nil {
+		for _, aud := range many {
+			if aud == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setStateCookie stores the login state in a short-lived signed cookie.
+func setStateCookie(c *gin.Context, st oidcState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	value := base64.RawURLEncoding.EncodeToString(data)
+	setCookie(c, oidcStateCookieName, value+"."+signToken(value), int(oidcStateTTL.Seconds()))
+	return nil
+}
+
+func readStateCookie(c *gin.Context) (oidcState, bool) {
+	var st oidcState
+	cookie, err := c.Cookie(oidcStateCookieName)
+	if err != nil {
+		return st, false
+	}
+	value, sig, found := strings.Cut(cookie, ".")
+	if !found || !hmac.Equal([]byte(sig), []byte(signToken(value))) {
+		return st, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return st, false
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, false
+	}
+	return st, true
+}
+
+func randomString() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatalf("❌ Failed to read random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,138 @@
+package Auth
+
+import (
+	"blissfulbites/DB"
+	"blissfulbites/Mail"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordResetTTL  = time.Hour
+	emailVerifyTTL    = 48 * time.Hour
+	minPasswordLength = 8
+)
+
+// ErrInvalidToken is returned when a reset or verification token is unknown,
+// expired or already used
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ErrWeakPassword is returned when a new password is too short
+var ErrWeakPassword = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+
+// CheckPassword returns ErrWeakPassword when password is too short to be
+// set at signup or reset.
+func CheckPassword(password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// AccountRecovery issues and consumes the single-use tokens behind password
+// reset and email verification, and mails links containing them.
+type AccountRecovery struct {
+	Mailer  Mail.Sender
+	BaseURL string
+}
+
+func NewAccountRecovery(mailer Mail.Sender, baseURL string) *AccountRecovery {
+	return &AccountRecovery{Mailer: mailer, BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// ValidEmail reports whether s is a bare email address such as
+// "name@example.com".
+func ValidEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s && strings.Contains(s, "@")
+}
+
+// RequestPasswordReset mails a reset link to email in the background.
+// Unknown emails are ignored, and returning before the lookup and the SMTP
+// exchange keeps the response time from revealing which emails have
+// accounts.
+func (ar *AccountRecovery) RequestPasswordReset(email string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := ar.sendPasswordReset(ctx, email); err != nil {
+			fmt.Println("[RequestPasswordReset] Error sending reset link:", err)
+		}
+	}()
+}
+
+func (ar *AccountRecovery) sendPasswordReset(ctx context.Context, email string) error {
+	exists, err := DB.Accounts.CredentialsExist(ctx, email)
+	if err != nil || !exists {
+		return err
+	}
+
+	token, err := ar.issueToken(ctx, email, DB.TokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := ar.BaseURL + "/password/reset?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("We received a request to reset your Blissful Bites password.\n\n"+
+		"Open this link within %s to choose a new one:\n%s\n\n"+
+		"If you didn't ask for this, you can ignore this email.", passwordResetTTL, link)
+	return ar.Mailer.Send(email, "Reset your Blissful Bites password", body)
+}
+
+// ResetPassword sets a new password using a reset token, revokes all
+// sessions of the account and returns its email.
+func (ar *AccountRecovery) ResetPassword(ctx context.Context, token string, password string) (string, error) {
+	if err := CheckPassword(password); err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	email, err := DB.Accounts.ResetPassword(ctx, hashToken(token), string(hashedPassword))
+	if errors.Is(err, DB.ErrNotFound) {
+		return "", ErrInvalidToken
+	}
+	return email, err
+}
+
+// SendVerification mails an email verification link to email.
+func (ar *AccountRecovery) SendVerification(ctx context.Context, email string) error {
+	token, err := ar.issueToken(ctx, email, DB.TokenEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	link := ar.BaseURL + "/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Welcome to Blissful Bites!\n\nPlease confirm your email address by opening this link:\n%s", link)
+	return ar.Mailer.Send(email, "Confirm your Blissful Bites email", body)
+}
+
+// VerifyEmail consumes a verification token and marks the email verified.
+func (ar *AccountRecovery) VerifyEmail(ctx context.Context, token string) (string, error) {
+	email, err := DB.Accounts.ConsumeUserToken(ctx, hashToken(token), DB.TokenEmailVerify)
+	if errors.Is(err, DB.ErrNotFound) {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return email, DB.Accounts.SetEmailVerified(ctx, email)
+}
+
+func (ar *AccountRecovery) issueToken(ctx context.Context, email string, purpose string, ttl time.Duration) (string, error) {
+	token := randomString()
+	if err := DB.Accounts.CreateUserToken(ctx, hashToken(token), email, purpose, time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,111 @@
+package Auth
+
+import (
+	"blissfulbites/DB"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles stored in user_credentials.role
+const (
+	RoleUser         = "user"
+	RoleNutritionist = "nutritionist"
+	RoleAdmin        = "admin"
+)
+
+// Permission names checked by RequirePermission
+const (
+	PermViewAllUsers   = "users:read"
+	PermViewMessages   = "messages:read"
+	PermUpdateDiet     = "diet:write"
+	PermManageRoles    = "roles:write"
+	PermUnlockAccounts = "accounts:unlock"
+	PermResetTwoFactor = "2fa:reset"
+	PermViewAudit      = "audit:read"
+)
+
+// rolePermissions lists what every role is allowed to do. Regular users only
+// access their own data, which the session middleware already enforces.
+var rolePermissions = map[string][]string{
+	RoleUser:         {},
+	RoleNutritionist: {PermViewAllUsers, PermViewMessages, PermUpdateDiet},
+	RoleAdmin:        {PermViewAllUsers, PermViewMessages, PermUpdateDiet, PermManageRoles, PermUnlockAccounts, PermResetTwoFactor, PermViewAudit},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants perm.
+func HasPermission(role string, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission rejects requests whose authenticated user lacks perm.
+// It must run after RequireSession or RequireSessionPage.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := CurrentUser(c)
+		if email == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		role, err := DB.Accounts.GetUserRole(c.Request.Context(), email)
+		if err != nil {
+			if !errors.Is(err, DB.ErrNotFound) {
+				fmt.Println("[RequirePermission] Error reading role:", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Couldn't verify permissions"})
+				return
+			}
+			role = ""
+		}
+
+		if !HasPermission(role, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// BootstrapAdmin promotes BOOTSTRAP_ADMIN_EMAIL to admin at startup. When the
+// account does not exist yet it is created with BOOTSTRAP_ADMIN_PASSWORD.
+func BootstrapAdmin(ctx context.Context, auth Auth) error {
+	email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL")
+	if email == "" {
+		return nil
+	}
+
+	_, err := DB.Accounts.GetUserRole(ctx, email)
+	if errors.Is(err, DB.ErrNotFound) {
+		password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+		if password == "" {
+			return fmt.Errorf("admin %s does not exist and BOOTSTRAP_ADMIN_PASSWORD is not set", email)
+		}
+		if !auth.Signup(ctx, email, password) {
+			return fmt.Errorf("failed to create admin %s", email)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := DB.Accounts.SetUserRole(ctx, email, RoleAdmin); err != nil {
+		return err
+	}
+	log.Printf("✅ Bootstrap admin ready: %s", email)
+	return nil
+}
@@ -0,0 +1,204 @@
+package Auth
+
+import (
+	"blissfulbites/DB"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SessionCookieName is the cookie carrying the signed session token
+	SessionCookieName = "bb_session"
+	// ContextUserKey is the gin context key holding the authenticated email
+	ContextUserKey = "userEmail"
+
+	defaultSessionTTL = 24 * time.Hour
+)
+
+var sessionSecret []byte
+var sessionTTL = defaultSessionTTL
+var secureCookies bool
+
+// InitializeSessions loads the session signing secret, lifetime and cookie
+// flags from the environment. When SESSION_SECRET is unset a random secret is
+// generated, which invalidates all sessions on restart.
+func InitializeSessions() {
+	secret := os.Getenv("SESSION_SECRET")
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatalf("❌ Failed to generate session secret: %v", err)
+		}
+		sessionSecret = buf
+		log.Println("⚠️  SESSION_SECRET not set, using a random secret; sessions will not survive a restart")
+	} else {
+		sessionSecret = []byte(secret)
+	}
+
+	if ttl := os.Getenv("SESSION_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			log.Printf("⚠️  Invalid SESSION_TTL %q, using %s", ttl, defaultSessionTTL)
+		} else {
+			sessionTTL = d
+		}
+	}
+
+	secureCookies = os.Getenv("SESSION_COOKIE_SECURE") == "true"
+	log.Printf("✅ Sessions initialized (ttl %s)", sessionTTL)
+}
+
+// IssueSession creates a server-side session for email and sets the signed
+// session cookie on the response.
+func IssueSession(c *gin.Context, email string) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate session token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	expiresAt := time.Now().Add(sessionTTL)
+	if err := DB.Accounts.CreateSession(c.Request.Context(), hashToken(token), email, expiresAt); err != nil {
+		return err
+	}
+
+	setSessionCookie(c, token+"."+signToken(token), int(sessionTTL.Seconds()))
+	return nil
+}
+
+// Logout revokes the session attached to the request, if any, and clears the
+// session cookie.
+func Logout(c *gin.Context) error {
+	defer setSessionCookie(c, "", -1)
+
+	token, ok := sessionToken(c)
+	if !ok {
+		return nil
+	}
+	return DB.Accounts.RevokeSession(c.Request.Context(), hashToken(token))
+}
+
+// LogoutAll revokes every session of the authenticated user and clears the
+// session cookie.
+func LogoutAll(c *gin.Context) error {
+	defer setSessionCookie(c, "", -1)
+	return DB.Accounts.RevokeUserSessions(c.Request.Context(), CurrentUser(c))
+}
+
+// RequireSession rejects API requests without a valid session with 401 and
+// stores the authenticated email in the context otherwise.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !resolveSession(c) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSessionPage redirects page requests without a valid session to the
+// login page.
+func RequireSessionPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !resolveSession(c) {
+			c.Redirect(http.StatusFound, "/login")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser returns the email of the authenticated user, or an empty string
+// when the request went through no session middleware.
+func CurrentUser(c *gin.Context) string {
+	return c.GetString(ContextUserKey)
+}
+
+// StartSessionJanitor periodically purges expired and revoked sessions.
+func StartSessionJanitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := DB.Accounts.DeleteExpiredSessions(context.Background())
+			if err != nil {
+				log.Printf("❌ Session cleanup failed: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("🧹 Removed %d expired sessions", n)
+			}
+		}
+	}()
+}
+
+func resolveSession(c *gin.Context) bool {
+	token, ok := sessionToken(c)
+	if !ok {
+		return false
+	}
+
+	email, err := DB.Accounts.GetSessionEmail(c.Request.Context(), hashToken(token))
+	if err != nil {
+		if !errors.Is(err, DB.ErrNotFound) {
+			fmt.Println("[Session] Error resolving session:", err)
+		}
+		return false
+	}
+
+	c.Set(ContextUserKey, email)
+	return true
+}
+
+// sessionToken extracts the token from the session cookie after checking
+// its signature.
+func sessionToken(c *gin.Context) (string, bool) {
+	cookie, err := c.Cookie(SessionCookieName)
+	if err != nil || cookie == "" {
+		return "", false
+	}
+
+	token, sig, found := strings.Cut(cookie, ".")
+	if !found {
+		return "", false
+	}
+	if !hmac.Equal([]byte(sig), []byte(signToken(token))) {
+		return "", false
+	}
+	return token, true
+}
+
+func setSessionCookie(c *gin.Context, value string, maxAge int) {
+	setCookie(c, SessionCookieName, value, maxAge)
+}
+
+func setCookie(c *gin.Context, name string, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, "/", "", secureCookies, true)
+}
+
+func signToken(token string) string {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,227 @@
+package Auth
+
+import (
+	"blissfulbites/DB"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	totpIssuer        = "Blissful Bites"
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1
+	recoveryCodeCount = 10
+
+	mfaCookieName = "bb_mfa"
+	mfaTTL        = 5 * time.Minute
+)
+
+// ErrInvalidCode is returned when a TOTP or recovery code doesn't match
+var ErrInvalidCode = errors.New("invalid authentication code")
+
+// TOTPEnrollment is returned when a user starts two-factor enrollment
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// EnrollTOTP generates a new secret for email. The secret only becomes
+// active once ConfirmTOTP receives a valid code for it.
+func EnrollTOTP(ctx context.Context, email string) (*TOTPEnrollment, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+
+	if err := DB.Accounts.SaveTOTPSecret(ctx, email, secret); err != nil {
+		return nil, err
+	}
+
+	label := url.PathEscape(totpIssuer + ":" + email)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("period", strconv.Itoa(totpPeriod))
+	params.Set("digits", strconv.Itoa(totpDigits))
+
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: "otpauth://totp/" + label + "?" + params.Encode(),
+	}, nil
+}
+
+// ConfirmTOTP enables a pending enrollment after checking code and returns
+// freshly generated recovery codes. The codes are only stored hashed, so
+// this is the only time they can be shown. It returns DB.ErrNotFound when
+// no enrollment is pending.
+func ConfirmTOTP(ctx context.Context, email string, code string) ([]string, error) {
+	t, err := DB.Accounts.GetTOTPSecret(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled {
+		return nil, DB.ErrTwoFactorEnabled
+	}
+	if err := checkTOTP(ctx, email, t, code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		hashes[i] = hashToken(codes[i])
+	}
+
+	if err := DB.Accounts.EnableTOTP(ctx, email, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor accepts either a current TOTP code or an unused
+// recovery code for email.
+func VerifySecondFactor(ctx context.Context, email string, code string) error {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+
+	t, err := DB.Accounts.GetTOTPSecret(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if len(code) == totpDigits {
+		return checkTOTP(ctx, email, t, code)
+	}
+
+	ok, err := DB.Accounts.UseRecoveryCode(ctx, email, hashToken(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// DisableTOTP removes two-factor authentication from email after checking
+// a current code.
+func DisableTOTP(ctx context.Context, email string, code string) error {
+	if err := VerifySecondFactor(ctx, email, code); err != nil {
+		return err
+	}
+	return DB.Accounts.DeleteTOTP(ctx, email)
+}
+
+// StartMFAChallenge remembers that email passed the password step by setting
+// a short-lived signed cookie consumed by FinishMFAChallenge.
+func StartMFAChallenge(c *gin.Context, email string) {
+	value := email + "|" + strconv.FormatInt(time.Now().Add(mfaTTL).Unix(), 10)
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(value))
+	setCookie(c, mfaCookieName, encoded+"."+signToken(encoded), int(mfaTTL.Seconds()))
+}
+
+// PendingMFAUser returns the email whose password step is awaiting a second
+// factor, if the challenge cookie is valid and unexpired.
+func PendingMFAUser(c *gin.Context) (string, bool) {
+	cookie, err := c.Cookie(mfaCookieName)
+	if err != nil {
+		return "", false
+	}
+	encoded, sig, found := strings.Cut(cookie, ".")
+	if !found || !hmac.Equal([]byte(sig), []byte(signToken(encoded))) {
+		return "", false
+	}
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	email, expiry, found := strings.Cut(string(raw), "|")
+	if !found {
+		return "", false
+	}
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", false
+	}
+	return email, true
+}
+
+// FinishMFAChallenge clears the challenge cookie.
+func FinishMFAChallenge(c *gin.Context) {
+	setCookie(c, mfaCookieName, "", -1)
+}
+
+// checkTOTP validates code against the secret of t within totpSkew steps of
+// now and records the matching step so the same code can't be used twice.
+func checkTOTP(ctx context.Context, email string, t *DB.TOTPSecret, code string) error {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(t.Secret)
+	if err != nil {
+		return fmt.Errorf("invalid stored TOTP secret: %w", err)
+	}
+
+	step, found := matchTOTP(key, code, time.Now(), t.LastUsedStep)
+	if !found {
+		return ErrInvalidCode
+	}
+	// The update only succeeds for a step newer than the last one, so two
+	// requests racing with the same code can't both pass
+	ok, err := DB.Accounts.UseTOTPStep(ctx, email, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// matchTOTP returns the time step within totpSkew steps of now whose code
+// is code, skipping steps up to lastUsed, which were already used.
+func matchTOTP(key []byte, code string, now time.Time, lastUsed int64) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := current + offset
+		if step > lastUsed && hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the RFC 6238 code (HMAC-SHA1, dynamic truncation) for a
+// time step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
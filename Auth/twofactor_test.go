@@ -0,0 +1,99 @@
+package Auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rfc6238Key is the SHA-1 seed of the RFC 6238 test vectors
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated from 8 to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+	code := func(step int64) string { return totpCode(rfc6238Key, step) }
+
+	tests := []struct {
+		name      string
+		code      string
+		lastUsed  int64
+		wantStep  int64
+		wantFound bool
+	}{
+		{"current step", code(step), 0, step, true},
+		{"previous step", code(step - 1), 0, step - 1, true},
+		{"next step", code(step + 1), 0, step + 1, true},
+		{"outside the skew", code(step - 2), 0, 0, false},
+		{"wrong code", "000000", 0, 0, false},
+		{"replayed", code(step), step, 0, false},
+		{"older than the last used step", code(step - 1), step, 0, false},
+		{"newer than the last used step", code(step + 1), step, step + 1, true},
+	}
+	for _, tt := range tests {
+		gotStep, gotFound := matchTOTP(rfc6238Key, tt.code, now, tt.lastUsed)
+		if gotStep != tt.wantStep || gotFound != tt.wantFound {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", tt.name, gotStep, gotFound, tt.wantStep, tt.wantFound)
+		}
+	}
+}
+
+func TestMFAChallenge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/signin", nil)
+	StartMFAChallenge(c, "asha@example.com")
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != mfaCookieName {
+		t.Fatalf("got cookies %v, want the challenge cookie", cookies)
+	}
+	challenge := cookies[0].Value
+
+	tests := []struct {
+		name      string
+		cookie    string
+		wantEmail string
+		wantOK    bool
+	}{
+		{"valid", challenge, "asha@example.com", true},
+		{"tampered", "A" + challenge, "", false},
+		{"unsigned", challenge[:len(challenge)-2], "", false},
+		{"missing", "", "", false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/signin/2fa", nil)
+		if tt.cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: mfaCookieName, Value: tt.cookie})
+		}
+		email, ok := PendingMFAUser(c)
+		if email != tt.wantEmail || ok != tt.wantOK {
+			t.Errorf("%s: got (%q, %v), want (%q, %v)", tt.name, email, ok, tt.wantEmail, tt.wantOK)
+		}
+	}
+}
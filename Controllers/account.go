@@ -0,0 +1,230 @@
+package Controllers
+
+import (
+	"archive/zip"
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForgotPasswordHandler mails a password reset link. It always answers with
+// the same message so callers can't tell which emails have accounts.
+func ForgotPasswordHandler(c *gin.Context, recovery *Auth.AccountRecovery) {
+	var json struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	recovery.RequestPasswordReset(json.Email)
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+// ResetPasswordHandler sets a new password from a reset token
+func ResetPasswordHandler(c *gin.Context, recovery *Auth.AccountRecovery) {
+	var json struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	email, err := recovery.ResetPassword(c.Request.Context(), json.Token, json.Password)
+	if err == Auth.ErrInvalidToken || err == Auth.ErrWeakPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("[ResetPasswordHandler] Error resetting password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't reset password"})
+		return
+	}
+	Auth.AuditAs(c, email, DB.AuditPasswordReset, email, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated, please sign in again"})
+}
+
+// SendVerificationHandler mails a new verification link to the current user
+func SendVerificationHandler(c *gin.Context, recovery *Auth.AccountRecovery) {
+	if err := recovery.SendVerification(c.Request.Context(), Auth.CurrentUser(c)); err != nil {
+		fmt.Println("[SendVerificationHandler] Error sending verification:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't send verification email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// VerifyEmailHandler consumes the token from a verification link
+func VerifyEmailHandler(c *gin.Context, recovery *Auth.AccountRecovery) {
+	email, err := recovery.VerifyEmail(c.Request.Context(), c.Query("token"))
+	if err == Auth.ErrInvalidToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("[VerifyEmailHandler] Error verifying email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't verify email"})
+		return
+	}
+	fmt.Println("[VerifyEmailHandler] Verified email:", email)
+	c.Redirect(http.StatusFound, "/login#verified")
+}
+
+// ExportAccountHandler returns everything stored about the current user as a
+// ZIP of JSON files, or as a single JSON document with ?format=json
+func ExportAccountHandler(c *gin.Context, users DB.UserRepository, meals DB.MealRepository, weights DB.WeightRepository, scores DB.HealthScoreRepository) {
+	email := Auth.CurrentUser(c)
+
+	credentials, err := DB.Accounts.ReadCredentialsInfo(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[ExportAccountHandler] Error reading credentials:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Couldn't export account"})
+		return
+	}
+	profile, err := users.GetProfile(c.Request.Context(), email)
+	if err != nil && !errors.Is(err, DB.ErrNotFound) {
+		fmt.Println("[ExportAccountHandler] Error reading profile:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Couldn't export account"})
+		return
+	}
+	entries, err := meals.ListMealEntries(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[ExportAccountHandler] Error reading meals:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Couldn't export account"})
+		return
+	}
+	weightLog, err := weights.ListWeightEntries(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[ExportAccountHandler] Error reading weights:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Couldn't export account"})
+		return
+	}
+	scoreHistory, err := scores.ListHealthScores(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[ExportAccountHandler] Error reading health scores:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Couldn't export account"})
+		return
+	}
+
+	// Split the profile into the sections users expect to find
+	var profileSection interface{}
+	var dietPlan, messages *string
+	if profile != nil {
+		dietPlan, messages = profile.DietPlan, profile.DM
+		p := *profile
+		p.DietPlan, p.DM = nil, nil
+		profileSection = p
+	}
+
+	bundle := map[string]interface{}{
+		"account.json":       credentials,
+		"profile.json":       profileSection,
+		"meals.json":         DB.TrackRecords(entries),
+		"meal_entries.json":  entries,
+		"weights.json":       weightLog,
+		"health_scores.json": scoreHistory,
+		"diet_plan.json":     gin.H{"diet_plan": dietPlan},
+		"messages.json":      gin.H{"messages": messages},
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, bundle)
+		return
+	}
+
+	names := make([]string, 0, len(bundle))
+	for name := range bundle {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(bundle[name])
+		}
+		if err != nil {
+			fmt.Println("[ExportAccountHandler] Error writing archive:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't export account"})
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		fmt.Println("[ExportAccountHandler] Error closing archive:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't export account"})
+		return
+	}
+
+	filename := fmt.Sprintf("blissfulbites-export-%s.zip", time.Now().Format("2006-01-02"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// DeleteAccountHandler schedules the current user's account for deletion
+// after the grace period. Signing in during that time lets the user cancel.
+func DeleteAccountHandler(c *gin.Context, grace time.Duration) {
+	var json struct {
+		Confirm string `json:"confirm" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&json); err != nil || json.Confirm != "DELETE" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `Send {"confirm": "DELETE"} to delete your account`})
+		return
+	}
+
+	email := Auth.CurrentUser(c)
+	deletion, err := DB.Accounts.RequestAccountDeletion(c.Request.Context(), email, grace)
+	if err != nil {
+		fmt.Println("[DeleteAccountHandler] Error scheduling deletion:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Couldn't schedule deletion"})
+		return
+	}
+	Auth.Audit(c, DB.AuditDeletionRequested, email, gin.H{"scheduled_for": deletion.ScheduledFor})
+	c.JSON(http.StatusAccepted, gin.H{"status": "deletion scheduled", "deletion": deletion})
+}
+
+// DeletionStatusHandler reports the pending deletion of the current user
+func DeletionStatusHandler(c *gin.Context) {
+	deletion, err := DB.Accounts.GetAccountDeletion(c.Request.Context(), Auth.CurrentUser(c))
+	if errors.Is(err, DB.ErrNotFound) {
+		c.JSON(http.StatusOK, gin.H{"pending": false})
+		return
+	}
+	if err != nil {
+		fmt.Println("[DeletionStatusHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Couldn't read deletion status"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pending": true, "deletion": deletion})
+}
+
+// CancelDeletionHandler withdraws the current user's pending deletion
+func CancelDeletionHandler(c *gin.Context) {
+	email := Auth.CurrentUser(c)
+	err := DB.Accounts.CancelAccountDeletion(c.Request.Context(), email)
+	if errors.Is(err, DB.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No deletion pending"})
+		return
+	}
+	if err != nil {
+		fmt.Println("[CancelDeletionHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Couldn't cancel deletion"})
+		return
+	}
+	Auth.Audit(c, DB.AuditDeletionCancelled, email, nil)
+	c.JSON(http.StatusOK, gin.H{"status": "deletion cancelled"})
+}
@@ -0,0 +1,68 @@
+package Controllers
+
+import (
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAPITokensHandler lists the current user's API tokens without secrets
+func ListAPITokensHandler(c *gin.Context) {
+	tokens, err := DB.Accounts.ListAPITokens(c.Request.Context(), Auth.CurrentUser(c))
+	if err != nil {
+		fmt.Println("[ListAPITokensHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't list tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateAPITokenHandler issues a new token; the secret is only shown here
+func CreateAPITokenHandler(c *gin.Context) {
+	var json struct {
+		Name   string   `json:"name" binding:"required"`
+		Scopes []string `json:"scopes" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	token, id, err := Auth.CreateAPIToken(c.Request.Context(), Auth.CurrentUser(c), json.Name, json.Scopes)
+	if errors.Is(err, Auth.ErrInvalidScopes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("[CreateAPITokenHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't create token"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id, "name": json.Name, "scopes": json.Scopes, "token": token})
+}
+
+// RevokeAPITokenHandler revokes one of the current user's tokens
+func RevokeAPITokenHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token id"})
+		return
+	}
+
+	err = DB.Accounts.RevokeAPIToken(c.Request.Context(), Auth.CurrentUser(c), id)
+	if errors.Is(err, DB.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("[RevokeAPITokenHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't revoke token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "token revoked"})
+}
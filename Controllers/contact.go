@@ -1,6 +1,7 @@
 package Controllers
 
 import (
+	Auth "blissfulbites/Auth"
 	DB "blissfulbites/DB"
 	// "encoding/json"
 	"fmt"
@@ -8,27 +9,29 @@ import (
 	"net/http"
 )
 
-func ContactHandler(c *gin.Context) {
-	email := c.PostForm("email")
+func ContactHandler(c *gin.Context, messages DB.MessageRepository) {
+	email := Auth.CurrentUser(c)
 	message := c.PostForm("message")
 
-	err := DB.UpdateDM(email, message)
+	err := messages.SendMessage(c.Request.Context(), email, message)
 	if err != nil {
 		fmt.Println("[Contact handler]",err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status":"message couldn't be sent"})
+		c.JSON(dbStatus(err), gin.H{"status":"message couldn't be sent"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status":"message sent"})
 
 }
 
-func DmHandler(c *gin.Context){
-	allDms, err := DB.ReadAllUsers("SELECT name,email, dm FROM user_details")
+func DmHandler(c *gin.Context, messages DB.MessageRepository){
+	allDms, err := messages.ListMessages(c.Request.Context())
 	if err != nil {
 		fmt.Println("[All Dms handler]", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error":err.Error()})
+		c.JSON(dbStatus(err), gin.H{"error":err.Error()})
 		return
 	}
 	// fmt.Println(allDms)
+	Auth.Audit(c, DB.AuditAdminViewMessages, "*", gin.H{"count": len(allDms)})
 	c.HTML(http.StatusOK, "dm.html", allDms)
 }
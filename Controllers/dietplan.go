@@ -0,0 +1,67 @@
+package Controllers
+
+import (
+	AI "blissfulbites/AI"
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamDietPlanHandler generates a diet plan like GenDietPlan but relays it
+// to the browser as Server-Sent Events while the model writes it:
+//
+//   - token: {"text": "..."} for every piece of the plan
+//   - done: {"diet_plan": "...", "provider": "..."} once the plan is saved
+//   - error: {"error": "..."} if generating or saving the plan failed
+//
+// The plan is saved only when it is complete. Closing the connection cancels
+// the generation and nothing is saved.
+func StreamDietPlanHandler(c *gin.Context, users DB.UserRepository, text AI.TextGenerator) {
+	fmt.Println("[StreamDietPlanHandler] Starting diet plan stream...")
+
+	email := Auth.CurrentUser(c)
+	prompt, ok := dietPlanPrompt(c, users)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Keep proxies such as nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	generation, err := text.StreamText(ctx, AI.DietPlanPrompt(prompt), func(token string) error {
+		c.SSEvent("token", gin.H{"text": token})
+		c.Writer.Flush()
+		return ctx.Err()
+	})
+	if ctx.Err() != nil {
+		fmt.Println("[StreamDietPlanHandler] Client disconnected, diet plan discarded")
+		return
+	}
+	if err != nil {
+		fmt.Println("[StreamDietPlanHandler] Failed to generate diet plan:", err)
+		c.SSEvent("error", gin.H{"error": "couldn't generate diet plan, please try again later"})
+		c.Writer.Flush()
+		return
+	}
+	fmt.Println("[StreamDietPlanHandler] Diet plan streamed successfully by", generation.Provider)
+
+	if err := users.UpdateDiet(ctx, email, generation.Text); err != nil {
+		fmt.Println("[StreamDietPlanHandler] DB update error:", err)
+		c.SSEvent("error", gin.H{"error": "couldn't store diet plan in database"})
+		c.Writer.Flush()
+		return
+	}
+	Auth.Audit(c, DB.AuditDietGenerate, email, gin.H{"provider": generation.Provider, "streamed": true})
+
+	c.SSEvent("done", gin.H{"diet_plan": generation.Text, "provider": generation.Provider})
+	c.Writer.Flush()
+}
@@ -0,0 +1,23 @@
+package Controllers
+
+import (
+	DB "blissfulbites/DB"
+	"errors"
+	"net/http"
+)
+
+// dbStatus maps a repository error to the status of the response: 404 for a
+// missing record, 409 for a conflict, 503 when the database is unreachable
+// or timed out and 500 for anything else.
+func dbStatus(err error) int {
+	switch {
+	case errors.Is(err, DB.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, DB.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, DB.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -2,39 +2,27 @@ package Controllers
 
 import (
 	AI "blissfulbites/AI"
+	Auth "blissfulbites/Auth"
 	DB "blissfulbites/DB"
-	"database/sql"
+	Health "blissfulbites/Health"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// UserDetails struct for database operations
-type UserDetails struct {
-	Name          string
-	Gender        string
-	Age           int
-	ActivityLevel string
-	Goals         string
-	Height        float64
-	Weight        float64
-	TargetWeight  float64
-	Diseases      string
-	Email         string
-	DietPlan      sql.NullString
-	Healthscore   int
-	Track         []byte
-}
-
-func FormHandler(c *gin.Context) {
+func FormHandler(c *gin.Context, users DB.UserRepository, credentials DB.CredentialRepository, weights DB.WeightRepository, scores DB.HealthScoreRepository) {
 	fmt.Println("[FormHandler] Starting form submission process...")
 
 	// Parse form data
@@ -55,159 +43,176 @@ func FormHandler(c *gin.Context) {
 		}
 	}
 
-	// Get email from form data
-	email := c.PostForm("email")
-	if email == "" {
-		fmt.Println("[FormHandler] Error: No email provided in form data")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
-		return
-	}
+	// The profile always belongs to the authenticated user
+	email := Auth.CurrentUser(c)
 	formData["email"] = email
 
 	fmt.Printf("[FormHandler] Processing form data for email: %s\n", email)
 	fmt.Printf("[FormHandler] Form data: %+v\n", formData)
 
-	// Insert data into database
-	err = DB.InsertUserData(formData)
+	profile, err := DB.ProfileFromForm(formData)
+	if err != nil {
+		fmt.Printf("[FormHandler] Invalid form data: %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous, err := users.GetProfile(c.Request.Context(), email)
+	if err != nil && !errors.Is(err, DB.ErrNotFound) {
+		fmt.Printf("[FormHandler] Database query error: %v\n", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Failed to save user data"})
+		return
+	}
+
+	// Insert data into database, completing onboarding on the first save
+	err = DB.SaveOnboardingProfile(c.Request.Context(), users, credentials, profile)
 	if err != nil {
 		fmt.Printf("[FormHandler] Database insertion error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user data"})
+		c.JSON(dbStatus(err), gin.H{"error": "Failed to save user data"})
 		return
 	}
 
+	// The score entered in the form starts or continues the history
+	_, err = scores.RecordHealthScore(c.Request.Context(), email, DB.HealthScoreChange{
+		Score:  profile.Healthscore,
+		Source: DB.HealthScoreSelf,
+	})
+	if err != nil {
+		fmt.Printf("[FormHandler] Failed to record health score: %v\n", err)
+	}
+
+	// A changed weight is a new measurement for the weight log
+	if previous == nil || previous.Weight != profile.Weight {
+		_, err = weights.AddWeightEntry(c.Request.Context(), email, DB.WeightEntry{
+			Weight:     profile.Weight,
+			MeasuredAt: time.Now(),
+			Source:     DB.WeightSourceForm,
+		})
+		if err != nil {
+			fmt.Printf("[FormHandler] Failed to log weight: %v\n", err)
+		}
+	}
+	Auth.Audit(c, DB.AuditProfileUpsert, email, gin.H{"healthscore": profile.Healthscore})
+
 	fmt.Printf("[FormHandler] Form data successfully saved for user: %s\n", email)
 	c.Redirect(http.StatusFound, "/dashboard")
 }
 
-func FormUserDataHandler(c *gin.Context) {
+func FormUserDataHandler(c *gin.Context, users DB.UserRepository, meals DB.MealRepository, scores DB.HealthScoreRepository) {
 	fmt.Println("[FormUserDataHandler] Starting data retrieval process...")
 
+	writeUserDetails(c, Auth.CurrentUser(c), users, meals, scores)
+}
+
+// AdminUserDetailsHandler returns the details of the user given by the email
+// query parameter, for staff reviewing a user's profile
+func AdminUserDetailsHandler(c *gin.Context, users DB.UserRepository, meals DB.MealRepository, scores DB.HealthScoreRepository) {
 	email := c.Query("email")
 	if email == "" {
-		fmt.Println("[FormUserDataHandler] Error: No email provided in query")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
 		return
 	}
-	fmt.Printf("[FormUserDataHandler] Fetching data for email: %s\n", email)
-
-	// Query user details
-	var user UserDetails
-	query := `
-		SELECT name, gender, age, activity_level, goals, height, weight, 
-			   target_weight, diseases, email, diet_plan, healthscore, track 
-		FROM user_details WHERE email = $1`
+	Auth.Audit(c, DB.AuditAdminViewUser, email, nil)
+	writeUserDetails(c, email, users, meals, scores)
+}
 
-	err := DB.DB.QueryRow(query, email).Scan(
-		&user.Name, &user.Gender, &user.Age, &user.ActivityLevel,
-		&user.Goals, &user.Height, &user.Weight, &user.TargetWeight,
-		&user.Diseases, &user.Email, &user.DietPlan, &user.Healthscore, &user.Track)
+// writeUserDetails responds with the profile, BMI and health score of email
+// with the breakdown of the score
+func writeUserDetails(c *gin.Context, email string, users DB.UserRepository, meals DB.MealRepository, scores DB.HealthScoreRepository) {
+	fmt.Printf("[FormUserDataHandler] Fetching data for email: %s\n", email)
 
+	user, err := users.GetProfile(c.Request.Context(), email)
 	if err != nil {
 		fmt.Printf("[FormUserDataHandler] Database query error: %v\n", err)
-		if err == sql.ErrNoRows {
+		if errors.Is(err, DB.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.JSON(dbStatus(err), gin.H{"error": "Database error"})
 		}
 		return
 	}
 
 	fmt.Printf("[FormUserDataHandler] Raw user data from DB: %+v\n", user)
 
+	entries, err := meals.ListMealEntries(c.Request.Context(), email)
+	if err != nil {
+		fmt.Printf("[FormUserDataHandler] Meal history error: %v\n", err)
+		c.JSON(dbStatus(err), gin.H{"error": "Database error"})
+		return
+	}
+
 	// Calculate BMI
 	heightInMeters := user.Height / 100.0
 	bmi := user.Weight / (heightInMeters * heightInMeters)
 	bmi = math.Round(bmi*100) / 100 // Round to 2 decimal places
 
 	// Calculate Health Score based on various factors
-	healthScore := calculateHealthScore(user, bmi)
+	result := Health.Score(*user, bmi)
 
-	// Update health score in database if it has changed
-	if healthScore != user.Healthscore {
-		_, err = DB.DB.Exec("UPDATE user_details SET healthscore = $1 WHERE email = $2", healthScore, email)
+	// Reading the details only stores the computed score when the profile or
+	// the rules changed since it was last computed
+	history, err := scores.ListHealthScores(c.Request.Context(), email)
+	if err != nil {
+		fmt.Printf("[FormUserDataHandler] Failed to read health score history: %v\n", err)
+	} else if computedScoreChanged(history, result) {
+		_, err = scores.RecordHealthScore(c.Request.Context(), email, DB.HealthScoreChange{
+			Score:       result.Score,
+			Source:      DB.HealthScoreComputed,
+			Breakdown:   result.Factors,
+			RuleVersion: &result.RuleVersion,
+		})
 		if err != nil {
 			fmt.Printf("[FormUserDataHandler] Failed to update health score: %v\n", err)
+		} else {
+			user.Healthscore = result.Score
 		}
-		user.Healthscore = healthScore
+	}
+
+	dietPlan := ""
+	if user.DietPlan != nil {
+		dietPlan = *user.DietPlan
 	}
 
 	response := gin.H{
-		"name":           user.Name,
-		"gender":         user.Gender,
-		"age":            user.Age,
-		"activity_level": user.ActivityLevel,
-		"goals":          user.Goals,
-		"height":         user.Height,
-		"weight":         user.Weight,
-		"target_weight":  user.TargetWeight,
-		"diseases":       user.Diseases,
-		"email":          user.Email,
-		"diet_plan":      user.DietPlan.String,
-		"healthscore":    healthScore,
-		"track":          user.Track,
-		"bmi":            bmi,
+		"name":                  user.Name,
+		"gender":                user.Gender,
+		"age":                   user.Age,
+		"activity_level":        user.ActivityLevel,
+		"goals":                 user.Goals,
+		"height":                user.Height,
+		"weight":                user.Weight,
+		"target_weight":         user.TargetWeight,
+		"diseases":              user.Diseases,
+		"email":                 user.Email,
+		"diet_plan":             dietPlan,
+		"healthscore":           user.Healthscore,
+		"healthscore_breakdown": result,
+		"track":                 DB.TrackRecords(entries),
+		"bmi":                   bmi,
 	}
 
 	fmt.Printf("[FormUserDataHandler] Sending response: %+v\n", response)
 	c.JSON(http.StatusOK, response)
 }
 
-// calculateHealthScore calculates a health score based on various health factors
-func calculateHealthScore(user UserDetails, bmi float64) int {
-	score := 100 // Start with max score
-
-	// BMI factor (normal BMI range is 18.5-24.9)
-	if bmi < 18.5 {
-		score -= 10 // Underweight
-	} else if bmi >= 25 && bmi < 30 {
-		score -= 10 // Overweight
-	} else if bmi >= 30 {
-		score -= 20 // Obese
-	}
-
-	// Age factor
-	if user.Age > 60 {
-		score -= 10
-	} else if user.Age < 18 {
-		score -= 5
-	}
-
-	// Activity level factor
-	switch strings.ToLower(user.ActivityLevel) {
-	case "little":
-		score -= 15
-	case "moderate":
-		score -= 5
-	case "active":
-		// No deduction for active lifestyle
-	}
-
-	// Medical conditions factor
-	diseases := strings.Split(user.Diseases, ",")
-	score -= len(diseases) * 5 // Deduct 5 points for each medical condition
-
-	// Weight vs Target weight factor
-	weightDiff := math.Abs(user.Weight - user.TargetWeight)
-	if weightDiff > 20 {
-		score -= 15
-	} else if weightDiff > 10 {
-		score -= 10
-	} else if weightDiff > 5 {
-		score -= 5
-	}
-
-	// Ensure score stays within 0-100 range
-	if score < 0 {
-		score = 0
-	} else if score > 100 {
-		score = 100
+// computedScoreChanged reports whether result should be stored as the new
+// health score of a profile with history. A score set by a nutritionist is
+// kept until the profile is saved again; otherwise result is only stored
+// when its factors or rule version differ from the last computed score.
+func computedScoreChanged(history []DB.HealthScoreChange, result Health.Result) bool {
+	if len(history) > 0 && history[len(history)-1].Source == DB.HealthScoreNutritionist {
+		return false
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if change := history[i]; change.Source == DB.HealthScoreComputed {
+			return change.RuleVersion == nil || *change.RuleVersion != result.RuleVersion ||
+				!slices.Equal(change.Breakdown, result.Factors)
+		}
 	}
-
-	// Convert to 0-10 scale
-	return score / 10
+	return true
 }
 
-func AppendMealsHandler(c *gin.Context) {
+func AppendMealsHandler(c *gin.Context, meals DB.MealRepository, weights DB.WeightRepository, images AI.MealImageAnalyzer) {
 	fmt.Println("[AppendMealsHandler] Parsing multipart form")
 	form, err := c.MultipartForm()
 	if err != nil {
@@ -217,15 +222,41 @@ func AppendMealsHandler(c *gin.Context) {
 	}
 	fmt.Println("[AppendMealsHandler] Received files:", form.File)
 
+	// Check the date and weight before paying for any photo analysis. The
+	// weight is also logged as a weight entry on that date, so it gets the
+	// same bounds as LogWeightHandler.
+	var entry DB.MealEntry
+	if date := c.PostForm("date"); date != "" {
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil || d.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date."})
+			return
+		}
+		entry.Date = &d
+	}
+	if weight := c.PostForm("weight"); weight != "" {
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w <= 0 || w > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid weight."})
+			return
+		}
+		entry.Weight = &w
+	}
+
+	count := 0
+	for _, files := range form.File {
+		count += len(files)
+	}
+
 	var wg sync.WaitGroup
-	wg.Add(len(form.File))
-	processedImages := make(chan map[string]interface{}, len(form.File))
+	wg.Add(count)
+	processedImages := make(chan map[string]interface{}, count)
 
 	for fieldName, files := range form.File {
 		for _, file := range files {
 			go func(fieldName string, file *multipart.FileHeader) {
 				defer wg.Done()
-				ImageProcess(c, fieldName, file, processedImages)
+				ImageProcess(c, fieldName, file, processedImages, images)
 			}(fieldName, file)
 		}
 	}
@@ -233,37 +264,52 @@ func AppendMealsHandler(c *gin.Context) {
 	wg.Wait()
 	close(processedImages)
 
-	var breakfastResult map[string]interface{}
-	var lunchResult map[string]interface{}
-	var dinnerResult map[string]interface{}
+	var breakfastResult *AI.MealAnalysis
+	var lunchResult *AI.MealAnalysis
+	var dinnerResult *AI.MealAnalysis
 
+	var analysisErr error
+	var failedMeal string
 	for processedImage := range processedImages {
 		fieldName := processedImage["fieldName"].(string)
 		fmt.Println("[AppendMealsHandler] Processed image for:", fieldName)
+		if err, _ := processedImage["error"].(error); err != nil {
+			analysisErr, failedMeal = err, strings.TrimSuffix(fieldName, "_img")
+			continue
+		}
 		if fieldName == "breakfast_img" {
-			breakfastResult = processedImage["data"].(map[string]interface{})
+			breakfastResult = processedImage["data"].(*AI.MealAnalysis)
 		} else if fieldName == "lunch_img" {
-			lunchResult = processedImage["data"].(map[string]interface{})
+			lunchResult = processedImage["data"].(*AI.MealAnalysis)
 		} else if fieldName == "dinner_img" {
-			dinnerResult = processedImage["data"].(map[string]interface{})
+			dinnerResult = processedImage["data"].(*AI.MealAnalysis)
 		}
 	}
 
-	email := c.PostForm("email")
-	date := c.PostForm("date")
+	// A photo that couldn't be analysed fails the whole entry, rather than
+	// tracking the meal as missing
+	var invalid *AI.AnalysisError
+	switch {
+	case errors.As(analysisErr, &invalid):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("We couldn't read the %s photo. Please retake it or type the meal instead.", failedMeal)})
+		return
+	case errors.Is(analysisErr, errUnreadableImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The %s photo couldn't be read.", failedMeal)})
+		return
+	case analysisErr != nil:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Meal photo analysis is unavailable right now. Please try again later or type the meal instead."})
+		return
+	}
+
+	email := Auth.CurrentUser(c)
 	breakfast := c.PostForm("breakfast")
 	lunch := c.PostForm("lunch")
 	dinner := c.PostForm("dinner")
-	weight := c.PostForm("weight")
-
-	formData := make(map[string]interface{})
-	formData["email"] = email
-	formData["date"] = date
 
 	if breakfast == "" && breakfastResult != nil {
-		formData["breakfast"] = breakfastResult
+		entry.Items = append(entry.Items, imageMealItems(DB.MealBreakfast, breakfastResult)...)
 	} else if breakfast != "" && breakfastResult == nil {
-		formData["breakfast"] = breakfast
+		entry.Items = append(entry.Items, textMealItem(DB.MealBreakfast, breakfast))
 	} else {
 		fmt.Println("[AppendMealsHandler] Breakfast error")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Breakfast value empty."})
@@ -271,43 +317,112 @@ func AppendMealsHandler(c *gin.Context) {
 	}
 
 	if lunchResult != nil {
-		formData["lunch"] = lunchResult
+		entry.Items = append(entry.Items, imageMealItems(DB.MealLunch, lunchResult)...)
 	} else if lunch != "" {
-		formData["lunch"] = lunch
+		entry.Items = append(entry.Items, textMealItem(DB.MealLunch, lunch))
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Lunch missing"})
 		return
 	}
 
 	if dinner == "" && dinnerResult != nil {
-		formData["dinner"] = dinnerResult
-	} else if lunch != "" && dinnerResult == nil {
-		formData["dinner"] = dinner
+		entry.Items = append(entry.Items, imageMealItems(DB.MealDinner, dinnerResult)...)
+	} else if dinner != "" && dinnerResult == nil {
+		entry.Items = append(entry.Items, textMealItem(DB.MealDinner, dinner))
 	} else {
 		fmt.Println("[AppendMealsHandler] Dinner error")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Dinner value empty."})
 		return
 	}
 
-	formData["weight"] = weight
-	fmt.Println("[AppendMealsHandler] Final form data to save:", formData)
+	fmt.Printf("[AppendMealsHandler] Final meal entry to save: %+v\n", entry)
 
-	err = DB.AppendMeals(formData)
+	_, err = meals.AddMealEntry(c.Request.Context(), email, entry)
 	if err != nil {
 		fmt.Println("[AppendMealsHandler] Couldn't track calories:", err)
-		c.HTML(http.StatusNotFound, "error.html", gin.H{"error": err})
+		c.HTML(dbStatus(err), "error.html", gin.H{"error": err})
 		return
 	}
+
+	// The weight is measured on the tracked day, or now when that is today
+	if entry.Weight != nil {
+		measuredAt := time.Now()
+		if entry.Date != nil && entry.Date.Format("2006-01-02") != measuredAt.Format("2006-01-02") {
+			measuredAt = *entry.Date
+		}
+		_, err = weights.AddWeightEntry(c.Request.Context(), email, DB.WeightEntry{
+			Weight:     *entry.Weight,
+			MeasuredAt: measuredAt,
+			Source:     DB.WeightSourceMeal,
+		})
+		if err != nil {
+			fmt.Println("[AppendMealsHandler] Couldn't log weight:", err)
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"status": "message sent"})
 }
 
-func ImageProcess(c *gin.Context, fieldName string, file *multipart.FileHeader, processedImages chan map[string]interface{}) {
+func textMealItem(mealType string, text string) DB.MealItem {
+	return DB.MealItem{MealType: mealType, Food: text, Source: DB.MealSourceText}
+}
+
+// imageMealItems converts a photo analysis into one meal item per food with
+// its portion and nutrients.
+func imageMealItems(mealType string, analysis *AI.MealAnalysis) []DB.MealItem {
+	items := make([]DB.MealItem, 0, len(analysis.Items))
+	for _, food := range analysis.Items {
+		calories := int(math.Round(food.Calories))
+		portionGrams := roundTo(food.PortionGrams, 1)
+		item := DB.MealItem{
+			MealType:     mealType,
+			Food:         strings.TrimSpace(food.Name),
+			Calories:     &calories,
+			Source:       DB.MealSourceImage,
+			PortionGrams: &portionGrams,
+			Provider:     &analysis.Provider,
+			Nutrients: &DB.Nutrients{
+				Protein: roundTo(food.Protein, 1),
+				Carbs:   roundTo(food.Carbs, 1),
+				Fat:     roundTo(food.Fat, 1),
+				Fibre:   roundTo(food.Fibre, 1),
+				Sugar:   roundTo(food.Sugar, 1),
+				Sodium:  math.Round(food.Sodium),
+			},
+		}
+		if portion := strings.TrimSpace(food.Portion); portion != "" {
+			item.Portion = &portion
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Food < items[j].Food })
+	return items
+}
+
+// errUnreadableImage is sent by ImageProcess for an upload it can't read
+var errUnreadableImage = errors.New("unreadable image")
+
+// imageFormat returns the format of an uploaded photo as the providers
+// expect it in the data URI or MIME type, falling back to png
+func imageFormat(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return "jpeg"
+	case "image/webp":
+		return "webp"
+	default:
+		return "png"
+	}
+}
+
+// ImageProcess analyses an uploaded meal photo and sends the analysis, or
+// the error that prevented it, to processedImages
+func ImageProcess(c *gin.Context, fieldName string, file *multipart.FileHeader, processedImages chan map[string]interface{}, images AI.MealImageAnalyzer) {
 	fmt.Println("[ImageProcess] Processing image:", file.Filename)
 
 	openedFile, err := file.Open()
 	if err != nil {
 		fmt.Println("[ImageProcess] Failed to open file:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		processedImages <- map[string]interface{}{"fieldName": fieldName, "error": fmt.Errorf("%w: %v", errUnreadableImage, err)}
 		return
 	}
 	defer openedFile.Close()
@@ -315,26 +430,18 @@ func ImageProcess(c *gin.Context, fieldName string, file *multipart.FileHeader,
 	imageData, err := ioutil.ReadAll(openedFile)
 	if err != nil {
 		fmt.Println("[ImageProcess] Failed to read file:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		processedImages <- map[string]interface{}{"fieldName": fieldName, "error": fmt.Errorf("%w: %v", errUnreadableImage, err)}
 		return
 	}
 
-	imageType := http.DetectContentType(imageData)
-	switch imageType {
-	case "image/png":
-		imageType = "png"
-	case "image/webp":
-		imageType = "webp"
-	case "image/jpeg":
-		imageType = "png"
-	default:
-		imageType = "png"
-	}
+	imageType := imageFormat(imageData)
 	fmt.Println("[ImageProcess] Image type detected:", imageType)
 
-	result_map, err := AI.AnalyzeImageWithGroq(imageData, imageType)
+	result_map, err := images.AnalyzeMealImage(c.Request.Context(), imageData, imageType)
 	if err != nil {
-		fmt.Println("[ImageProcess] Error in AI.AnalyzeImageWithGroq:", err)
+		fmt.Println("[ImageProcess] Error analysing meal image:", err)
+		processedImages <- map[string]interface{}{"fieldName": fieldName, "error": err}
+		return
 	}
 
 	processedImages <- map[string]interface{}{
@@ -355,7 +462,7 @@ func GetMime(header *multipart.FileHeader) string {
 	return mime
 }
 
-func UpdateDietHandler(c *gin.Context) {
+func UpdateDietHandler(c *gin.Context, users DB.UserRepository, scores DB.HealthScoreRepository) {
 	email := c.PostForm("email")
 	diet := c.PostForm("diet_plan")
 	healthscore := c.PostForm("healthscore")
@@ -367,35 +474,40 @@ func UpdateDietHandler(c *gin.Context) {
 		hs = 0
 	}
 
-	err = DB.UpdateDiet(email, diet, hs)
+	err = users.UpdateDiet(c.Request.Context(), email, diet)
 	if err != nil {
 		fmt.Println("[UpdateDietHandler] Error updating diet:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "couldn't get updated"})
+		c.JSON(dbStatus(err), gin.H{"status": "couldn't get updated"})
 		return
 	}
+	if hs != 0 {
+		_, err = scores.RecordHealthScore(c.Request.Context(), email, DB.HealthScoreChange{
+			Score:  hs,
+			Source: DB.HealthScoreNutritionist,
+		})
+		if err != nil {
+			fmt.Println("[UpdateDietHandler] Error updating health score:", err)
+			c.JSON(dbStatus(err), gin.H{"status": "couldn't get updated"})
+			return
+		}
+	}
+	Auth.Audit(c, DB.AuditDietUpdate, email, gin.H{"healthscore": hs})
 	c.JSON(http.StatusOK, gin.H{"status": "plan updated"})
 }
 
-func GenDietPlan(c *gin.Context) {
-	fmt.Println("[GenDietPlan] Starting diet plan generation...")
-
+// dietPlanPrompt builds the diet plan prompt from the user data in the
+// request body and the stored profile of the current user. It responds with
+// the error and returns false when it can't.
+func dietPlanPrompt(c *gin.Context, users DB.UserRepository) (string, bool) {
 	var userData map[string]interface{}
 	if err := c.ShouldBindJSON(&userData); err != nil {
-		fmt.Println("[GenDietPlan] JSON Bind Error:", err)
+		fmt.Println("[dietPlanPrompt] JSON Bind Error:", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return "", false
 	}
 
 	// Log the received data
-	fmt.Printf("[GenDietPlan] Received user data: %+v\n", userData)
-
-	// Extract and validate email
-	emailVal, ok := userData["email"].(string)
-	if !ok || emailVal == "" {
-		fmt.Printf("[GenDietPlan] Email is missing or invalid: %v\n", userData["email"])
-		c.JSON(http.StatusBadRequest, gin.H{"error": "email is missing or invalid"})
-		return
-	}
+	fmt.Printf("[dietPlanPrompt] Received user data: %+v\n", userData)
 
 	// Create a prompt for the AI model
 	prompt := fmt.Sprintf(
@@ -417,77 +529,93 @@ func GenDietPlan(c *gin.Context) {
 		userData["activityLevel"], userData["goals"], userData["height"],
 		userData["weight"], userData["tweight"], userData["disease"])
 
+	// Ground the plan in calorie targets computed from the stored profile
+	profile, err := users.GetProfile(c.Request.Context(), Auth.CurrentUser(c))
+	if err == nil {
+		if targets, terr := Health.Targets(*profile); terr == nil {
+			prompt += "\n\n" + nutritionTargetsPrompt(targets)
+		}
+	} else if !errors.Is(err, DB.ErrNotFound) {
+		fmt.Println("[dietPlanPrompt] Error reading profile:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read profile"})
+		return "", false
+	}
+	return prompt, true
+}
+
+func GenDietPlan(c *gin.Context, users DB.UserRepository, text AI.TextGenerator) {
+	fmt.Println("[GenDietPlan] Starting diet plan generation...")
+
+	emailVal := Auth.CurrentUser(c)
+	prompt, ok := dietPlanPrompt(c, users)
+	if !ok {
+		return
+	}
+
 	fmt.Println("[GenDietPlan] Sending prompt to AI:", prompt)
 
-	// Generate diet plan via Groq AI
-	dietPlan, err := AI.GenGroqAI(prompt)
+	// Generate diet plan via the configured AI provider
+	generation, err := text.GenerateText(c.Request.Context(), AI.DietPlanPrompt(prompt))
 	if err != nil {
 		fmt.Println("[GenDietPlan] Failed to generate diet plan:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "couldn't generate diet plan"})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "couldn't generate diet plan, please try again later"})
 		return
 	}
-	fmt.Println("[GenDietPlan] Diet plan generated successfully:", dietPlan)
+	dietPlan := generation.Text
+	fmt.Println("[GenDietPlan] Diet plan generated successfully by", generation.Provider+":", dietPlan)
 
 	// Store result in DB
-	err = DB.UpdateDiet(emailVal, dietPlan, 0)
+	err = users.UpdateDiet(c.Request.Context(), emailVal, dietPlan)
 	if err != nil {
 		fmt.Println("[GenDietPlan] DB update error:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "couldn't store diet plan in database"})
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't store diet plan in database"})
 		return
 	}
 	fmt.Println("[GenDietPlan] Diet plan saved to database")
+	Auth.Audit(c, DB.AuditDietGenerate, emailVal, gin.H{"provider": generation.Provider})
 
 	// Send success response with the diet plan
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "success",
 		"diet_plan": dietPlan,
+		"provider":  generation.Provider,
 	})
 }
 
 // GetUserBasicInfo returns just the name and email of the user
-func GetUserBasicInfo(c *gin.Context) {
+func GetUserBasicInfo(c *gin.Context, users DB.UserRepository) {
 	fmt.Println("[GetUserBasicInfo] Starting basic info retrieval...")
 
-	email := c.Query("email")
-	if email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
-		return
-	}
+	email := Auth.CurrentUser(c)
 
-	var name string
-	err := DB.DB.QueryRow("SELECT name FROM user_details WHERE email = $1", email).Scan(&name)
+	user, err := users.GetProfile(c.Request.Context(), email)
 	if err != nil {
 		fmt.Printf("[GetUserBasicInfo] Error fetching name: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user info"})
+		c.JSON(dbStatus(err), gin.H{"error": "Failed to fetch user info"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"name":  name,
+		"name":  user.Name,
 		"email": email,
 	})
 }
 
 // GetUserBMI calculates and returns the user's BMI
-func GetUserBMI(c *gin.Context) {
+func GetUserBMI(c *gin.Context, users DB.UserRepository) {
 	fmt.Println("[GetUserBMI] Starting BMI calculation...")
 
-	email := c.Query("email")
-	if email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
-		return
-	}
+	email := Auth.CurrentUser(c)
 
-	var height, weight float64
-	err := DB.DB.QueryRow("SELECT height, weight FROM user_details WHERE email = $1", email).Scan(&height, &weight)
+	user, err := users.GetProfile(c.Request.Context(), email)
 	if err != nil {
 		fmt.Printf("[GetUserBMI] Error fetching metrics: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user metrics"})
+		c.JSON(dbStatus(err), gin.H{"error": "Failed to fetch user metrics"})
 		return
 	}
 
-	heightInMeters := height / 100.0
-	bmi := weight / (heightInMeters * heightInMeters)
+	heightInMeters := user.Height / 100.0
+	bmi := user.Weight / (heightInMeters * heightInMeters)
 	bmi = math.Round(bmi*100) / 100 // Round to 2 decimal places
 
 	c.JSON(http.StatusOK, gin.H{
@@ -496,24 +624,19 @@ func GetUserBMI(c *gin.Context) {
 }
 
 // GetUserHealthScore returns the user's health score
-func GetUserHealthScore(c *gin.Context) {
+func GetUserHealthScore(c *gin.Context, users DB.UserRepository) {
 	fmt.Println("[GetUserHealthScore] Starting health score retrieval...")
 
-	email := c.Query("email")
-	if email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
-		return
-	}
+	email := Auth.CurrentUser(c)
 
-	var healthscore int
-	err := DB.DB.QueryRow("SELECT healthscore FROM user_details WHERE email = $1", email).Scan(&healthscore)
+	user, err := users.GetProfile(c.Request.Context(), email)
 	if err != nil {
 		fmt.Printf("[GetUserHealthScore] Error fetching health score: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch health score"})
+		c.JSON(dbStatus(err), gin.H{"error": "Failed to fetch health score"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"healthscore": healthscore,
+		"healthscore": user.Healthscore,
 	})
 }
@@ -0,0 +1,290 @@
+package Controllers
+
+import (
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	Health "blissfulbites/Health"
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testEmail = "asha@example.com"
+
+// newTestContext returns a context for a GET of target by the signed-in
+// user email, with the recorder capturing its response.
+func newTestContext(email string, target string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	c.Set(Auth.ContextUserKey, email)
+	return c, w
+}
+
+// newTestStore returns a MemoryStore holding the profile of testEmail and
+// one tracked day.
+func newTestStore(t *testing.T) *DB.MemoryStore {
+	t.Helper()
+	store := DB.NewMemoryStore()
+	ctx := context.Background()
+
+	err := store.SaveProfile(ctx, &DB.UserProfile{
+		Email:         testEmail,
+		Name:          "Asha",
+		Gender:        "female",
+		Age:           34,
+		ActivityLevel: "moderate",
+		Goals:         "lose weight",
+		Height:        160,
+		Weight:        64,
+		TargetWeight:  58,
+		Diseases:      "none",
+		Healthscore:   5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	_, err = store.AddMealEntry(ctx, testEmail, DB.MealEntry{
+		Date:  &date,
+		Items: []DB.MealItem{{MealType: DB.MealBreakfast, Food: "Poha", Source: DB.MealSourceText}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func TestGetUserBasicInfo(t *testing.T) {
+	store := newTestStore(t)
+
+	tests := []struct {
+		email    string
+		wantCode int
+		wantName interface{}
+	}{
+		{testEmail, http.StatusOK, "Asha"},
+		{"nobody@example.com", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		c, w := newTestContext(tt.email, "/userBasicInfo")
+		GetUserBasicInfo(c, store)
+
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.email, w.Code, tt.wantCode)
+			continue
+		}
+		if name := decodeBody(t, w)["name"]; name != tt.wantName {
+			t.Errorf("%s: name %v, want %v", tt.email, name, tt.wantName)
+		}
+	}
+}
+
+func TestGetUserBMI(t *testing.T) {
+	store := newTestStore(t)
+
+	tests := []struct {
+		email    string
+		wantCode int
+		wantBMI  interface{}
+	}{
+		{testEmail, http.StatusOK, 25.0},
+		{"nobody@example.com", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		c, w := newTestContext(tt.email, "/userBMI")
+		GetUserBMI(c, store)
+
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.email, w.Code, tt.wantCode)
+			continue
+		}
+		if bmi := decodeBody(t, w)["bmi"]; bmi != tt.wantBMI {
+			t.Errorf("%s: bmi %v, want %v", tt.email, bmi, tt.wantBMI)
+		}
+	}
+}
+
+func TestFormUserDataHandler(t *testing.T) {
+	store := newTestStore(t)
+
+	c, w := newTestContext(testEmail, "/userDetails")
+	FormUserDataHandler(c, store, store, store)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	body := decodeBody(t, w)
+	if body["email"] != testEmail || body["bmi"] != 25.0 {
+		t.Errorf("got email %v and bmi %v", body["email"], body["bmi"])
+	}
+	if track, _ := body["track"].([]interface{}); len(track) != 1 {
+		t.Errorf("got %d tracked days, want 1", len(track))
+	}
+	if _, ok := body["healthscore_breakdown"].(map[string]interface{}); !ok {
+		t.Errorf("missing health score breakdown")
+	}
+
+	c, w = newTestContext("nobody@example.com", "/userDetails")
+	FormUserDataHandler(c, store, store, store)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAppendMealsHandlerValidatesDateAndWeight(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 2).Format("2006-01-02")
+
+	tests := []struct {
+		name     string
+		date     string
+		weight   string
+		wantCode int
+	}{
+		{"past day", "2024-03-02", "63.5", http.StatusOK},
+		{"future day", tomorrow, "63.5", http.StatusBadRequest},
+		{"malformed date", "02/03/2024", "", http.StatusBadRequest},
+		{"zero weight", "2024-03-02", "0", http.StatusBadRequest},
+		{"weight over 500 kg", "2024-03-02", "501", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		store := newTestStore(t)
+		before, err := store.ListWeightEntries(context.Background(), testEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		form := multipart.NewWriter(&buf)
+		for field, value := range map[string]string{
+			"date": tt.date, "weight": tt.weight,
+			"breakfast": "Poha", "lunch": "Dal rice", "dinner": "Roti sabzi",
+		} {
+			form.WriteField(field, value)
+		}
+		form.Close()
+
+		c, w := newTestContext(testEmail, "/appendMeals")
+		c.Request = httptest.NewRequest(http.MethodPost, "/appendMeals", &buf)
+		c.Request.Header.Set("Content-Type", form.FormDataContentType())
+		AppendMealsHandler(c, store, store, nil)
+
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.wantCode, w.Body.String())
+			continue
+		}
+		if tt.wantCode == http.StatusOK {
+			continue
+		}
+		after, err := store.ListWeightEntries(context.Background(), testEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != len(before) {
+			t.Errorf("%s: logged %d weight entries for a rejected request", tt.name, len(after)-len(before))
+		}
+	}
+}
+
+func TestComputedScoreChanged(t *testing.T) {
+	version := "v1"
+	factors := []DB.HealthScoreFactor{{Factor: "bmi", Value: "25.0", Points: -5}}
+	result := Health.Result{Score: 7, RuleVersion: version, Factors: factors}
+
+	computed := func(version string, factors []DB.HealthScoreFactor) DB.HealthScoreChange {
+		return DB.HealthScoreChange{Score: 7, Source: DB.HealthScoreComputed, RuleVersion: &version, Breakdown: factors}
+	}
+	self := DB.HealthScoreChange{Score: 5, Source: DB.HealthScoreSelf}
+	nutritionist := DB.HealthScoreChange{Score: 9, Source: DB.HealthScoreNutritionist}
+
+	tests := []struct {
+		name    string
+		history []DB.HealthScoreChange
+		want    bool
+	}{
+		{"no history", nil, true},
+		{"only self-entered", []DB.HealthScoreChange{self}, true},
+		{"unchanged", []DB.HealthScoreChange{computed(version, factors)}, false},
+		{"unchanged after a self-entered score", []DB.HealthScoreChange{computed(version, factors), self}, false},
+		{"new rule version", []DB.HealthScoreChange{computed("v0", factors)}, true},
+		{"profile changed", []DB.HealthScoreChange{computed(version, []DB.HealthScoreFactor{{Factor: "bmi", Value: "27.1", Points: -10}})}, true},
+		{"set by a nutritionist", []DB.HealthScoreChange{computed("v0", nil), nutritionist}, false},
+		{"profile saved after a nutritionist", []DB.HealthScoreChange{computed("v0", nil), nutritionist, self}, true},
+	}
+	for _, tt := range tests {
+		if got := computedScoreChanged(tt.history, result); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormUserDataHandlerKeepsScoreOnRead(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	read := func() map[string]interface{} {
+		c, w := newTestContext(testEmail, "/userDetails")
+		FormUserDataHandler(c, store, store, store)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		return decodeBody(t, w)
+	}
+
+	read()
+	read()
+	history, err := store.ListHealthScores(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Source != DB.HealthScoreComputed {
+		t.Fatalf("got history %+v after two reads, want one computed score", history)
+	}
+
+	_, err = store.RecordHealthScore(ctx, testEmail, DB.HealthScoreChange{Score: 9, Source: DB.HealthScoreNutritionist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score := read()["healthscore"]; score != 9.0 {
+		t.Errorf("got health score %v after a read, want the nutritionist's 9", score)
+	}
+	if history, _ := store.ListHealthScores(ctx, testEmail); len(history) != 2 {
+		t.Errorf("got %d history rows, want 2", len(history))
+	}
+}
+
+func TestImageFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00"), "jpeg"},
+		{"png", []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR"), "png"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "webp"},
+		{"unknown", []byte("not an image"), "png"},
+	}
+	for _, tt := range tests {
+		if got := imageFormat(tt.data); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package Controllers
+
+import (
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthScoreHistoryHandler returns the health score history of the current
+// user
+func HealthScoreHistoryHandler(c *gin.Context, scores DB.HealthScoreRepository) {
+	writeHealthScoreHistory(c, Auth.CurrentUser(c), scores)
+}
+
+// AdminHealthScoreHistoryHandler returns the health score history of the
+// user given by the email query parameter
+func AdminHealthScoreHistoryHandler(c *gin.Context, scores DB.HealthScoreRepository) {
+	email := c.Query("email")
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		return
+	}
+	Auth.Audit(c, DB.AuditAdminViewUser, email, gin.H{"section": "health_scores"})
+	writeHealthScoreHistory(c, email, scores)
+}
+
+func writeHealthScoreHistory(c *gin.Context, email string, scores DB.HealthScoreRepository) {
+	history, err := scores.ListHealthScores(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[HealthScoreHistory] Error reading history:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read health score history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"email": email, "history": history})
+}
@@ -0,0 +1,179 @@
+package Controllers
+
+import (
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	Health "blissfulbites/Health"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NutritionTargetsHandler returns the BMR, TDEE and goal-adjusted daily
+// calorie target of the current user
+func NutritionTargetsHandler(c *gin.Context, users DB.UserRepository) {
+	email := Auth.CurrentUser(c)
+
+	profile, err := users.GetProfile(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[NutritionTargetsHandler] Error reading profile:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read profile"})
+		return
+	}
+
+	targets, err := Health.Targets(*profile)
+	if errors.Is(err, Health.ErrIncompleteProfile) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Complete your age, height and weight to get nutrition targets."})
+		return
+	}
+	if err != nil {
+		fmt.Println("[NutritionTargetsHandler] Error computing targets:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "couldn't compute nutrition targets"})
+		return
+	}
+	c.JSON(http.StatusOK, targets)
+}
+
+// nutritionTargetsPrompt tells the diet plan model the calories to plan for
+func nutritionTargetsPrompt(t Health.NutritionTargets) string {
+	goal := "maintain their current weight"
+	switch t.Goal {
+	case Health.GoalLose:
+		goal = "lose weight gradually"
+	case Health.GoalGain:
+		goal = "gain weight gradually"
+	}
+	return fmt.Sprintf(
+		"NUTRITION TARGETS:\n"+
+			"Their BMR is about %d kcal (Mifflin-St Jeor) and their total daily energy expenditure about %d kcal. "+
+			"To %s, plan for a Daily Calorie Target of %d kcal and never go below %d kcal. "+
+			"State the daily calorie target and the approximate calories of each meal, and make the meals add up to the target.",
+		t.BMRMifflinStJeor, t.TDEE, goal, t.DailyCalories, t.MinimumCalories)
+}
+
+// mealNutrition totals the calories and nutrients of a day or meal. Items
+// without nutrients, typed meals and photos analysed before nutrients were
+// estimated, count in Unanalysed; the totals then understate intake.
+type mealNutrition struct {
+	Calories int `json:"calories"`
+	DB.Nutrients
+	Analysed   int `json:"analysed_items"`
+	Unanalysed int `json:"unanalysed_items"`
+}
+
+// dailyNutrition totals one day, or the entries tracked without a date when
+// Date is empty.
+type dailyNutrition struct {
+	Date string `json:"date,omitempty"`
+	mealNutrition
+	Meals map[string]*mealNutrition `json:"meals"`
+}
+
+func (n *mealNutrition) add(item DB.MealItem) {
+	if item.Calories != nil {
+		n.Calories += *item.Calories
+	}
+	if item.Nutrients == nil {
+		n.Unanalysed++
+		return
+	}
+	n.Analysed++
+	n.Nutrients = n.Nutrients.Add(*item.Nutrients)
+}
+
+func (n *mealNutrition) round() {
+	n.Protein = roundTo(n.Protein, 1)
+	n.Carbs = roundTo(n.Carbs, 1)
+	n.Fat = roundTo(n.Fat, 1)
+	n.Fibre = roundTo(n.Fibre, 1)
+	n.Sugar = roundTo(n.Sugar, 1)
+	n.Sodium = math.Round(n.Sodium)
+}
+
+// summarizeNutrition totals the meal items of entries per day and meal,
+// oldest day first. Entries tracked without a date are totalled separately
+// in undated, which is nil when there are none.
+func summarizeNutrition(entries []DB.MealEntry) (days []dailyNutrition, undated *dailyNutrition) {
+	byDate := map[string]*dailyNutrition{}
+	for _, e := range entries {
+		date := ""
+		if e.Date != nil {
+			date = e.Date.Format("2006-01-02")
+		}
+		day, ok := byDate[date]
+		if !ok {
+			day = &dailyNutrition{Date: date, Meals: map[string]*mealNutrition{}}
+			byDate[date] = day
+		}
+		for _, item := range e.Items {
+			meal, ok := day.Meals[item.MealType]
+			if !ok {
+				meal = &mealNutrition{}
+				day.Meals[item.MealType] = meal
+			}
+			meal.add(item)
+			day.add(item)
+		}
+	}
+
+	days = make([]dailyNutrition, 0, len(byDate))
+	for _, day := range byDate {
+		day.round()
+		for _, meal := range day.Meals {
+			meal.round()
+		}
+		if day.Date == "" {
+			undated = day
+			continue
+		}
+		days = append(days, *day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days, undated
+}
+
+// DailyNutritionHandler returns the calories, macronutrients, fibre, sugar
+// and sodium the current user ate per day and meal. from and to optionally
+// bound the dates, inclusive; meals tracked without a date are reported in
+// "undated" whatever the bounds.
+func DailyNutritionHandler(c *gin.Context, meals DB.MealRepository) {
+	email := Auth.CurrentUser(c)
+
+	var from, to string
+	for _, bound := range []struct {
+		name  string
+		value *string
+	}{{"from", &from}, {"to", &to}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.name + " date."})
+			return
+		}
+		*bound.value = value
+	}
+
+	entries, err := meals.ListMealEntries(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[DailyNutritionHandler] Error reading meals:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read meals"})
+		return
+	}
+
+	summary, undated := summarizeNutrition(entries)
+	days := []dailyNutrition{}
+	for _, day := range summary {
+		if (from != "" && day.Date < from) || (to != "" && day.Date > to) {
+			continue
+		}
+		days = append(days, day)
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "undated": undated})
+}
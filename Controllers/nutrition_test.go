@@ -0,0 +1,76 @@
+package Controllers
+
+import (
+	DB "blissfulbites/DB"
+	"testing"
+	"time"
+)
+
+func TestSummarizeNutrition(t *testing.T) {
+	day := func(d int) *time.Time {
+		date := time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+	item := func(meal string, calories int) DB.MealItem {
+		return DB.MealItem{MealType: meal, Food: "oats", Calories: &calories, Nutrients: &DB.Nutrients{Protein: 5}}
+	}
+	typed := DB.MealItem{MealType: "lunch", Food: "salad"}
+
+	tests := []struct {
+		name         string
+		entries      []DB.MealEntry
+		wantDays     []string
+		wantCalories []int
+		wantUndated  int
+	}{
+		{"no entries", nil, []string{}, []int{}, -1},
+		{
+			"days sorted and summed",
+			[]DB.MealEntry{
+				{Date: day(3), Items: []DB.MealItem{item("breakfast", 300)}},
+				{Date: day(1), Items: []DB.MealItem{item("breakfast", 200), typed}},
+				{Date: day(3), Items: []DB.MealItem{item("dinner", 500)}},
+			},
+			[]string{"2024-03-01", "2024-03-03"},
+			[]int{200, 800},
+			-1,
+		},
+		{
+			"undated entries bucketed separately",
+			[]DB.MealEntry{
+				{Date: day(2), Items: []DB.MealItem{item("lunch", 400)}},
+				{Items: []DB.MealItem{item("snack", 150)}},
+				{Items: []DB.MealItem{item("dinner", 250), typed}},
+			},
+			[]string{"2024-03-02"},
+			[]int{400},
+			400,
+		},
+	}
+	for _, tt := range tests {
+		days, undated := summarizeNutrition(tt.entries)
+		if len(days) != len(tt.wantDays) {
+			t.Errorf("%s: got %d days, want %d", tt.name, len(days), len(tt.wantDays))
+			continue
+		}
+		for i, d := range days {
+			if d.Date != tt.wantDays[i] || d.Calories != tt.wantCalories[i] {
+				t.Errorf("%s: day %d is %s with %d kcal, want %s with %d kcal", tt.name, i, d.Date, d.Calories, tt.wantDays[i], tt.wantCalories[i])
+			}
+		}
+
+		switch {
+		case tt.wantUndated < 0 && undated != nil:
+			t.Errorf("%s: got undated %+v, want none", tt.name, undated)
+		case tt.wantUndated >= 0 && undated == nil:
+			t.Errorf("%s: got no undated total, want %d kcal", tt.name, tt.wantUndated)
+		case undated != nil && (undated.Calories != tt.wantUndated || undated.Date != ""):
+			t.Errorf("%s: got undated %d kcal on %q, want %d kcal without a date", tt.name, undated.Calories, undated.Date, tt.wantUndated)
+		}
+	}
+
+	_, undated := summarizeNutrition([]DB.MealEntry{{Items: []DB.MealItem{item("snack", 150), typed}}})
+	if undated == nil || undated.Analysed != 1 || undated.Unanalysed != 1 || len(undated.Meals) != 2 {
+		t.Errorf("got undated %+v, want one analysed and one unanalysed item in two meals", undated)
+	}
+}
@@ -0,0 +1,120 @@
+package Controllers
+
+import (
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorStatusHandler reports whether the current user has 2FA enabled
+func TwoFactorStatusHandler(c *gin.Context) {
+	email := Auth.CurrentUser(c)
+	enabled, err := DB.Accounts.IsTOTPEnabled(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[TwoFactorStatusHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read two-factor status"})
+		return
+	}
+
+	remaining := 0
+	if enabled {
+		remaining, err = DB.Accounts.CountRecoveryCodes(c.Request.Context(), email)
+		if err != nil {
+			fmt.Println("[TwoFactorStatusHandler]", err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": enabled, "recovery_codes_left": remaining})
+}
+
+// TwoFactorEnrollHandler starts TOTP enrollment and returns the secret and
+// otpauth:// URI to render as a QR code
+func TwoFactorEnrollHandler(c *gin.Context) {
+	enrollment, err := Auth.EnrollTOTP(c.Request.Context(), Auth.CurrentUser(c))
+	if errors.Is(err, DB.ErrTwoFactorEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("[TwoFactorEnrollHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't start two-factor enrollment"})
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// TwoFactorConfirmHandler enables TOTP after the first valid code and returns
+// the recovery codes
+func TwoFactorConfirmHandler(c *gin.Context) {
+	var json struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	codes, err := Auth.ConfirmTOTP(c.Request.Context(), Auth.CurrentUser(c), json.Code)
+	switch {
+	case errors.Is(err, Auth.ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, DB.ErrTwoFactorEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, DB.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending two-factor enrollment"})
+		return
+	case err != nil:
+		fmt.Println("[TwoFactorConfirmHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't enable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// TwoFactorDisableHandler turns 2FA off after checking a current code
+func TwoFactorDisableHandler(c *gin.Context) {
+	var json struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	err := Auth.DisableTOTP(c.Request.Context(), Auth.CurrentUser(c), json.Code)
+	if err == Auth.ErrInvalidCode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("[TwoFactorDisableHandler]", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "couldn't disable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "two-factor authentication disabled"})
+}
+
+// AdminResetTwoFactorHandler removes 2FA from a user who lost their device
+// and recovery codes
+func AdminResetTwoFactorHandler(c *gin.Context) {
+	var json struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := DB.Accounts.DeleteTOTP(c.Request.Context(), json.Email); err != nil {
+		fmt.Println("[AdminResetTwoFactorHandler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't reset two-factor authentication"})
+		return
+	}
+	Auth.Audit(c, DB.AuditTwoFactorReset, json.Email, nil)
+	c.JSON(http.StatusOK, gin.H{"status": "two-factor authentication reset", "email": json.Email})
+}
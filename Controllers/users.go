@@ -1,57 +1,159 @@
 package Controllers
 
 import (
+	Auth "blissfulbites/Auth"
 	DB "blissfulbites/DB"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func UserDataHandler(c *gin.Context) {
-	email := c.Query("email")
-	data, err := DB.ReadRowData(email)
+func AllUsersDataHandler(c *gin.Context, users DB.UserRepository) {
+	allUsers, err := users.ListProfiles(c.Request.Context())
 	if err != nil {
-		fmt.Println("[User Data handler]", err)
+		fmt.Println("[All users handler]", err)
+		c.JSON(dbStatus(err), gin.H{"error":err.Error()})
+		return
 	}
-	trackJson, _ := DB.ReadTrack(email)
+	Auth.Audit(c, DB.AuditAdminViewUsers, "*", gin.H{"count": len(allUsers)})
+	c.HTML(http.StatusOK, "admin.html", allUsers)
 
-	if trackJson != nil {
+}
 
-		var nestedData []map[string]interface{}
-		if err := json.Unmarshal(trackJson, &nestedData); err != nil {
-			fmt.Println("[user details unmarshalling]", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unmarshal JSON data"})
-			return
-		}
-		
-		delete(data, "track")
+// CurrentUserHandler returns the email, role and onboarding state of the
+// authenticated user
+func CurrentUserHandler(c *gin.Context, users DB.UserRepository, credentials DB.CredentialRepository) {
+	email := Auth.CurrentUser(c)
+	role, err := DB.Accounts.GetUserRole(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[Current user handler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read user"})
+		return
+	}
+	onboarding, err := DB.OnboardingState(c.Request.Context(), users, credentials, email)
+	if err != nil {
+		fmt.Println("[Current user handler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"email": email, "role": role, "onboarding": onboarding})
+}
 
-		data["track"] = nestedData
+// FirstLoginHandler answers 404 while the user still has to fill in /form
+func FirstLoginHandler(c *gin.Context, users DB.UserRepository, credentials DB.CredentialRepository) {
+	email := Auth.CurrentUser(c)
+	onboarding, err := DB.OnboardingState(c.Request.Context(), users, credentials, email)
+	if err != nil {
+		fmt.Println("[First login handler]", err)
+		c.JSON(dbStatus(err), gin.H{"message": "couldn't check profile"})
+		return
+	}
+	if onboarding == DB.OnboardingComplete {
+		c.JSON(http.StatusOK, gin.H{"message": "Email exists", "onboarding": onboarding})
+	} else {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Email does not exist", "onboarding": onboarding})
 	}
-	c.JSON(http.StatusOK, data)
 }
 
-func AllUsersDataHandler(c *gin.Context) {
-	allUsers, err := DB.ReadAllUsers("SELECT * FROM user_details")
+
+
+// SetRoleHandler changes the role of an existing user
+func SetRoleHandler(c *gin.Context) {
+	var json struct {
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if !Auth.ValidRole(json.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	err := DB.Accounts.SetUserRole(c.Request.Context(), json.Email, json.Role)
+	if errors.Is(err, DB.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
 	if err != nil {
-		fmt.Println("[All users handler]", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error":err.Error()})
+		fmt.Println("[Set role handler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't update role"})
 		return
 	}
-	c.HTML(http.StatusOK, "admin.html", allUsers)
+	Auth.Audit(c, DB.AuditRoleUpdate, json.Email, gin.H{"role": json.Role})
+	c.JSON(http.StatusOK, gin.H{"status": "role updated", "email": json.Email, "role": json.Role})
+}
 
+// LockoutsHandler lists recent login lockouts, only active ones with ?active=true
+func LockoutsHandler(c *gin.Context) {
+	events, err := DB.Accounts.ListLockoutEvents(c.Request.Context(), c.Query("active") == "true", 100)
+	if err != nil {
+		fmt.Println("[Lockouts handler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't list lockouts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lockouts": events})
 }
 
-func FirstLoginHandler(c *gin.Context) {
-	email := c.Query("email")
-	fmt.Println(email)
-	exists, _ := DB.CheckEmailExists(email)
-	if exists {
-		c.JSON(http.StatusOK, gin.H{"message": "Email exists"})
-	} else {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Email does not exist"})
+// UnlockAccountHandler lifts the login lock on an account
+func UnlockAccountHandler(c *gin.Context) {
+	var json struct {
+		Email string `json:"email" binding:"required"`
 	}
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := DB.Accounts.UnlockAccount(c.Request.Context(), json.Email, Auth.CurrentUser(c)); err != nil {
+		fmt.Println("[Unlock account handler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't unlock account"})
+		return
+	}
+	Auth.Audit(c, DB.AuditAccountUnlock, json.Email, nil)
+	c.JSON(http.StatusOK, gin.H{"status": "account unlocked", "email": json.Email})
 }
 
+// AuditLogHandler queries the audit log by actor, subject, action and an
+// RFC 3339 time range (from inclusive, to exclusive)
+func AuditLogHandler(c *gin.Context) {
+	filter := DB.AuditFilter{
+		Actor:   c.Query("actor"),
+		Subject: c.Query("subject"),
+		Action:  c.Query("action"),
+	}
 
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+	}
+
+	events, err := DB.Accounts.QueryAuditEvents(c.Request.Context(), filter)
+	if err != nil {
+		fmt.Println("[Audit log handler]", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't query audit log"})
+		return
+	}
+	Auth.Audit(c, DB.AuditAdminViewAudit, "*", nil)
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
@@ -0,0 +1,205 @@
+package Controllers
+
+import (
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// weightTrendDays is the time constant of the moving average: a
+	// measurement moves the trend by about 1-1/e of the way to it after
+	// this many days.
+	weightTrendDays = 10.0
+	// weightRateWindow is how far back the weekly rate of change looks
+	weightRateWindow = 28 * 24 * time.Hour
+	// weightRateMinSpan is the least history the rate is computed from
+	weightRateMinSpan = 3 * 24 * time.Hour
+	// weightGoalTolerance is how close to the target counts as reached, in kg
+	weightGoalTolerance = 0.5
+	// weightMaxProjection bounds projections of a very slow trend
+	weightMaxProjection = 2 * 365 * 24 * time.Hour
+)
+
+// Goal states of a weight summary
+const (
+	weightGoalNone     = "no_target"
+	weightGoalReached  = "reached"
+	weightGoalOnTrack  = "on_track"
+	weightGoalOffTrack = "off_track"
+	weightGoalUnknown  = "unknown"
+)
+
+type weightPoint struct {
+	DB.WeightEntry
+	Trend float64 `json:"trend"`
+}
+
+type weightSummary struct {
+	Entries       []weightPoint `json:"entries"`
+	CurrentWeight *float64      `json:"current_weight"`
+	TrendWeight   *float64      `json:"trend_weight"`
+	TargetWeight  float64       `json:"target_weight"`
+	WeeklyChange  *float64      `json:"weekly_change"`
+	ProjectedDate *string       `json:"projected_date"`
+	GoalStatus    string        `json:"goal_status"`
+}
+
+// summarizeWeights smooths entries (oldest first) with an exponential moving
+// average, estimates the weekly rate of change from the trend of the last
+// four weeks and projects when it reaches target.
+func summarizeWeights(entries []DB.WeightEntry, target float64) weightSummary {
+	summary := weightSummary{Entries: make([]weightPoint, 0, len(entries)), TargetWeight: target, GoalStatus: weightGoalUnknown}
+	if target <= 0 {
+		summary.GoalStatus = weightGoalNone
+	}
+	if len(entries) == 0 {
+		return summary
+	}
+
+	// The smoothing factor depends on the gap between measurements, so
+	// irregular logging doesn't skew the trend.
+	trend := entries[0].Weight
+	for i, e := range entries {
+		if i > 0 {
+			days := e.MeasuredAt.Sub(entries[i-1].MeasuredAt).Hours() / 24
+			alpha := 1 - math.Exp(-math.Max(days, 0)/weightTrendDays)
+			trend += alpha * (e.Weight - trend)
+		}
+		summary.Entries = append(summary.Entries, weightPoint{WeightEntry: e, Trend: roundTo(trend, 2)})
+	}
+
+	last := summary.Entries[len(summary.Entries)-1]
+	current, trendWeight := last.Weight, last.Trend
+	summary.CurrentWeight, summary.TrendWeight = &current, &trendWeight
+
+	rate, ok := weeklyTrendRate(summary.Entries)
+	if ok {
+		rate = roundTo(rate, 2)
+		summary.WeeklyChange = &rate
+	}
+
+	if target <= 0 {
+		return summary
+	}
+	remaining := target - trendWeight
+	switch {
+	case math.Abs(remaining) <= weightGoalTolerance:
+		summary.GoalStatus = weightGoalReached
+	case !ok:
+		summary.GoalStatus = weightGoalUnknown
+	case remaining*rate <= 0:
+		summary.GoalStatus = weightGoalOffTrack
+	default:
+		eta := time.Duration(remaining / rate * 7 * 24 * float64(time.Hour))
+		if eta > weightMaxProjection {
+			summary.GoalStatus = weightGoalOffTrack
+			break
+		}
+		date := last.MeasuredAt.Add(eta).Format("2006-01-02")
+		summary.ProjectedDate = &date
+		summary.GoalStatus = weightGoalOnTrack
+	}
+	return summary
+}
+
+// weeklyTrendRate fits a line through the trend points of the last
+// weightRateWindow and returns its slope in kg per week.
+func weeklyTrendRate(points []weightPoint) (float64, bool) {
+	end := points[len(points)-1].MeasuredAt
+	start := end.Add(-weightRateWindow)
+
+	var n, sumX, sumY, sumXY, sumXX float64
+	first := end
+	for _, p := range points {
+		if p.MeasuredAt.Before(start) {
+			continue
+		}
+		if p.MeasuredAt.Before(first) {
+			first = p.MeasuredAt
+		}
+		x := p.MeasuredAt.Sub(start).Hours() / (24 * 7)
+		n++
+		sumX += x
+		sumY += p.Trend
+		sumXY += x * p.Trend
+		sumXX += x * x
+	}
+	if n < 2 || end.Sub(first) < weightRateMinSpan {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX), true
+}
+
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// WeightHistoryHandler returns the weight log of the current user with its
+// trend, weekly rate of change and projected date to reach target_weight
+func WeightHistoryHandler(c *gin.Context, users DB.UserRepository, weights DB.WeightRepository) {
+	email := Auth.CurrentUser(c)
+
+	profile, err := users.GetProfile(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[WeightHistoryHandler] Error reading profile:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read profile"})
+		return
+	}
+	entries, err := weights.ListWeightEntries(c.Request.Context(), email)
+	if err != nil {
+		fmt.Println("[WeightHistoryHandler] Error reading weights:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't read weight history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summarizeWeights(entries, profile.TargetWeight))
+}
+
+// LogWeightHandler adds a measurement to the weight log. measured_at is
+// optional and accepts a date or an RFC 3339 time; it defaults to now.
+func LogWeightHandler(c *gin.Context, weights DB.WeightRepository) {
+	email := Auth.CurrentUser(c)
+
+	weight, err := strconv.ParseFloat(c.PostForm("weight"), 64)
+	if err != nil || weight <= 0 || weight > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid weight."})
+		return
+	}
+
+	measuredAt := time.Now()
+	if value := c.PostForm("measured_at"); value != "" {
+		measuredAt, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			measuredAt, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil || measuredAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid measured_at."})
+			return
+		}
+	}
+
+	id, err := weights.AddWeightEntry(c.Request.Context(), email, DB.WeightEntry{
+		Weight:     weight,
+		MeasuredAt: measuredAt,
+		Source:     DB.WeightSourceManual,
+	})
+	if errors.Is(err, DB.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Complete your profile before logging weight."})
+		return
+	}
+	if err != nil {
+		fmt.Println("[LogWeightHandler] Error logging weight:", err)
+		c.JSON(dbStatus(err), gin.H{"error": "couldn't log weight"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "weight logged", "id": id})
+}
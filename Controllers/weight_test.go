@@ -0,0 +1,112 @@
+package Controllers
+
+import (
+	DB "blissfulbites/DB"
+	"math"
+	"testing"
+	"time"
+)
+
+var weightStart = time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+// dailyWeights returns days daily measurements starting at weight and
+// changing by perDay kg each day.
+func dailyWeights(days int, weight float64, perDay float64) []DB.WeightEntry {
+	entries := make([]DB.WeightEntry, days)
+	for i := range entries {
+		entries[i] = DB.WeightEntry{Weight: weight + float64(i)*perDay, MeasuredAt: weightStart.AddDate(0, 0, i)}
+	}
+	return entries
+}
+
+func TestWeeklyTrendRate(t *testing.T) {
+	// points returns trend points changing by perWeek kg a week
+	points := func(days []int, perWeek float64) []weightPoint {
+		var p []weightPoint
+		for _, d := range days {
+			p = append(p, weightPoint{
+				WeightEntry: DB.WeightEntry{MeasuredAt: weightStart.AddDate(0, 0, d)},
+				Trend:       70 + float64(d)/7*perWeek,
+			})
+		}
+		return p
+	}
+
+	tests := []struct {
+		name   string
+		points []weightPoint
+		want   float64
+		wantOK bool
+	}{
+		{"losing half a kilo a week", points([]int{0, 7, 14, 21, 28}, -0.5), -0.5, true},
+		{"gaining irregularly", points([]int{0, 3, 4, 12}, 0.25), 0.25, true},
+		{"only the last four weeks count", append(points([]int{-60}, 10), points([]int{0, 7, 14}, -1)...), -1, true},
+		{"one measurement", points([]int{0}, -1), 0, false},
+		{"less than three days", points([]int{0, 1, 2}, -1), 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := weeklyTrendRate(tt.points)
+		if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: got (%v, %v), want (%v, %v)", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestSummarizeWeights(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       []DB.WeightEntry
+		target        float64
+		wantStatus    string
+		wantCurrent   float64
+		wantTrend     float64
+		wantProjected bool
+	}{
+		{"no entries", nil, 60, weightGoalUnknown, 0, 0, false},
+		{"no entries or target", nil, 0, weightGoalNone, 0, 0, false},
+		{"no target", dailyWeights(10, 70, -0.1), 0, weightGoalNone, 69.1, 69.66, false},
+		{"single measurement", dailyWeights(1, 70, 0), 60, weightGoalUnknown, 70, 70, false},
+		{"within the tolerance", dailyWeights(1, 60.4, 0), 60, weightGoalReached, 60.4, 60.4, false},
+		{"losing towards the target", dailyWeights(28, 70, -0.1), 65, weightGoalOnTrack, 67.3, 68.19, true},
+		{"gaining away from the target", dailyWeights(28, 70, 0.1), 65, weightGoalOffTrack, 72.7, 71.81, false},
+		{"too slow to project", dailyWeights(28, 70, -0.0005), 60, weightGoalOffTrack, 69.99, 69.99, false},
+	}
+	for _, tt := range tests {
+		s := summarizeWeights(tt.entries, tt.target)
+		if s.GoalStatus != tt.wantStatus {
+			t.Errorf("%s: status %s, want %s", tt.name, s.GoalStatus, tt.wantStatus)
+		}
+		if (s.ProjectedDate != nil) != tt.wantProjected {
+			t.Errorf("%s: projected date %v, want one: %v", tt.name, s.ProjectedDate, tt.wantProjected)
+		}
+		if len(s.Entries) != len(tt.entries) {
+			t.Errorf("%s: %d points for %d entries", tt.name, len(s.Entries), len(tt.entries))
+		}
+		if len(tt.entries) == 0 {
+			if s.CurrentWeight != nil || s.TrendWeight != nil || s.WeeklyChange != nil {
+				t.Errorf("%s: got current, trend or rate without entries", tt.name)
+			}
+			continue
+		}
+		if math.Abs(*s.CurrentWeight-tt.wantCurrent) > 0.01 || math.Abs(*s.TrendWeight-tt.wantTrend) > 0.01 {
+			t.Errorf("%s: current %v and trend %v, want %v and %v", tt.name, *s.CurrentWeight, *s.TrendWeight, tt.wantCurrent, tt.wantTrend)
+		}
+	}
+}
+
+func TestSummarizeWeightsSmoothsByElapsedTime(t *testing.T) {
+	entries := []DB.WeightEntry{
+		{Weight: 70, MeasuredAt: weightStart},
+		{Weight: 60, MeasuredAt: weightStart.Add(weightTrendDays * 24 * time.Hour)},
+	}
+	s := summarizeWeights(entries, 0)
+
+	// After weightTrendDays the trend covers 1-1/e of the distance
+	want := roundTo(70-10*(1-math.Exp(-1)), 2)
+	if got := s.Entries[1].Trend; got != want {
+		t.Errorf("trend %v, want %v", got, want)
+	}
+	if s.Entries[0].Trend != 70 {
+		t.Errorf("first trend %v, want the first weight", s.Entries[0].Trend)
+	}
+}
@@ -0,0 +1,245 @@
+package DB
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CredentialsInfo is the account metadata included in a data export. It
+// never contains password hashes, TOTP secrets or token hashes.
+type CredentialsInfo struct {
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	HasPassword     bool       `json:"has_password"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TwoFactor       bool       `json:"two_factor_enabled"`
+	Identities      []string   `json:"linked_identities"`
+	ActiveSessions  int        `json:"active_sessions"`
+	APITokens       []APIToken `json:"api_tokens"`
+}
+
+// AccountDeletion is a pending or completed deletion request
+type AccountDeletion struct {
+	RequestedAt  time.Time  `json:"requested_at"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	CompletedAt  *time.Time `json:"completed_at"`
+}
+
+// ReadCredentialsInfo collects the account metadata of email for an export.
+func (s *PostgresStore) ReadCredentialsInfo(ctx context.Context, email string) (*CredentialsInfo, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	info := &CredentialsInfo{Email: email, Identities: []string{}}
+	err := DB.QueryRowContext(ctx, `
+		SELECT role, password <> '', email_verified_at,
+			EXISTS (SELECT 1 FROM user_totp WHERE email = $1 AND enabled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM user_sessions WHERE email = $1 AND revoked_at IS NULL AND expires_at > NOW())
+		FROM user_credentials WHERE email = $1
+	`, email).Scan(&info.Role, &info.HasPassword, &info.EmailVerifiedAt, &info.TwoFactor, &info.ActiveSessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", classify(err))
+	}
+
+	rows, err := DB.QueryContext(ctx, "SELECT provider FROM user_identities WHERE email = $1 ORDER BY provider", email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identities: %w", classify(err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var provider string
+		if err := rows.Scan(&provider); err != nil {
+			return nil, classify(err)
+		}
+		info.Identities = append(info.Identities, provider)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, classify(err)
+	}
+
+	info.APITokens, err = s.ListAPITokens(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// RequestAccountDeletion schedules the deletion of email after grace. A
+// repeated request keeps the original schedule.
+func (s *PostgresStore) RequestAccountDeletion(ctx context.Context, email string, grace time.Duration) (*AccountDeletion, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var d AccountDeletion
+	err := DB.QueryRowContext(ctx, `
+		INSERT INTO account_deletions (email, scheduled_for)
+		VALUES ($1, NOW() + make_interval(secs => $2))
+		ON CONFLICT (email) WHERE completed_at IS NULL DO UPDATE SET email = EXCLUDED.email
+		RETURNING requested_at, scheduled_for, completed_at
+	`, email, grace.Seconds()).Scan(&d.RequestedAt, &d.ScheduledFor, &d.CompletedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to schedule deletion: %w", classify(err))
+	}
+	return &d, nil
+}
+
+// GetAccountDeletion returns the pending deletion of email.
+// It returns ErrNotFound when none is pending.
+func (s *PostgresStore) GetAccountDeletion(ctx context.Context, email string) (*AccountDeletion, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var d AccountDeletion
+	err := DB.QueryRowContext(ctx, `
+		SELECT requested_at, scheduled_for, completed_at FROM account_deletions
+		WHERE email = $1 AND completed_at IS NULL
+	`, email).Scan(&d.RequestedAt, &d.ScheduledFor, &d.CompletedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deletion: %w", classify(err))
+	}
+	return &d, nil
+}
+
+// CancelAccountDeletion withdraws a pending deletion of email.
+// It returns ErrNotFound when none is pending.
+func (s *PostgresStore) CancelAccountDeletion(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, "DELETE FROM account_deletions WHERE email = $1 AND completed_at IS NULL", email)
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %w", classify(err))
+	}
+	if n == 0 {
+		return classify(sql.ErrNoRows)
+	}
+	return nil
+}
+
+// erasedEmail is the pseudonym replacing the email of a deleted account in
+// the records kept after it: its SHA-256 hash. Whoever knows the email can
+// still find them, but they no longer name the user.
+func erasedEmail(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// DeleteAccount removes everything stored about email in one transaction.
+// Tables referencing user_credentials with ON DELETE CASCADE (sessions,
+// tokens, identities, 2FA) go with it. The deletion request is kept as an
+// audit record with the email replaced by erasedEmail. Earlier audit events
+// are kept too, since they record what happened to the account, but the
+// email is pseudonymised in them the same way and the IP of the events the
+// user acted in is cleared.
+func (s *PostgresStore) DeleteAccount(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"DELETE FROM user_details WHERE email = $1",
+		"DELETE FROM login_failures WHERE scope = 'account' AND key = $1",
+		"DELETE FROM lockout_events WHERE email = $1",
+		"DELETE FROM user_credentials WHERE email = $1",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt, email); err != nil {
+			return fmt.Errorf("failed to delete account data: %w", classify(err))
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE account_deletions SET email = $1, completed_at = NOW()
+		WHERE email = $2 AND completed_at IS NULL
+	`, erasedEmail(email), email)
+	if err != nil {
+		return fmt.Errorf("failed to record deletion: %w", classify(err))
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE audit_events SET
+			actor = CASE WHEN actor = $2 THEN $1 ELSE actor END,
+			subject = CASE WHEN subject = $2 THEN $1 ELSE subject END,
+			ip = CASE WHEN actor = $2 THEN '' ELSE ip END
+		WHERE actor = $2 OR subject = $2
+	`, erasedEmail(email), email)
+	if err != nil {
+		return fmt.Errorf("failed to pseudonymise audit events: %w", classify(err))
+	}
+
+	return classify(tx.Commit())
+}
+
+func (s *PostgresStore) ListDueAccountDeletions(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, "SELECT email FROM account_deletions WHERE completed_at IS NULL AND scheduled_for <= NOW()")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due deletions: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var due []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, classify(err)
+		}
+		due = append(due, email)
+	}
+	return due, classify(rows.Err())
+}
+
+// PurgeDueAccountDeletions deletes every account whose grace period ended
+// and returns how many were removed. The profile, meals and message are
+// removed through data, which may be stored apart from Accounts.
+func PurgeDueAccountDeletions(ctx context.Context, data UserRepository) (int, error) {
+	due, err := Accounts.ListDueAccountDeletions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, email := range due {
+		if err := data.DeleteProfile(ctx, email); err != nil {
+			return i, err
+		}
+		if err := Accounts.DeleteAccount(ctx, email); err != nil {
+			return i, err
+		}
+		RecordAudit(ctx, "system", AuditAccountDeleted, erasedEmail(email), "", nil)
+	}
+	return len(due), nil
+}
+
+// StartDeletionJanitor periodically completes account deletions whose grace
+// period has ended.
+func StartDeletionJanitor(interval time.Duration, data UserRepository) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := PurgeDueAccountDeletions(context.Background(), data)
+			if err != nil {
+				log.Printf("❌ Account deletion failed: %v", err)
+			}
+			if n > 0 {
+				log.Printf("🗑️  Deleted %d accounts after their grace period", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,110 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIToken describes a personal API token. The token itself is never stored,
+// only its hash.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// CreateAPIToken stores a new token hash for email and returns its id.
+func (s *PostgresStore) CreateAPIToken(ctx context.Context, email string, name string, tokenHash string, scopes []string) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var id int64
+	err := DB.QueryRowContext(ctx, `
+		INSERT INTO api_tokens (email, name, token_hash, scopes)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, email, name, tokenHash, strings.Join(scopes, ",")).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create API token: %w", classify(err))
+	}
+	return id, nil
+}
+
+// ListAPITokens returns every token of email, newest first.
+func (s *PostgresStore) ListAPITokens(ctx context.Context, email string) ([]APIToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, name, scopes, created_at, last_used_at, revoked_at
+		FROM api_tokens WHERE email = $1 ORDER BY created_at DESC
+	`, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", classify(err))
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+			return nil, classify(err)
+		}
+		t.Scopes = splitScopes(scopes)
+		tokens = append(tokens, t)
+	}
+	return tokens, classify(rows.Err())
+}
+
+// RevokeAPIToken revokes token id of email.
+// It returns ErrNotFound when email owns no active token with that id.
+func (s *PostgresStore) RevokeAPIToken(ctx context.Context, email string, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, "UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND email = $2 AND revoked_at IS NULL", id, email)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", classify(err))
+	}
+	if n == 0 {
+		return classify(sql.ErrNoRows)
+	}
+	return nil
+}
+
+// UseAPIToken resolves an active token hash to its owner and scopes and
+// updates its last-used timestamp. It returns ErrNotFound for unknown or
+// revoked tokens.
+func (s *PostgresStore) UseAPIToken(ctx context.Context, tokenHash string) (string, []string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var email, scopes string
+	err := DB.QueryRowContext(ctx, `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE token_hash = $1 AND revoked_at IS NULL
+		RETURNING email, scopes
+	`, tokenHash).Scan(&email, &scopes)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read API token: %w", classify(err))
+	}
+	return email, splitScopes(scopes), nil
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,145 @@
+package DB
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Audited actions recorded in audit_events
+const (
+	AuditSignup            = "auth.signup"
+	AuditLoginSuccess      = "auth.login.success"
+	AuditLoginFailure      = "auth.login.failure"
+	AuditLoginLocked       = "auth.login.locked"
+	AuditSecondFactorFail  = "auth.2fa.failure"
+	AuditPasswordReset     = "auth.password.reset"
+	AuditAdminViewUsers    = "admin.users.view"
+	AuditAdminViewUser     = "admin.user.view"
+	AuditAdminViewMessages = "admin.messages.view"
+	AuditRoleUpdate        = "admin.role.update"
+	AuditAccountUnlock     = "admin.account.unlock"
+	AuditTwoFactorReset    = "admin.2fa.reset"
+	AuditAdminViewAudit    = "admin.audit.view"
+	AuditDietUpdate        = "diet.update"
+	AuditDietGenerate      = "diet.generate"
+	AuditProfileUpsert     = "profile.upsert"
+	AuditDeletionRequested = "account.deletion.requested"
+	AuditDeletionCancelled = "account.deletion.cancelled"
+	AuditAccountDeleted    = "account.deleted"
+)
+
+// AuditEvent is one row of the append-only audit log. Actor is who acted,
+// Subject the account the action concerned.
+type AuditEvent struct {
+	ID       int64                  `json:"id"`
+	At       time.Time              `json:"at"`
+	Actor    string                 `json:"actor"`
+	Action   string                 `json:"action"`
+	Subject  string                 `json:"subject"`
+	IP       string                 `json:"ip"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// AuditFilter narrows QueryAuditEvents. Empty fields match everything.
+type AuditFilter struct {
+	Actor   string
+	Subject string
+	Action  string
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
+
+// RecordAudit appends an event to the audit log in Accounts. Failures are
+// logged rather than returned so auditing never breaks the action being
+// audited.
+func RecordAudit(ctx context.Context, actor string, action string, subject string, ip string, metadata map[string]interface{}) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	err := Accounts.InsertAuditEvent(ctx, AuditEvent{Actor: actor, Action: action, Subject: subject, IP: ip, Metadata: metadata})
+	if err != nil {
+		log.Printf("❌ Failed to record audit event %s by %s on %s: %v", action, actor, subject, err)
+	}
+}
+
+func (s *PostgresStore) InsertAuditEvent(ctx context.Context, e AuditEvent) error {
+	meta, err := json.Marshal(e.Metadata)
+	if err != nil {
+		log.Printf("❌ Failed to encode audit metadata for %s: %v", e.Action, err)
+		meta = []byte("{}")
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err = DB.ExecContext(ctx, `
+		INSERT INTO audit_events (actor, action, subject, ip, metadata)
+		VALUES ($1, $2, $3, $4, $5)
+	`, e.Actor, e.Action, e.Subject, e.IP, meta)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", classify(err))
+	}
+	return nil
+}
+
+// QueryAuditEvents returns audit events matching filter, newest first, at
+// most filter.Limit (default 100, up to 1000) of them.
+func (s *PostgresStore) QueryAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	query := "SELECT id, at, actor, action, subject, ip, metadata FROM audit_events WHERE TRUE"
+	args := []interface{}{}
+	add := func(clause string, value interface{}) {
+		args = append(args, value)
+		query += " AND " + clause + " $" + strconv.Itoa(len(args))
+	}
+
+	if filter.Actor != "" {
+		add("actor =", filter.Actor)
+	}
+	if filter.Subject != "" {
+		add("subject =", filter.Subject)
+	}
+	if filter.Action != "" {
+		add("action =", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		add("at >=", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("at <", filter.To)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	args = append(args, limit)
+	query += " ORDER BY at DESC, id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", classify(err))
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		var meta []byte
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.Subject, &e.IP, &meta); err != nil {
+			return nil, classify(err)
+		}
+		if err := json.Unmarshal(meta, &e.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode audit metadata: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, classify(rows.Err())
+}
@@ -0,0 +1,60 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Typed errors returned by the repositories. They wrap the driver error, so
+// errors.Is also matches e.g. sql.ErrNoRows.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// classify wraps err with the typed error describing its cause. Errors that
+// match none are returned unchanged.
+func classify(err error) error {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.Is(err, ErrUnavailable) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		// unique_violation, foreign_key_violation
+		case pgErr.Code == "23505" || pgErr.Code == "23503":
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		// query_canceled (statement timeout), too_many_connections,
+		// connection exceptions
+		case pgErr.Code == "57014" || pgErr.Code == "53300" || strings.HasPrefix(pgErr.Code, "08"):
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return err
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, driver.ErrBadConn) || errors.As(err, &connErr) || errors.As(err, &netErr) ||
+		mongo.IsTimeout(err) || mongo.IsNetworkError(err) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Health score sources: calculated from the profile, entered by the user
+// in /form or set by a nutritionist
+const (
+	HealthScoreComputed     = "computed"
+	HealthScoreSelf         = "self"
+	HealthScoreNutritionist = "nutritionist"
+)
+
+// HealthScoreFactor is the contribution of one factor to a computed health
+// score, in points out of 100.
+type HealthScoreFactor struct {
+	Factor string `json:"factor" bson:"factor"`
+	Value  string `json:"value" bson:"value"`
+	Points int    `json:"points" bson:"points"`
+}
+
+// HealthScoreChange is one entry of the health score history. Previous is
+// the score before the change; Breakdown and RuleVersion, the version of
+// the rules that computed it, are only set for computed scores.
+type HealthScoreChange struct {
+	ID          int64               `json:"id"`
+	Score       int                 `json:"score"`
+	Previous    *int                `json:"previous"`
+	Source      string              `json:"source"`
+	Breakdown   []HealthScoreFactor `json:"breakdown"`
+	RuleVersion *string             `json:"rule_version"`
+	RecordedAt  time.Time           `json:"recorded_at"`
+}
+
+// sameHealthScore reports whether change records nothing new after last:
+// the same score, computed by the same rule version from the same factors.
+func sameHealthScore(last HealthScoreChange, change HealthScoreChange) bool {
+	sameVersion := last.RuleVersion == nil && change.RuleVersion == nil ||
+		last.RuleVersion != nil && change.RuleVersion != nil && *last.RuleVersion == *change.RuleVersion
+	return last.Score == change.Score && sameVersion && slices.Equal(last.Breakdown, change.Breakdown)
+}
+
+// RecordHealthScore sets the health score of email to change.Score and
+// appends change to the history unless it matches the last entry, see
+// sameHealthScore. It reports whether a history row was added.
+func RecordHealthScore(ctx context.Context, email string, change HealthScoreChange) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	// Locking the profile serializes concurrent changes of the same user
+	var current int
+	err = tx.QueryRowContext(ctx, "SELECT healthscore FROM user_details WHERE email = $1 FOR UPDATE", email).Scan(&current)
+	if err != nil {
+		return false, fmt.Errorf("failed to read health score: %w", classify(err))
+	}
+
+	var last HealthScoreChange
+	var lastBreakdown []byte
+	err = tx.QueryRowContext(ctx, "SELECT score, breakdown, rule_version FROM health_scores WHERE email = $1 ORDER BY id DESC LIMIT 1", email).
+		Scan(&last.Score, &lastBreakdown, &last.RuleVersion)
+	switch {
+	case err == sql.ErrNoRows:
+		last.Score = current
+	case err != nil:
+		return false, fmt.Errorf("failed to read health score history: %w", classify(err))
+	default:
+		if lastBreakdown != nil {
+			if err := json.Unmarshal(lastBreakdown, &last.Breakdown); err != nil {
+				return false, fmt.Errorf("failed to decode health score breakdown: %w", err)
+			}
+		}
+		if sameHealthScore(last, change) {
+			if current != change.Score {
+				if _, err := tx.ExecContext(ctx, "UPDATE user_details SET healthscore = $1 WHERE email = $2", change.Score, email); err != nil {
+					return false, fmt.Errorf("failed to update health score: %w", classify(err))
+				}
+			}
+			return false, classify(tx.Commit())
+		}
+	}
+
+	var breakdown []byte
+	if change.Breakdown != nil {
+		if breakdown, err = json.Marshal(change.Breakdown); err != nil {
+			return false, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO health_scores (email, score, previous, source, breakdown, rule_version)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, email, change.Score, last.Score, change.Source, breakdown, change.RuleVersion)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert health score: %w", classify(err))
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE user_details SET healthscore = $1 WHERE email = $2", change.Score, email); err != nil {
+		return false, fmt.Errorf("failed to update health score: %w", classify(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit health score: %w", classify(err))
+	}
+	return true, nil
+}
+
+// ListHealthScores returns the health score history of email, oldest first.
+func ListHealthScores(ctx context.Context, email string) ([]HealthScoreChange, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, score, previous, source, breakdown, rule_version, recorded_at FROM health_scores
+		WHERE email = $1
+		ORDER BY id
+	`, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read health scores: %w", classify(err))
+	}
+	defer rows.Close()
+
+	changes := []HealthScoreChange{}
+	for rows.Next() {
+		var h HealthScoreChange
+		var breakdown []byte
+		if err := rows.Scan(&h.ID, &h.Score, &h.Previous, &h.Source, &breakdown, &h.RuleVersion, &h.RecordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan health score: %w", classify(err))
+		}
+		if breakdown != nil {
+			if err := json.Unmarshal(breakdown, &h.Breakdown); err != nil {
+				return nil, fmt.Errorf("failed to decode health score breakdown: %w", err)
+			}
+		}
+		changes = append(changes, h)
+	}
+	return changes, classify(rows.Err())
+}
@@ -0,0 +1,49 @@
+package DB
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecordHealthScore(t *testing.T) {
+	version := func(v string) *string { return &v }
+	factors := []HealthScoreFactor{{Factor: "bmi", Value: "25.0", Points: -5}}
+	first := HealthScoreChange{Score: 7, Source: HealthScoreComputed, Breakdown: factors, RuleVersion: version("v1")}
+
+	tests := []struct {
+		name   string
+		change HealthScoreChange
+		want   bool
+	}{
+		{"same score, version and breakdown", first, false},
+		{"new rule version with the same score", HealthScoreChange{Score: 7, Source: HealthScoreComputed, Breakdown: factors, RuleVersion: version("v2")}, true},
+		{"new breakdown with the same score", HealthScoreChange{Score: 7, Source: HealthScoreComputed, Breakdown: []HealthScoreFactor{{Factor: "bmi", Value: "26.0", Points: -5}}, RuleVersion: version("v1")}, true},
+		{"self-entered with the same score", HealthScoreChange{Score: 7, Source: HealthScoreSelf}, true},
+		{"new score", HealthScoreChange{Score: 8, Source: HealthScoreComputed, Breakdown: factors, RuleVersion: version("v1")}, true},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		store := NewMemoryStore()
+		if err := store.SaveProfile(ctx, &UserProfile{Email: "asha@example.com", Healthscore: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.RecordHealthScore(ctx, "asha@example.com", first); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.RecordHealthScore(ctx, "asha@example.com", tt.change)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got recorded %v, want %v", tt.name, got, tt.want)
+		}
+
+		history, _ := store.ListHealthScores(ctx, "asha@example.com")
+		last := history[len(history)-1]
+		if (last.RuleVersion == nil) != (tt.change.RuleVersion == nil) ||
+			last.RuleVersion != nil && *last.RuleVersion != *tt.change.RuleVersion {
+			t.Errorf("%s: last history entry has rule version %v, want %v", tt.name, last.RuleVersion, tt.change.RuleVersion)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+)
+
+// GetIdentityEmail returns the email linked to an external identity.
+// It returns ErrNotFound when the identity has not been linked yet.
+func (s *PostgresStore) GetIdentityEmail(ctx context.Context, provider string, subject string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var email string
+	err := DB.QueryRowContext(ctx, "SELECT email FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject).Scan(&email)
+	if err != nil {
+		return "", fmt.Errorf("failed to read identity: %w", classify(err))
+	}
+	return email, nil
+}
+
+// LinkIdentity links an external identity to email, creating a password-less,
+// already verified user_credentials row first when the user does not exist
+// yet. All writes happen in one transaction so a failed link never leaves an
+// orphan account.
+//
+// The provider has verified that the caller owns email. An existing account
+// that never verified it may have been registered by someone else ahead of
+// the owner, so it is reclaimed: its password, sessions, API tokens, pending
+// tokens and two-factor setup are dropped and reclaimed is true.
+func (s *PostgresStore) LinkIdentity(ctx context.Context, provider string, subject string, email string) (reclaimed bool, err error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	// An empty password hash never matches in bcrypt, so the account can
+	// only be used through the external provider until a password is set
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_credentials (email, password, email_verified_at)
+		VALUES ($1, '', NOW())
+		ON CONFLICT (email) DO NOTHING
+	`, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to create user credentials: %w", classify(err))
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE user_credentials SET password = '', email_verified_at = NOW()
+		WHERE email = $1 AND email_verified_at IS NULL
+	`, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to reclaim unverified account: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to reclaim unverified account: %w", classify(err))
+	}
+	if n > 0 {
+		reclaimed = true
+		for _, query := range []string{
+			"UPDATE user_sessions SET revoked_at = NOW() WHERE email = $1 AND revoked_at IS NULL",
+			"UPDATE api_tokens SET revoked_at = NOW() WHERE email = $1 AND revoked_at IS NULL",
+			"UPDATE user_tokens SET used_at = NOW() WHERE email = $1 AND used_at IS NULL",
+			"DELETE FROM user_recovery_codes WHERE email = $1",
+			"DELETE FROM user_totp WHERE email = $1",
+		} {
+			if _, err := tx.ExecContext(ctx, query, email); err != nil {
+				return false, fmt.Errorf("failed to reclaim unverified account: %w", classify(err))
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_identities (provider, subject, email)
+		VALUES ($1, $2, $3)
+	`, provider, subject, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to link identity: %w", classify(err))
+	}
+
+	return reclaimed, classify(tx.Commit())
+}
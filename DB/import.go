@@ -0,0 +1,50 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+)
+
+// ImportCredential inserts an already hashed password for email unless the
+// user exists. It reports whether a row was inserted and, when not, the hash
+// currently stored so callers can tell re-imports from conflicts.
+func (s *PostgresStore) ImportCredential(ctx context.Context, email string, passwordHash string) (bool, string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, `
+		INSERT INTO user_credentials (email, password)
+		VALUES ($1, $2)
+		ON CONFLICT (email) DO NOTHING
+	`, email, passwordHash)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to import credentials: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to import credentials: %w", classify(err))
+	}
+	if n == 1 {
+		return true, "", nil
+	}
+
+	existing, err := s.GetPasswordHash(ctx, email)
+	if err != nil {
+		return false, "", err
+	}
+	return false, existing, nil
+}
+
+// GetPasswordHash returns the stored password hash of email.
+// It returns ErrNotFound when no credentials exist for email.
+func (s *PostgresStore) GetPasswordHash(ctx context.Context, email string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var hash string
+	err := DB.QueryRowContext(ctx, "SELECT password FROM user_credentials WHERE email = $1", email).Scan(&hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials: %w", classify(err))
+	}
+	return hash, nil
+}
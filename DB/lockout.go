@@ -0,0 +1,204 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Scopes of failed-login counters in login_failures
+const (
+	LockoutScopeAccount = "account"
+	LockoutScopeIP      = "ip"
+)
+
+// LockoutEvent is a recorded lockout of an account or IP address
+type LockoutEvent struct {
+	ID          int64      `json:"id"`
+	Email       string     `json:"email"`
+	IP          string     `json:"ip"`
+	Scope       string     `json:"scope"`
+	Failures    int        `json:"failures"`
+	LockedUntil time.Time  `json:"locked_until"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UnlockedBy  *string    `json:"unlocked_by"`
+	UnlockedAt  *time.Time `json:"unlocked_at"`
+}
+
+// LoginCount is the failure counter of a key after a login attempt was
+// counted against it
+type LoginCount struct {
+	Failures int
+	// LockedUntil is when the lock on the key ends, if it is locked
+	LockedUntil time.Time
+	// Refused is set when the key was already locked, in which case the
+	// attempt was not counted
+	Refused bool
+}
+
+// CountLoginAttempt counts a login attempt against key before its password
+// is checked, under a row lock so parallel attempts are counted one at a
+// time and can't all slip under the threshold. lockout returns how long the
+// new count locks key for, or 0; the counted attempt itself goes ahead.
+// Counters whose last failure is older than window start over.
+func (s *PostgresStore) CountLoginAttempt(ctx context.Context, scope string, key string, window time.Duration, lockout func(failures int) time.Duration) (LoginCount, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return LoginCount{}, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO login_failures (scope, key, failures, last_failure_at)
+		VALUES ($1, $2, 0, NOW())
+		ON CONFLICT (scope, key) DO NOTHING
+	`, scope, key)
+	if err != nil {
+		return LoginCount{}, fmt.Errorf("failed to record login attempt: %w", classify(err))
+	}
+
+	var count LoginCount
+	var lockedUntil sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			CASE WHEN last_failure_at < NOW() - make_interval(secs => $3) THEN 0 ELSE failures END,
+			locked_until > NOW(), locked_until
+		FROM login_failures
+		WHERE scope = $1 AND key = $2
+		FOR UPDATE
+	`, scope, key, window.Seconds()).Scan(&count.Failures, &count.Refused, &lockedUntil)
+	if err != nil {
+		return LoginCount{}, fmt.Errorf("failed to read login failures: %w", classify(err))
+	}
+	if count.Refused {
+		count.LockedUntil = lockedUntil.Time
+		return count, classify(tx.Commit())
+	}
+
+	count.Failures++
+	lockedUntil = sql.NullTime{}
+	err = tx.QueryRowContext(ctx, `
+		UPDATE login_failures SET
+			failures = $3,
+			last_failure_at = NOW(),
+			locked_until = CASE WHEN $4::float8 > 0 THEN NOW() + make_interval(secs => $4::float8) END
+		WHERE scope = $1 AND key = $2
+		RETURNING locked_until
+	`, scope, key, count.Failures, lockout(count.Failures).Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		return LoginCount{}, fmt.Errorf("failed to record login attempt: %w", classify(err))
+	}
+	count.LockedUntil = lockedUntil.Time
+	return count, classify(tx.Commit())
+}
+
+// ReleaseLoginAttempt takes back an attempt counted by CountLoginAttempt
+// that turned out not to fail, lifting the lock it placed, if any.
+func (s *PostgresStore) ReleaseLoginAttempt(ctx context.Context, scope string, key string, count LoginCount) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	lockedUntil := sql.NullTime{Time: count.LockedUntil, Valid: !count.LockedUntil.IsZero()}
+	_, err := DB.ExecContext(ctx, `
+		UPDATE login_failures SET
+			failures = GREATEST(failures - 1, 0),
+			locked_until = CASE WHEN locked_until = $3 THEN NULL ELSE locked_until END
+		WHERE scope = $1 AND key = $2
+	`, scope, key, lockedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to release login attempt: %w", classify(err))
+	}
+	return nil
+}
+
+// RecordLockout records a lockout event for a key locked by a failed login.
+func (s *PostgresStore) RecordLockout(ctx context.Context, scope string, email string, ip string, failures int, lockedUntil time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, `
+		INSERT INTO lockout_events (email, ip, scope, failures, locked_until)
+		VALUES ($1, $2, $3, $4, $5)
+	`, email, ip, scope, failures, lockedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to record lockout: %w", classify(err))
+	}
+	return nil
+}
+
+// ClearLoginFailures resets the failure counter for key.
+func (s *PostgresStore) ClearLoginFailures(ctx context.Context, scope string, key string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "DELETE FROM login_failures WHERE scope = $1 AND key = $2", scope, key)
+	if err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", classify(err))
+	}
+	return nil
+}
+
+// UnlockAccount clears the lock on email and marks its open lockout events
+// as unlocked by admin.
+func (s *PostgresStore) UnlockAccount(ctx context.Context, email string, admin string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM login_failures WHERE scope = $1 AND key = $2", LockoutScopeAccount, email)
+	if err != nil {
+		return fmt.Errorf("failed to clear lock: %w", classify(err))
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE lockout_events SET unlocked_by = $1, unlocked_at = NOW()
+		WHERE email = $2 AND scope = $3 AND unlocked_at IS NULL
+	`, admin, email, LockoutScopeAccount)
+	if err != nil {
+		return fmt.Errorf("failed to update lockout events: %w", classify(err))
+	}
+
+	return classify(tx.Commit())
+}
+
+// ListLockoutEvents returns the most recent lockout events, newest first.
+// When activeOnly is set only locks that have not ended or been lifted are
+// returned.
+func (s *PostgresStore) ListLockoutEvents(ctx context.Context, activeOnly bool, limit int) ([]LockoutEvent, error) {
+	query := `
+		SELECT id, email, ip, scope, failures, locked_until, created_at, unlocked_by, unlocked_at
+		FROM lockout_events`
+	if activeOnly {
+		query += " WHERE locked_until > NOW() AND unlocked_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC LIMIT $1"
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lockout events: %w", classify(err))
+	}
+	defer rows.Close()
+
+	events := []LockoutEvent{}
+	for rows.Next() {
+		var e LockoutEvent
+		err := rows.Scan(&e.ID, &e.Email, &e.IP, &e.Scope, &e.Failures, &e.LockedUntil, &e.CreatedAt, &e.UnlockedBy, &e.UnlockedAt)
+		if err != nil {
+			return nil, classify(err)
+		}
+		events = append(events, e)
+	}
+	return events, classify(rows.Err())
+}
@@ -0,0 +1,214 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Meal types stored in meal_items.meal_type
+const (
+	MealBreakfast = "breakfast"
+	MealLunch     = "lunch"
+	MealDinner    = "dinner"
+)
+
+// Meal item sources: typed by the user or analysed from a photo
+const (
+	MealSourceText  = "text"
+	MealSourceImage = "image"
+)
+
+// MealTypes lists the meal types in the order they are eaten.
+var MealTypes = []string{MealBreakfast, MealLunch, MealDinner}
+
+// MealEntry is one tracked day: the meals eaten and the weight measured.
+type MealEntry struct {
+	ID     int64      `json:"id"`
+	Date   *time.Time `json:"date"`
+	Weight *float64   `json:"weight"`
+	Items  []MealItem `json:"items"`
+}
+
+// MealItem is a single food of a meal. Typed meals are stored as one item
+// without calories; analysed photos also estimate the portion and nutrients.
+type MealItem struct {
+	MealType     string     `json:"meal_type" bson:"meal_type"`
+	Food         string     `json:"food" bson:"food"`
+	Calories     *int       `json:"calories" bson:"calories"`
+	Source       string     `json:"source" bson:"source"`
+	Portion      *string    `json:"portion,omitempty" bson:"portion,omitempty"`
+	PortionGrams *float64   `json:"portion_grams,omitempty" bson:"portion_grams,omitempty"`
+	Nutrients    *Nutrients `json:"nutrients,omitempty" bson:"nutrients,omitempty"`
+	// Provider is the AI provider that analysed the photo
+	Provider *string `json:"provider,omitempty" bson:"provider,omitempty"`
+}
+
+// Nutrients of a meal item's portion. Masses are in grams, sodium in
+// milligrams.
+type Nutrients struct {
+	Protein float64 `json:"protein_g" bson:"protein_g"`
+	Carbs   float64 `json:"carbs_g" bson:"carbs_g"`
+	Fat     float64 `json:"fat_g" bson:"fat_g"`
+	Fibre   float64 `json:"fibre_g" bson:"fibre_g"`
+	Sugar   float64 `json:"sugar_g" bson:"sugar_g"`
+	Sodium  float64 `json:"sodium_mg" bson:"sodium_mg"`
+}
+
+// Add returns the sum of n and o.
+func (n Nutrients) Add(o Nutrients) Nutrients {
+	return Nutrients{
+		Protein: n.Protein + o.Protein,
+		Carbs:   n.Carbs + o.Carbs,
+		Fat:     n.Fat + o.Fat,
+		Fibre:   n.Fibre + o.Fibre,
+		Sugar:   n.Sugar + o.Sugar,
+		Sodium:  n.Sodium + o.Sodium,
+	}
+}
+
+// AddMealEntry stores entry and its items for email in one transaction and
+// returns the new entry id.
+func AddMealEntry(ctx context.Context, email string, entry MealEntry) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO meal_entries (email, entry_date, weight)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, email, entry.Date, entry.Weight).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert meal entry: %w", classify(err))
+	}
+
+	for _, item := range entry.Items {
+		var protein, carbs, fat, fibre, sugar, sodium *float64
+		if n := item.Nutrients; n != nil {
+			protein, carbs, fat, fibre, sugar, sodium = &n.Protein, &n.Carbs, &n.Fat, &n.Fibre, &n.Sugar, &n.Sodium
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO meal_items (entry_id, meal_type, food, calories, source, portion, portion_grams,
+				protein_g, carbs_g, fat_g, fibre_g, sugar_g, sodium_mg, provider)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		`, id, item.MealType, item.Food, item.Calories, item.Source, item.Portion, item.PortionGrams,
+			protein, carbs, fat, fibre, sugar, sodium, item.Provider)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert meal item: %w", classify(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit meal entry: %w", classify(err))
+	}
+	return id, nil
+}
+
+// ListMealEntries returns the meal entries of email in the order they were
+// tracked.
+func ListMealEntries(ctx context.Context, email string) ([]MealEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT e.id, e.entry_date, e.weight, i.meal_type, i.food, i.calories, i.source,
+			i.portion, i.portion_grams, i.protein_g, i.carbs_g, i.fat_g, i.fibre_g, i.sugar_g, i.sodium_mg, i.provider
+		FROM meal_entries e
+		LEFT JOIN meal_items i ON i.entry_id = e.id
+		WHERE e.email = $1
+		ORDER BY e.id, i.id
+	`, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read meal entries: %w", classify(err))
+	}
+	defer rows.Close()
+
+	entries := []MealEntry{}
+	for rows.Next() {
+		var e MealEntry
+		var mealType, food, source, portion, provider *string
+		var calories *int
+		var portionGrams, protein, carbs, fat, fibre, sugar, sodium *float64
+		if err := rows.Scan(&e.ID, &e.Date, &e.Weight, &mealType, &food, &calories, &source,
+			&portion, &portionGrams, &protein, &carbs, &fat, &fibre, &sugar, &sodium, &provider); err != nil {
+			return nil, fmt.Errorf("failed to scan meal entry: %w", classify(err))
+		}
+
+		if len(entries) == 0 || entries[len(entries)-1].ID != e.ID {
+			e.Items = []MealItem{}
+			entries = append(entries, e)
+		}
+		if mealType != nil {
+			item := MealItem{MealType: *mealType, Food: *food, Calories: calories, Source: *source, Portion: portion, PortionGrams: portionGrams, Provider: provider}
+			// meal_items_nutrients_check keeps the nutrients all set or all null
+			if protein != nil {
+				item.Nutrients = &Nutrients{Protein: *protein, Carbs: *carbs, Fat: *fat, Fibre: *fibre, Sugar: *sugar, Sodium: *sodium}
+			}
+			last := &entries[len(entries)-1]
+			last.Items = append(last.Items, item)
+		}
+	}
+	return entries, classify(rows.Err())
+}
+
+// TrackRecords converts entries to the legacy track JSON array: one object
+// per entry with date, weight and every meal as either the typed text or a
+// food → calories map with "Total calories".
+func TrackRecords(entries []MealEntry) []map[string]interface{} {
+	track := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		track = append(track, e.TrackRecord())
+	}
+	return track
+}
+
+// TrackRecord converts e to the legacy track JSON object.
+func (e MealEntry) TrackRecord() map[string]interface{} {
+	record := map[string]interface{}{"date": "", "weight": ""}
+	if e.Date != nil {
+		record["date"] = e.Date.Format("2006-01-02")
+	}
+	if e.Weight != nil {
+		record["weight"] = strconv.FormatFloat(*e.Weight, 'f', -1, 64)
+	}
+
+	for _, mealType := range MealTypes {
+		var text string
+		foods := map[string]interface{}{}
+		total := 0
+		for _, item := range e.Items {
+			if item.MealType != mealType {
+				continue
+			}
+			if item.Source == MealSourceText {
+				if text != "" {
+					text += ", "
+				}
+				text += item.Food
+				continue
+			}
+			if item.Calories != nil {
+				foods[item.Food] = *item.Calories
+				total += *item.Calories
+			} else {
+				foods[item.Food] = nil
+			}
+		}
+
+		if len(foods) > 0 {
+			foods["Total calories"] = total
+			record[mealType] = foods
+		} else if text != "" {
+			record[mealType] = text
+		}
+	}
+	return record
+}
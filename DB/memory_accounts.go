@@ -0,0 +1,793 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// memoryAccounts holds the account data of a MemoryStore, guarded by its
+// mutex.
+type memoryAccounts struct {
+	credentials   map[string]*memoryCredentials
+	sessions      map[string]*memorySession
+	apiTokens     []*memoryAPIToken
+	userTokens    map[string]*memoryUserToken
+	totp          map[string]*TOTPSecret
+	recoveryCodes map[string]map[string]bool
+	identities    map[[2]string]string
+	loginFailures map[string]*memoryLoginFailure
+	lockouts      []LockoutEvent
+	deletions     map[string]*AccountDeletion
+	audit         []AuditEvent
+	nextTokenID   int64
+	nextLockoutID int64
+	nextAuditID   int64
+}
+
+type memoryCredentials struct {
+	password   string
+	role       string
+	verifiedAt *time.Time
+	onboarded  bool
+}
+
+type memorySession struct {
+	email     string
+	expiresAt time.Time
+	revokedAt *time.Time
+}
+
+type memoryAPIToken struct {
+	APIToken
+	email string
+	hash  string
+}
+
+type memoryUserToken struct {
+	email     string
+	purpose   string
+	expiresAt time.Time
+	used      bool
+}
+
+type memoryLoginFailure struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+func newMemoryAccounts() memoryAccounts {
+	return memoryAccounts{
+		credentials:   map[string]*memoryCredentials{},
+		sessions:      map[string]*memorySession{},
+		userTokens:    map[string]*memoryUserToken{},
+		totp:          map[string]*TOTPSecret{},
+		recoveryCodes: map[string]map[string]bool{},
+		identities:    map[[2]string]string{},
+		loginFailures: map[string]*memoryLoginFailure{},
+		deletions:     map[string]*AccountDeletion{},
+	}
+}
+
+func (s *MemoryStore) CreateCredentials(ctx context.Context, email string, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.credentials[email]; ok {
+		return fmt.Errorf("failed to insert user credentials: %w: %s already exists", ErrConflict, email)
+	}
+	s.credentials[email] = &memoryCredentials{password: passwordHash, role: defaultRole}
+	return nil
+}
+
+func (s *MemoryStore) GetPasswordHash(ctx context.Context, email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[email]
+	if !ok {
+		return "", classify(sql.ErrNoRows)
+	}
+	return c.password, nil
+}
+
+func (s *MemoryStore) CredentialsExist(ctx context.Context, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.credentials[email]
+	return ok, nil
+}
+
+func (s *MemoryStore) IsOnboarded(ctx context.Context, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[email]
+	if !ok {
+		return false, classify(sql.ErrNoRows)
+	}
+	return c.onboarded, nil
+}
+
+func (s *MemoryStore) MarkOnboarded(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.credentials[email]; ok {
+		c.onboarded = true
+	}
+	return nil
+}
+
+func (s *MemoryStore) ImportCredential(ctx context.Context, email string, passwordHash string) (bool, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.credentials[email]; ok {
+		return false, c.password, nil
+	}
+	s.credentials[email] = &memoryCredentials{password: passwordHash, role: defaultRole}
+	return true, "", nil
+}
+
+func (s *MemoryStore) CreateSession(ctx context.Context, tokenHash string, email string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[tokenHash]; ok {
+		return fmt.Errorf("failed to create session: %w: duplicate token", ErrConflict)
+	}
+	s.sessions[tokenHash] = &memorySession{email: email, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStore) GetSessionEmail(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[tokenHash]
+	if !ok || session.revokedAt != nil || !session.expiresAt.After(time.Now()) {
+		return "", classify(sql.ErrNoRows)
+	}
+	return session.email, nil
+}
+
+func (s *MemoryStore) RevokeSession(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[tokenHash]; ok && session.revokedAt == nil {
+		now := time.Now()
+		session.revokedAt = &now
+	}
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserSessions(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeUserSessions(email)
+	return nil
+}
+
+func (s *MemoryStore) revokeUserSessions(email string) {
+	now := time.Now()
+	for _, session := range s.sessions {
+		if session.email == email && session.revokedAt == nil {
+			session.revokedAt = &now
+		}
+	}
+}
+
+func (s *MemoryStore) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	var n int64
+	for hash, session := range s.sessions {
+		if session.expiresAt.Before(dayAgo) || (session.revokedAt != nil && session.revokedAt.Before(dayAgo)) {
+			delete(s.sessions, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) GetUserRole(ctx context.Context, email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[email]
+	if !ok {
+		return "", classify(sql.ErrNoRows)
+	}
+	return c.role, nil
+}
+
+func (s *MemoryStore) SetUserRole(ctx context.Context, email string, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[email]
+	if !ok {
+		return classify(sql.ErrNoRows)
+	}
+	c.role = role
+	return nil
+}
+
+func (s *MemoryStore) ListUsersByRole(ctx context.Context, role string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	emails := []string{}
+	for email, c := range s.credentials {
+		if c.role == role {
+			emails = append(emails, email)
+		}
+	}
+	sort.Strings(emails)
+	return emails, nil
+}
+
+func (s *MemoryStore) CreateAPIToken(ctx context.Context, email string, name string, tokenHash string, scopes []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.apiTokens {
+		if t.hash == tokenHash {
+			return 0, fmt.Errorf("failed to create API token: %w: duplicate token", ErrConflict)
+		}
+	}
+	s.nextTokenID++
+	s.apiTokens = append(s.apiTokens, &memoryAPIToken{
+		APIToken: APIToken{ID: s.nextTokenID, Name: name, Scopes: append([]string{}, scopes...), CreatedAt: time.Now()},
+		email:    email,
+		hash:     tokenHash,
+	})
+	return s.nextTokenID, nil
+}
+
+func (s *MemoryStore) ListAPITokens(ctx context.Context, email string) ([]APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listAPITokens(email), nil
+}
+
+// listAPITokens returns the tokens of email, newest first.
+func (s *MemoryStore) listAPITokens(email string) []APIToken {
+	tokens := []APIToken{}
+	for i := len(s.apiTokens) - 1; i >= 0; i-- {
+		if t := s.apiTokens[i]; t.email == email {
+			token := t.APIToken
+			token.Scopes = append([]string{}, t.Scopes...)
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func (s *MemoryStore) RevokeAPIToken(ctx context.Context, email string, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.apiTokens {
+		if t.ID == id && t.email == email && t.RevokedAt == nil {
+			now := time.Now()
+			t.RevokedAt = &now
+			return nil
+		}
+	}
+	return classify(sql.ErrNoRows)
+}
+
+func (s *MemoryStore) UseAPIToken(ctx context.Context, tokenHash string) (string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.apiTokens {
+		if t.hash == tokenHash && t.RevokedAt == nil {
+			now := time.Now()
+			t.LastUsedAt = &now
+			return t.email, append([]string{}, t.Scopes...), nil
+		}
+	}
+	return "", nil, classify(sql.ErrNoRows)
+}
+
+func (s *MemoryStore) CreateUserToken(ctx context.Context, tokenHash string, email string, purpose string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.userTokens {
+		if t.email == email && t.purpose == purpose {
+			t.used = true
+		}
+	}
+	s.userTokens[tokenHash] = &memoryUserToken{email: email, purpose: purpose, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStore) ConsumeUserToken(ctx context.Context, tokenHash string, purpose string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.consumeUserToken(tokenHash, purpose)
+}
+
+func (s *MemoryStore) consumeUserToken(tokenHash string, purpose string) (string, error) {
+	t, ok := s.userTokens[tokenHash]
+	if !ok || t.purpose != purpose || t.used || !t.expiresAt.After(time.Now()) {
+		return "", classify(sql.ErrNoRows)
+	}
+	t.used = true
+	return t.email, nil
+}
+
+func (s *MemoryStore) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email, err := s.consumeUserToken(tokenHash, TokenPasswordReset)
+	if err != nil {
+		return "", err
+	}
+	if c, ok := s.credentials[email]; ok {
+		c.password = passwordHash
+	}
+	s.revokeUserSessions(email)
+	delete(s.loginFailures, LockoutScopeAccount+":"+email)
+	return email, nil
+}
+
+func (s *MemoryStore) SetEmailVerified(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.credentials[email]; ok && c.verifiedAt == nil {
+		now := time.Now()
+		c.verifiedAt = &now
+	}
+	return nil
+}
+
+func (s *MemoryStore) IsEmailVerified(ctx context.Context, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[email]
+	if !ok {
+		return false, classify(sql.ErrNoRows)
+	}
+	return c.verifiedAt != nil, nil
+}
+
+func (s *MemoryStore) SaveTOTPSecret(ctx context.Context, email string, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.totp[email]; ok && t.Enabled {
+		return ErrTwoFactorEnabled
+	}
+	s.totp[email] = &TOTPSecret{Secret: secret}
+	return nil
+}
+
+func (s *MemoryStore) GetTOTPSecret(ctx context.Context, email string) (*TOTPSecret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[email]
+	if !ok {
+		return nil, classify(sql.ErrNoRows)
+	}
+	secret := *t
+	return &secret, nil
+}
+
+func (s *MemoryStore) IsTOTPEnabled(ctx context.Context, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[email]
+	return ok && t.Enabled, nil
+}
+
+func (s *MemoryStore) UseTOTPStep(ctx context.Context, email string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[email]
+	if !ok || t.LastUsedStep >= step {
+		return false, nil
+	}
+	t.LastUsedStep = step
+	return true, nil
+}
+
+func (s *MemoryStore) EnableTOTP(ctx context.Context, email string, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.totp[email]; ok {
+		t.Enabled = true
+	}
+	codes := map[string]bool{}
+	for _, h := range codeHashes {
+		codes[h] = false
+	}
+	s.recoveryCodes[email] = codes
+	return nil
+}
+
+func (s *MemoryStore) UseRecoveryCode(ctx context.Context, email string, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used, ok := s.recoveryCodes[email][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	s.recoveryCodes[email][codeHash] = true
+	return true, nil
+}
+
+func (s *MemoryStore) CountRecoveryCodes(ctx context.Context, email string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, used := range s.recoveryCodes[email] {
+		if !used {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) DeleteTOTP(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totp, email)
+	delete(s.recoveryCodes, email)
+	return nil
+}
+
+func (s *MemoryStore) GetIdentityEmail(ctx context.Context, provider string, subject string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email, ok := s.identities[[2]string{provider, subject}]
+	if !ok {
+		return "", classify(sql.ErrNoRows)
+	}
+	return email, nil
+}
+
+func (s *MemoryStore) LinkIdentity(ctx context.Context, provider string, subject string, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]string{provider, subject}
+	if _, ok := s.identities[key]; ok {
+		return false, fmt.Errorf("failed to link identity: %w: already linked", ErrConflict)
+	}
+
+	now := time.Now()
+	reclaimed := false
+	c, ok := s.credentials[email]
+	switch {
+	case !ok:
+		s.credentials[email] = &memoryCredentials{role: defaultRole, verifiedAt: &now}
+	case c.verifiedAt == nil:
+		// Someone else may have registered the email, see the Postgres version
+		reclaimed = true
+		c.password, c.verifiedAt = "", &now
+		s.revokeUserSessions(email)
+		for _, t := range s.apiTokens {
+			if t.email == email && t.RevokedAt == nil {
+				t.RevokedAt = &now
+			}
+		}
+		for _, t := range s.userTokens {
+			if t.email == email {
+				t.used = true
+			}
+		}
+		delete(s.totp, email)
+		delete(s.recoveryCodes, email)
+	}
+	s.identities[key] = email
+	return reclaimed, nil
+}
+
+// CountLoginAttempt counts under the store mutex, which serialises parallel
+// attempts like the row lock in Postgres.
+func (s *MemoryStore) CountLoginAttempt(ctx context.Context, scope string, key string, window time.Duration, lockout func(failures int) time.Duration) (LoginCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	f, ok := s.loginFailures[scope+":"+key]
+	if !ok {
+		f = &memoryLoginFailure{lastFailureAt: now}
+		s.loginFailures[scope+":"+key] = f
+	}
+
+	failures := f.failures
+	if f.lastFailureAt.Before(now.Add(-window)) {
+		failures = 0
+	}
+	if f.lockedUntil.After(now) {
+		return LoginCount{Failures: failures, LockedUntil: f.lockedUntil, Refused: true}, nil
+	}
+
+	f.failures = failures + 1
+	f.lastFailureAt = now
+	f.lockedUntil = time.Time{}
+	if d := lockout(f.failures); d > 0 {
+		f.lockedUntil = now.Add(d)
+	}
+	return LoginCount{Failures: f.failures, LockedUntil: f.lockedUntil}, nil
+}
+
+func (s *MemoryStore) ReleaseLoginAttempt(ctx context.Context, scope string, key string, count LoginCount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.loginFailures[scope+":"+key]
+	if !ok {
+		return nil
+	}
+	if f.failures > 0 {
+		f.failures--
+	}
+	if !count.LockedUntil.IsZero() && f.lockedUntil.Equal(count.LockedUntil) {
+		f.lockedUntil = time.Time{}
+	}
+	return nil
+}
+
+func (s *MemoryStore) RecordLockout(ctx context.Context, scope string, email string, ip string, failures int, lockedUntil time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextLockoutID++
+	s.lockouts = append(s.lockouts, LockoutEvent{
+		ID:          s.nextLockoutID,
+		Email:       email,
+		IP:          ip,
+		Scope:       scope,
+		Failures:    failures,
+		LockedUntil: lockedUntil,
+		CreatedAt:   time.Now(),
+	})
+	return nil
+}
+
+func (s *MemoryStore) ClearLoginFailures(ctx context.Context, scope string, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginFailures, scope+":"+key)
+	return nil
+}
+
+func (s *MemoryStore) UnlockAccount(ctx context.Context, email string, admin string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginFailures, LockoutScopeAccount+":"+email)
+	now := time.Now()
+	for i := range s.lockouts {
+		e := &s.lockouts[i]
+		if e.Email == email && e.Scope == LockoutScopeAccount && e.UnlockedAt == nil {
+			e.UnlockedBy, e.UnlockedAt = &admin, &now
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListLockoutEvents(ctx context.Context, activeOnly bool, limit int) ([]LockoutEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	events := []LockoutEvent{}
+	for i := len(s.lockouts) - 1; i >= 0 && len(events) < limit; i-- {
+		e := s.lockouts[i]
+		if activeOnly && (!e.LockedUntil.After(now) || e.UnlockedAt != nil) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (s *MemoryStore) InsertAuditEvent(ctx context.Context, e AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextAuditID++
+	e.ID = s.nextAuditID
+	e.At = time.Now()
+	metadata := map[string]interface{}{}
+	for k, v := range e.Metadata {
+		metadata[k] = v
+	}
+	e.Metadata = metadata
+	s.audit = append(s.audit, e)
+	return nil
+}
+
+func (s *MemoryStore) QueryAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	events := []AuditEvent{}
+	for i := len(s.audit) - 1; i >= 0 && len(events) < limit; i-- {
+		e := s.audit[i]
+		if (filter.Actor != "" && e.Actor != filter.Actor) ||
+			(filter.Subject != "" && e.Subject != filter.Subject) ||
+			(filter.Action != "" && e.Action != filter.Action) ||
+			(!filter.From.IsZero() && e.At.Before(filter.From)) ||
+			(!filter.To.IsZero() && !e.At.Before(filter.To)) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (s *MemoryStore) ReadCredentialsInfo(ctx context.Context, email string) (*CredentialsInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[email]
+	if !ok {
+		return nil, classify(sql.ErrNoRows)
+	}
+	info := &CredentialsInfo{
+		Email:           email,
+		Role:            c.role,
+		HasPassword:     c.password != "",
+		EmailVerifiedAt: c.verifiedAt,
+		Identities:      []string{},
+		APITokens:       s.listAPITokens(email),
+	}
+	if t, ok := s.totp[email]; ok {
+		info.TwoFactor = t.Enabled
+	}
+	now := time.Now()
+	for _, session := range s.sessions {
+		if session.email == email && session.revokedAt == nil && session.expiresAt.After(now) {
+			info.ActiveSessions++
+		}
+	}
+	for key, linked := range s.identities {
+		if linked == email {
+			info.Identities = append(info.Identities, key[0])
+		}
+	}
+	sort.Strings(info.Identities)
+	return info, nil
+}
+
+func (s *MemoryStore) RequestAccountDeletion(ctx context.Context, email string, grace time.Duration) (*AccountDeletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deletions[email]
+	if !ok {
+		now := time.Now()
+		d = &AccountDeletion{RequestedAt: now, ScheduledFor: now.Add(grace)}
+		s.deletions[email] = d
+	}
+	deletion := *d
+	return &deletion, nil
+}
+
+func (s *MemoryStore) GetAccountDeletion(ctx context.Context, email string) (*AccountDeletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deletions[email]
+	if !ok {
+		return nil, classify(sql.ErrNoRows)
+	}
+	deletion := *d
+	return &deletion, nil
+}
+
+func (s *MemoryStore) CancelAccountDeletion(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deletions[email]; !ok {
+		return classify(sql.ErrNoRows)
+	}
+	delete(s.deletions, email)
+	return nil
+}
+
+func (s *MemoryStore) ListDueAccountDeletions(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	due := []string{}
+	for email, d := range s.deletions {
+		if !d.ScheduledFor.After(now) {
+			due = append(due, email)
+		}
+	}
+	sort.Strings(due)
+	return due, nil
+}
+
+// DeleteAccount forgets the account, its pending deletion and everything
+// attached to it, and pseudonymises its audit events like Postgres does.
+func (s *MemoryStore) DeleteAccount(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.credentials, email)
+	for hash, session := range s.sessions {
+		if session.email == email {
+			delete(s.sessions, hash)
+		}
+	}
+	tokens := s.apiTokens[:0]
+	for _, t := range s.apiTokens {
+		if t.email != email {
+			tokens = append(tokens, t)
+		}
+	}
+	s.apiTokens = tokens
+	for hash, t := range s.userTokens {
+		if t.email == email {
+			delete(s.userTokens, hash)
+		}
+	}
+	for key, linked := range s.identities {
+		if linked == email {
+			delete(s.identities, key)
+		}
+	}
+	delete(s.totp, email)
+	delete(s.recoveryCodes, email)
+	delete(s.loginFailures, LockoutScopeAccount+":"+email)
+	lockouts := s.lockouts[:0]
+	for _, e := range s.lockouts {
+		if e.Email != email {
+			lockouts = append(lockouts, e)
+		}
+	}
+	s.lockouts = lockouts
+	delete(s.deletions, email)
+
+	erased := erasedEmail(email)
+	for i := range s.audit {
+		e := &s.audit[i]
+		if e.Actor == email {
+			e.Actor, e.IP = erased, ""
+		}
+		if e.Subject == email {
+			e.Subject = erased
+		}
+	}
+	return nil
+}
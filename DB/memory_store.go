@@ -0,0 +1,234 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements the repositories in process memory. It mirrors the
+// behavior of PostgresStore, including updates of a missing profile being a
+// no-op, and backs the handler tests and DATA_BACKEND=memory demos.
+type MemoryStore struct {
+	mu           sync.Mutex
+	profiles     map[string]UserProfile
+	meals        map[string][]MealEntry
+	weights      map[string][]WeightEntry
+	scores       map[string][]HealthScoreChange
+	nextMealID   int64
+	nextWeightID int64
+	nextScoreID  int64
+	memoryAccounts
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		profiles:       map[string]UserProfile{},
+		meals:          map[string][]MealEntry{},
+		weights:        map[string][]WeightEntry{},
+		scores:         map[string][]HealthScoreChange{},
+		memoryAccounts: newMemoryAccounts(),
+	}
+}
+
+func (s *MemoryStore) GetProfile(ctx context.Context, email string) (*UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.profiles[email]
+	if !ok {
+		return nil, classify(sql.ErrNoRows)
+	}
+	return &p, nil
+}
+
+func (s *MemoryStore) SaveProfile(ctx context.Context, profile *UserProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := *profile
+	if existing, ok := s.profiles[p.Email]; ok {
+		p.DietPlan, p.DM = existing.DietPlan, existing.DM
+	} else {
+		p.DietPlan, p.DM = nil, nil
+	}
+	s.profiles[p.Email] = p
+	return nil
+}
+
+func (s *MemoryStore) ListProfiles(ctx context.Context) ([]UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := make([]UserProfile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Email < profiles[j].Email })
+	return profiles, nil
+}
+
+func (s *MemoryStore) ProfileExists(ctx context.Context, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.profiles[email]
+	return ok, nil
+}
+
+func (s *MemoryStore) UpdateDiet(ctx context.Context, email string, diet string) error {
+	s.updateProfile(email, func(p *UserProfile) { p.DietPlan = &diet })
+	return nil
+}
+
+func (s *MemoryStore) DeleteProfile(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.profiles, email)
+	delete(s.meals, email)
+	delete(s.weights, email)
+	delete(s.scores, email)
+	return nil
+}
+
+func (s *MemoryStore) AddMealEntry(ctx context.Context, email string, entry MealEntry) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// meal_entries references user_details
+	if _, ok := s.profiles[email]; !ok {
+		return 0, fmt.Errorf("failed to insert meal entry: %w: no profile for %s", ErrConflict, email)
+	}
+
+	s.nextMealID++
+	entry.ID = s.nextMealID
+	entry.Items = append([]MealItem{}, entry.Items...)
+	s.meals[email] = append(s.meals[email], entry)
+	return entry.ID, nil
+}
+
+func (s *MemoryStore) ListMealEntries(ctx context.Context, email string) ([]MealEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]MealEntry, 0, len(s.meals[email]))
+	for _, e := range s.meals[email] {
+		e.Items = append([]MealItem{}, e.Items...)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) AddWeightEntry(ctx context.Context, email string, entry WeightEntry) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// weight_entries references user_details
+	p, ok := s.profiles[email]
+	if !ok {
+		return 0, fmt.Errorf("failed to insert weight entry: %w: no profile for %s", ErrConflict, email)
+	}
+
+	latest := true
+	for _, e := range s.weights[email] {
+		if e.MeasuredAt.After(entry.MeasuredAt) {
+			latest = false
+		}
+	}
+
+	s.nextWeightID++
+	entry.ID = s.nextWeightID
+	s.weights[email] = append(s.weights[email], entry)
+	sort.SliceStable(s.weights[email], func(i, j int) bool {
+		return s.weights[email][i].MeasuredAt.Before(s.weights[email][j].MeasuredAt)
+	})
+	if latest {
+		p.Weight = entry.Weight
+		s.profiles[email] = p
+	}
+	return entry.ID, nil
+}
+
+func (s *MemoryStore) ListWeightEntries(ctx context.Context, email string) ([]WeightEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]WeightEntry{}, s.weights[email]...), nil
+}
+
+func (s *MemoryStore) RecordHealthScore(ctx context.Context, email string, change HealthScoreChange) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.profiles[email]
+	if !ok {
+		return false, classify(sql.ErrNoRows)
+	}
+
+	last := p.Healthscore
+	if history := s.scores[email]; len(history) > 0 {
+		last = history[len(history)-1].Score
+		if sameHealthScore(history[len(history)-1], change) {
+			p.Healthscore = change.Score
+			s.profiles[email] = p
+			return false, nil
+		}
+	}
+
+	s.nextScoreID++
+	change.ID = s.nextScoreID
+	change.Previous = &last
+	change.Breakdown = append([]HealthScoreFactor(nil), change.Breakdown...)
+	change.RecordedAt = time.Now()
+	s.scores[email] = append(s.scores[email], change)
+	p.Healthscore = change.Score
+	s.profiles[email] = p
+	return true, nil
+}
+
+func (s *MemoryStore) ListHealthScores(ctx context.Context, email string) ([]HealthScoreChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]HealthScoreChange{}, s.scores[email]...), nil
+}
+
+func (s *MemoryStore) SendMessage(ctx context.Context, email string, text string) error {
+	s.updateProfile(email, func(p *UserProfile) { p.DM = &text })
+	return nil
+}
+
+func (s *MemoryStore) ListMessages(ctx context.Context) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := []Message{}
+	for _, p := range s.profiles {
+		if p.DM != nil && *p.DM != "" {
+			messages = append(messages, Message{Email: p.Email, Name: p.Name, Text: *p.DM})
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].Name != messages[j].Name {
+			return messages[i].Name < messages[j].Name
+		}
+		return messages[i].Email < messages[j].Email
+	})
+	return messages, nil
+}
+
+func (s *MemoryStore) updateProfile(email string, update func(p *UserProfile)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.profiles[email]; ok {
+		update(&p)
+		s.profiles[email] = p
+	}
+}
@@ -0,0 +1,308 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey identifies the advisory lock held while migrating so that
+// several instances starting at once apply every migration exactly once.
+const migrationLockKey = 7_140_531_001
+
+// Migration is one numbered schema change loaded from
+// migrations/NNNN_name.up.sql and its optional .down.sql counterpart.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied. Applied
+// versions without a matching file (e.g. after rolling back the binary) are
+// listed with Unknown set.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool
+}
+
+// LoadMigrations returns the embedded migrations ordered by version.
+func LoadMigrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles)
+}
+
+// loadMigrations reads the migrations directory of fsys.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", file)
+		}
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(num, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a positive version number", file)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join("migrations", file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateDB applies every pending migration. It is run at startup.
+func MigrateDB() error {
+	fmt.Println("[DB] Starting database migrations...")
+	n, err := MigrateUp(0)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Database schema up to date (%d migrations applied)\n", n)
+	return nil
+}
+
+// MigrateUp applies up to steps pending migrations in version order, or all
+// of them when steps <= 0, and returns how many were applied.
+func MigrateUp(steps int) (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range pendingMigrations(migrations, done, steps) {
+			err := runMigration(ctx, conn, m.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+			}
+			fmt.Printf("⬆️  Applied migration %d_%s\n", m.Version, m.Name)
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the steps most recently applied migrations (at least
+// one) and returns how many were reverted.
+func MigrateDown(steps int) (int, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	err = withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		plan, err := revertibleMigrations(migrations, done, steps)
+		if err != nil {
+			return err
+		}
+		for _, m := range plan {
+			err := runMigration(ctx, conn, m.Down, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", m.Version, m.Name, err)
+			}
+			fmt.Printf("⬇️  Reverted migration %d_%s\n", m.Version, m.Name)
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// pendingMigrations returns the first steps migrations, or all of them when
+// steps <= 0, that are not in done.
+func pendingMigrations(migrations []Migration, done map[int64]time.Time, steps int) []Migration {
+	var pending []Migration
+	for _, m := range migrations {
+		if steps > 0 && len(pending) == steps {
+			break
+		}
+		if _, ok := done[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// revertibleMigrations returns the steps most recently applied migrations,
+// newest first. It fails, reverting nothing, when one of them is unknown or
+// has no down script.
+func revertibleMigrations(migrations []Migration, done map[int64]time.Time, steps int) ([]Migration, error) {
+	known := map[int64]Migration{}
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	versions := make([]int64, 0, len(done))
+	for v := range done {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	var plan []Migration
+	for _, v := range versions {
+		if len(plan) == steps {
+			break
+		}
+		m, ok := known[v]
+		if !ok {
+			return nil, fmt.Errorf("migration %d is applied but unknown to this binary", v)
+		}
+		if m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s is irreversible", m.Version, m.Name)
+		}
+		plan = append(plan, m)
+	}
+	return plan, nil
+}
+
+// MigrationStatuses lists every known migration together with the applied
+// state recorded in schema_migrations.
+func MigrationStatuses() ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			at, ok := done[m.Version]
+			statuses = append(statuses, MigrationStatus{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+			delete(done, m.Version)
+		}
+		for v, at := range done {
+			statuses = append(statuses, MigrationStatus{Version: v, Applied: true, AppliedAt: at, Unknown: true})
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration
+// advisory lock, creating schema_migrations first if needed.
+func withMigrationLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(ctx, conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		done[version] = at
+	}
+	return done, rows.Err()
+}
+
+// runMigration executes script and the schema_migrations bookkeeping in one
+// transaction, so a failing script leaves no trace. The script is executed
+// without arguments, which lets it contain several statements.
+func runMigration(ctx context.Context, conn *sql.Conn, script string, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	return tx.Commit()
+}
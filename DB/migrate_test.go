@@ -0,0 +1,176 @@
+package DB
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s is at position %d, versions must have no gaps", m.Version, m.Name, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+
+	tests := []struct {
+		name         string
+		files        fstest.MapFS
+		wantVersions []int64
+		wantErr      string
+	}{
+		{
+			name: "ordered by version, not by name",
+			files: fstest.MapFS{
+				"migrations/0010_ten.up.sql":   file("ten"),
+				"migrations/0010_ten.down.sql": file("undo ten"),
+				"migrations/0002_two.up.sql":   file("two"),
+			},
+			wantVersions: []int64{2, 10},
+		},
+		{
+			name:    "missing up script",
+			files:   fstest.MapFS{"migrations/0001_one.down.sql": file("undo one")},
+			wantErr: "has no up script",
+		},
+		{
+			name:    "unknown direction",
+			files:   fstest.MapFS{"migrations/0001_one.sideways.sql": file("one")},
+			wantErr: "must end in .up.sql or .down.sql",
+		},
+		{
+			name:    "no version",
+			files:   fstest.MapFS{"migrations/one.up.sql": file("one")},
+			wantErr: "positive version number",
+		},
+		{
+			name:    "zero version",
+			files:   fstest.MapFS{"migrations/0000_zero.up.sql": file("zero")},
+			wantErr: "positive version number",
+		},
+		{
+			name: "two names for one version",
+			files: fstest.MapFS{
+				"migrations/0001_one.up.sql":   file("one"),
+				"migrations/0001_uno.down.sql": file("undo one"),
+			},
+			wantErr: "has two names",
+		},
+	}
+	for _, tt := range tests {
+		migrations, err := loadMigrations(tt.files)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := migrationVersions(migrations); !slices.Equal(got, tt.wantVersions) {
+			t.Errorf("%s: got versions %v, want %v", tt.name, got, tt.wantVersions)
+		}
+	}
+
+	migrations, err := loadMigrations(tests[0].files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := migrations[1]; m.Name != "ten" || m.Up != "ten" || m.Down != "undo ten" {
+		t.Errorf("got %+v, want the up and down scripts of 0010_ten", m)
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+
+	tests := []struct {
+		name  string
+		done  map[int64]time.Time
+		steps int
+		want  []int64
+	}{
+		{"fresh database", appliedAt(), 0, []int64{1, 2, 3, 4}},
+		{"one step", appliedAt(), 1, []int64{1}},
+		{"partly applied", appliedAt(1, 2), 0, []int64{3, 4}},
+		{"gap left by a merge", appliedAt(1, 3), 0, []int64{2, 4}},
+		{"up to date", appliedAt(1, 2, 3, 4), 0, nil},
+		{"more steps than pending", appliedAt(1, 2, 3), 5, []int64{4}},
+	}
+	for _, tt := range tests {
+		got := migrationVersions(pendingMigrations(migrations, tt.done, tt.steps))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRevertibleMigrations(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "one", Down: "undo one"},
+		{Version: 2, Name: "two"},
+		{Version: 3, Name: "three", Down: "undo three"},
+		{Version: 4, Name: "four", Down: "undo four"},
+	}
+
+	tests := []struct {
+		name    string
+		done    map[int64]time.Time
+		steps   int
+		want    []int64
+		wantErr string
+	}{
+		{"newest first", appliedAt(1, 2, 3, 4), 2, []int64{4, 3}, ""},
+		{"nothing applied", appliedAt(), 1, nil, ""},
+		{"irreversible", appliedAt(1, 2, 3, 4), 3, nil, "is irreversible"},
+		{"applied by a newer binary", appliedAt(1, 2, 3, 4, 5), 1, nil, "unknown to this binary"},
+	}
+	for _, tt := range tests {
+		plan, err := revertibleMigrations(migrations, tt.done, tt.steps)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := migrationVersions(plan); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func migrationVersions(migrations []Migration) []int64 {
+	var versions []int64
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	return versions
+}
+
+// appliedAt returns the applied state of a database holding versions
+func appliedAt(versions ...int64) map[int64]time.Time {
+	done := map[int64]time.Time{}
+	for _, v := range versions {
+		done[v] = time.Now()
+	}
+	return done
+}
@@ -0,0 +1,23 @@
+-- Baseline schema. IF NOT EXISTS keeps it safe on databases created by the
+-- old MigrateDB or CreateTable* helpers.
+CREATE TABLE IF NOT EXISTS user_credentials (
+	email VARCHAR(100) PRIMARY KEY,
+	password VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_details (
+	email VARCHAR(100) PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	gender VARCHAR(10) NOT NULL,
+	age INTEGER NOT NULL,
+	activity_level VARCHAR(20) NOT NULL,
+	goals TEXT NOT NULL,
+	height FLOAT NOT NULL,
+	weight FLOAT NOT NULL,
+	target_weight FLOAT NOT NULL,
+	diseases TEXT NOT NULL,
+	diet_plan TEXT,
+	healthscore INTEGER NOT NULL,
+	track JSONB,
+	dm TEXT
+);
@@ -0,0 +1 @@
+ALTER TABLE user_details DROP CONSTRAINT IF EXISTS user_details_email_fkey;
@@ -0,0 +1,12 @@
+-- Databases created with CreateTableUserDetails lack the foreign key that
+-- MigrateDB declared. NOT VALID enforces it for new rows without failing on
+-- profiles whose credentials were never created.
+DO $$ BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM pg_constraint
+		WHERE conrelid = 'user_details'::regclass AND contype = 'f'
+	) THEN
+		ALTER TABLE user_details ADD CONSTRAINT user_details_email_fkey
+			FOREIGN KEY (email) REFERENCES user_credentials(email) NOT VALID;
+	END IF;
+END $$;
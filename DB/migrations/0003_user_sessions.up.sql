@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_sessions (
+	token_hash VARCHAR(64) PRIMARY KEY,
+	email VARCHAR(100) NOT NULL REFERENCES user_credentials(email) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS user_sessions_email_idx ON user_sessions (email);
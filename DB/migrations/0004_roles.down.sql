@@ -0,0 +1,2 @@
+ALTER TABLE user_credentials DROP CONSTRAINT IF EXISTS user_credentials_role_check;
+ALTER TABLE user_credentials DROP COLUMN IF EXISTS role;
@@ -0,0 +1,7 @@
+ALTER TABLE user_credentials
+	ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+DO $$ BEGIN
+	ALTER TABLE user_credentials ADD CONSTRAINT user_credentials_role_check
+		CHECK (role IN ('user', 'nutritionist', 'admin'));
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+	provider VARCHAR(50) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	email VARCHAR(100) NOT NULL REFERENCES user_credentials(email) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (provider, subject)
+);
@@ -0,0 +1,12 @@
+ALTER TABLE user_credentials
+	ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+	token_hash VARCHAR(64) PRIMARY KEY,
+	email VARCHAR(100) NOT NULL REFERENCES user_credentials(email) ON DELETE CASCADE,
+	purpose VARCHAR(30) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS user_tokens_email_idx ON user_tokens (email, purpose);
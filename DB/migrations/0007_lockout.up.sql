@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+	scope VARCHAR(10) NOT NULL,
+	key VARCHAR(100) NOT NULL,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ,
+	PRIMARY KEY (scope, key)
+);
+
+CREATE TABLE IF NOT EXISTS lockout_events (
+	id BIGSERIAL PRIMARY KEY,
+	email VARCHAR(100) NOT NULL,
+	ip VARCHAR(64) NOT NULL,
+	scope VARCHAR(10) NOT NULL,
+	failures INTEGER NOT NULL,
+	locked_until TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	unlocked_by VARCHAR(100),
+	unlocked_at TIMESTAMPTZ
+);
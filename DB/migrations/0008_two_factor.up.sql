@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+	email VARCHAR(100) PRIMARY KEY REFERENCES user_credentials(email) ON DELETE CASCADE,
+	secret VARCHAR(64) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	enabled_at TIMESTAMPTZ,
+	last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id BIGSERIAL PRIMARY KEY,
+	email VARCHAR(100) NOT NULL REFERENCES user_credentials(email) ON DELETE CASCADE,
+	code_hash VARCHAR(64) NOT NULL,
+	used_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS user_recovery_codes_email_idx ON user_recovery_codes (email);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	email VARCHAR(100) NOT NULL REFERENCES user_credentials(email) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS api_tokens_email_idx ON api_tokens (email);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS account_deletions (
+	id BIGSERIAL PRIMARY KEY,
+	email VARCHAR(100) NOT NULL,
+	requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	scheduled_for TIMESTAMPTZ NOT NULL,
+	completed_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS account_deletions_pending_idx
+	ON account_deletions (email) WHERE completed_at IS NULL;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+	id BIGSERIAL PRIMARY KEY,
+	at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	actor VARCHAR(100) NOT NULL,
+	action VARCHAR(50) NOT NULL,
+	subject VARCHAR(100) NOT NULL,
+	ip VARCHAR(64) NOT NULL DEFAULT '',
+	metadata JSONB NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, at);
+CREATE INDEX IF NOT EXISTS audit_events_subject_idx ON audit_events (subject, at);
+
+-- The audit log is append-only
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_change ON audit_events;
+CREATE TRIGGER audit_events_no_change BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
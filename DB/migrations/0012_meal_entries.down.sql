@@ -0,0 +1,31 @@
+-- Rebuild the track arrays in the shape AppendMeals used to write.
+ALTER TABLE user_details ADD COLUMN IF NOT EXISTS track JSONB;
+
+UPDATE user_details d
+SET track = t.track
+FROM (
+	SELECT me.email, jsonb_agg(
+		jsonb_build_object(
+			'date', COALESCE(to_char(me.entry_date, 'YYYY-MM-DD'), ''),
+			'weight', COALESCE(me.weight::text, '')
+		) || COALESCE((
+			SELECT jsonb_object_agg(meals.meal_type, meals.value)
+			FROM (
+				SELECT mi.meal_type,
+					CASE WHEN bool_and(mi.source = 'text') THEN to_jsonb(string_agg(mi.food, ', ' ORDER BY mi.id))
+					ELSE jsonb_object_agg(mi.food, mi.calories)
+						|| jsonb_build_object('Total calories', COALESCE(sum(mi.calories), 0))
+					END AS value
+				FROM meal_items mi
+				WHERE mi.entry_id = me.id
+				GROUP BY mi.meal_type
+			) meals
+		), '{}'::jsonb)
+		ORDER BY me.id) AS track
+	FROM meal_entries me
+	GROUP BY me.email
+) t
+WHERE d.email = t.email;
+
+DROP TABLE IF EXISTS meal_items;
+DROP TABLE IF EXISTS meal_entries;
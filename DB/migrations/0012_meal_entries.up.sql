@@ -0,0 +1,69 @@
+-- Meals move out of the user_details.track JSONB array into one row per
+-- tracked day and one row per food, so adding a meal is a plain INSERT.
+-- Entries hang off user_details, which tracking always required.
+CREATE TABLE IF NOT EXISTS meal_entries (
+	id BIGSERIAL PRIMARY KEY,
+	email VARCHAR(100) NOT NULL REFERENCES user_details(email) ON DELETE CASCADE,
+	entry_date DATE,
+	weight DOUBLE PRECISION,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	legacy_position INTEGER
+);
+CREATE INDEX IF NOT EXISTS meal_entries_email_idx ON meal_entries (email, id);
+
+CREATE TABLE IF NOT EXISTS meal_items (
+	id BIGSERIAL PRIMARY KEY,
+	entry_id BIGINT NOT NULL REFERENCES meal_entries(id) ON DELETE CASCADE,
+	meal_type VARCHAR(20) NOT NULL CHECK (meal_type IN ('breakfast', 'lunch', 'dinner')),
+	food TEXT NOT NULL,
+	calories INTEGER,
+	source VARCHAR(10) NOT NULL CHECK (source IN ('text', 'image'))
+);
+CREATE INDEX IF NOT EXISTS meal_items_entry_idx ON meal_items (entry_id);
+
+-- Copy every element of the old track arrays. A lone object was stored by
+-- early versions and is treated as a one-element array.
+INSERT INTO meal_entries (email, entry_date, weight, legacy_position)
+SELECT d.email,
+	CASE WHEN e.value->>'date' ~ '^\d{4}-\d{2}-\d{2}$' THEN (e.value->>'date')::date END,
+	CASE WHEN trim(e.value->>'weight') ~ '^\d+(\.\d+)?$' THEN trim(e.value->>'weight')::double precision END,
+	e.ordinality
+FROM user_details d
+CROSS JOIN LATERAL jsonb_array_elements(
+	CASE jsonb_typeof(d.track)
+		WHEN 'array' THEN d.track
+		WHEN 'object' THEN jsonb_build_array(d.track)
+		ELSE '[]'::jsonb
+	END) WITH ORDINALITY e
+WHERE jsonb_typeof(e.value) = 'object'
+ORDER BY d.email, e.ordinality;
+
+-- Typed meals become a single text item, analysed photos one item per food.
+-- "Total calories" is derived from the items and not stored.
+INSERT INTO meal_items (entry_id, meal_type, food, calories, source)
+SELECT me.id, m.meal_type, m.food, m.calories, m.source
+FROM meal_entries me
+JOIN user_details d ON d.email = me.email
+CROSS JOIN LATERAL (
+	SELECT CASE jsonb_typeof(d.track)
+		WHEN 'array' THEN d.track->(me.legacy_position - 1)
+		ELSE d.track
+	END AS entry
+) src
+CROSS JOIN LATERAL (
+	SELECT t.meal_type, src.entry->>t.meal_type AS food, NULL::integer AS calories, 'text' AS source, 0 AS n
+	FROM unnest(ARRAY['breakfast', 'lunch', 'dinner']) AS t(meal_type)
+	WHERE jsonb_typeof(src.entry->t.meal_type) = 'string' AND src.entry->>t.meal_type <> ''
+	UNION ALL
+	SELECT t.meal_type, f.key,
+		CASE WHEN f.value::text ~ '^"?\d+(\.\d+)?"?$' THEN round(trim(both '"' from f.value::text)::numeric)::integer END,
+		'image', 1
+	FROM unnest(ARRAY['breakfast', 'lunch', 'dinner']) AS t(meal_type)
+	CROSS JOIN LATERAL jsonb_each(src.entry->t.meal_type) f
+	WHERE jsonb_typeof(src.entry->t.meal_type) = 'object' AND f.key <> 'Total calories'
+) m
+WHERE me.legacy_position IS NOT NULL
+ORDER BY me.id, m.meal_type, m.n;
+
+ALTER TABLE meal_entries DROP COLUMN legacy_position;
+ALTER TABLE user_details DROP COLUMN IF EXISTS track;
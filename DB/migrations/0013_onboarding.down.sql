@@ -0,0 +1 @@
+ALTER TABLE user_credentials DROP COLUMN IF EXISTS onboarded_at;
@@ -0,0 +1,7 @@
+-- onboarded_at is set when a user first saves their profile through /form.
+-- Accounts without it signed up but never finished onboarding.
+ALTER TABLE user_credentials ADD COLUMN IF NOT EXISTS onboarded_at TIMESTAMPTZ;
+
+UPDATE user_credentials c SET onboarded_at = NOW()
+WHERE c.onboarded_at IS NULL
+	AND EXISTS (SELECT 1 FROM user_details d WHERE d.email = c.email);
@@ -0,0 +1,23 @@
+-- Weight measurements get their own log instead of only overwriting
+-- user_details.weight or riding along with a tracked meal.
+CREATE TABLE IF NOT EXISTS weight_entries (
+	id BIGSERIAL PRIMARY KEY,
+	email VARCHAR(100) NOT NULL REFERENCES user_details(email) ON DELETE CASCADE,
+	weight DOUBLE PRECISION NOT NULL CHECK (weight > 0),
+	measured_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	source VARCHAR(10) NOT NULL CHECK (source IN ('form', 'meal', 'manual'))
+);
+CREATE INDEX IF NOT EXISTS weight_entries_email_idx ON weight_entries (email, measured_at);
+
+-- Seed the log with the weights of tracked meals, then with the profile
+-- weight of users who never tracked one.
+INSERT INTO weight_entries (email, weight, measured_at, source)
+SELECT email, weight, COALESCE(entry_date::timestamptz, created_at), 'meal'
+FROM meal_entries
+WHERE weight > 0;
+
+INSERT INTO weight_entries (email, weight, measured_at, source)
+SELECT d.email, d.weight, NOW(), 'form'
+FROM user_details d
+WHERE d.weight > 0
+	AND NOT EXISTS (SELECT 1 FROM weight_entries w WHERE w.email = d.email);
@@ -0,0 +1,12 @@
+-- Every change of user_details.healthscore is kept with where it came from
+-- and, for computed scores, the points each factor contributed.
+CREATE TABLE IF NOT EXISTS health_scores (
+	id BIGSERIAL PRIMARY KEY,
+	email VARCHAR(100) NOT NULL REFERENCES user_details(email) ON DELETE CASCADE,
+	score INTEGER NOT NULL,
+	previous INTEGER,
+	source VARCHAR(20) NOT NULL CHECK (source IN ('computed', 'self', 'nutritionist')),
+	breakdown JSONB,
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS health_scores_email_idx ON health_scores (email, id);
@@ -0,0 +1 @@
+ALTER TABLE health_scores DROP COLUMN IF EXISTS rule_version;
@@ -0,0 +1,3 @@
+-- The version of the health score rules that computed a score. Scores from
+-- before the rules were configurable, or not computed at all, have none.
+ALTER TABLE health_scores ADD COLUMN IF NOT EXISTS rule_version VARCHAR(50);
@@ -0,0 +1,10 @@
+ALTER TABLE meal_items
+	DROP CONSTRAINT IF EXISTS meal_items_nutrients_check,
+	DROP COLUMN IF EXISTS portion,
+	DROP COLUMN IF EXISTS portion_grams,
+	DROP COLUMN IF EXISTS protein_g,
+	DROP COLUMN IF EXISTS carbs_g,
+	DROP COLUMN IF EXISTS fat_g,
+	DROP COLUMN IF EXISTS fibre_g,
+	DROP COLUMN IF EXISTS sugar_g,
+	DROP COLUMN IF EXISTS sodium_mg;
@@ -0,0 +1,16 @@
+-- Photo analysis estimates the portion and nutrients of every food. Typed
+-- meals and items analysed before have none, so every column is nullable;
+-- the nutrients are stored all together or not at all.
+ALTER TABLE meal_items
+	ADD COLUMN IF NOT EXISTS portion TEXT,
+	ADD COLUMN IF NOT EXISTS portion_grams DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS protein_g DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS carbs_g DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS fat_g DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS fibre_g DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS sugar_g DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS sodium_mg DOUBLE PRECISION;
+
+ALTER TABLE meal_items ADD CONSTRAINT meal_items_nutrients_check CHECK (
+	num_nulls(protein_g, carbs_g, fat_g, fibre_g, sugar_g, sodium_mg) IN (0, 6)
+);
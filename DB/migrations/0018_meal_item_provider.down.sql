@@ -0,0 +1 @@
+ALTER TABLE meal_items DROP COLUMN IF EXISTS provider;
@@ -0,0 +1,3 @@
+-- The AI provider that analysed a photographed meal item, as providers now
+-- fall back on each other. Typed items and earlier analyses have none.
+ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS provider VARCHAR(50);
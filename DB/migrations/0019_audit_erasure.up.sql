@@ -0,0 +1,17 @@
+-- The audit log stays append-only, except that erasing an account may
+-- replace its email in actor and subject with the SHA-256 pseudonym kept in
+-- account_deletions, and clear the IP of the events it acted in.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'UPDATE'
+		AND NEW.id = OLD.id AND NEW.at = OLD.at AND NEW.action = OLD.action
+		AND NEW.metadata = OLD.metadata
+		AND (NEW.actor = OLD.actor OR NEW.actor = 'sha256:' || encode(sha256(convert_to(OLD.actor, 'UTF8')), 'hex'))
+		AND (NEW.subject = OLD.subject OR NEW.subject = 'sha256:' || encode(sha256(convert_to(OLD.subject, 'UTF8')), 'hex'))
+		AND (NEW.ip = OLD.ip OR NEW.ip = '')
+	THEN
+		RETURN NEW;
+	END IF;
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,1013 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The account collections of MongoStore mirror the Postgres tables. Where
+// Postgres needs a transaction, the writes here either go to one document
+// or run in the order that leaves the account safe when a later one fails.
+
+// defaultRole is the role of new accounts, the column default in Postgres
+const defaultRole = "user"
+
+type mongoCredentials struct {
+	Email           string     `bson:"_id"`
+	Password        string     `bson:"password"`
+	Role            string     `bson:"role"`
+	EmailVerifiedAt *time.Time `bson:"email_verified_at"`
+	OnboardedAt     *time.Time `bson:"onboarded_at"`
+	CreatedAt       time.Time  `bson:"created_at"`
+}
+
+type mongoSession struct {
+	TokenHash string     `bson:"_id"`
+	Email     string     `bson:"email"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	RevokedAt *time.Time `bson:"revoked_at"`
+	CreatedAt time.Time  `bson:"created_at"`
+}
+
+type mongoAPIToken struct {
+	ID         int64      `bson:"_id"`
+	Email      string     `bson:"email"`
+	Name       string     `bson:"name"`
+	TokenHash  string     `bson:"token_hash"`
+	Scopes     []string   `bson:"scopes"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	LastUsedAt *time.Time `bson:"last_used_at"`
+	RevokedAt  *time.Time `bson:"revoked_at"`
+}
+
+type mongoUserToken struct {
+	TokenHash string     `bson:"_id"`
+	Email     string     `bson:"email"`
+	Purpose   string     `bson:"purpose"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at"`
+	CreatedAt time.Time  `bson:"created_at"`
+}
+
+type mongoTOTP struct {
+	Email        string     `bson:"_id"`
+	Secret       string     `bson:"secret"`
+	EnabledAt    *time.Time `bson:"enabled_at"`
+	LastUsedStep int64      `bson:"last_used_step"`
+	CreatedAt    time.Time  `bson:"created_at"`
+}
+
+type mongoIdentity struct {
+	Provider  string    `bson:"provider"`
+	Subject   string    `bson:"subject"`
+	Email     string    `bson:"email"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// mongoLoginFailure is keyed by scope and key, e.g. "ip:10.0.0.1"
+type mongoLoginFailure struct {
+	ID            string     `bson:"_id"`
+	Scope         string     `bson:"scope"`
+	Key           string     `bson:"key"`
+	Failures      int        `bson:"failures"`
+	LastFailureAt time.Time  `bson:"last_failure_at"`
+	LockedUntil   *time.Time `bson:"locked_until"`
+}
+
+type mongoLockoutEvent struct {
+	ID          int64      `bson:"_id"`
+	Email       string     `bson:"email"`
+	IP          string     `bson:"ip"`
+	Scope       string     `bson:"scope"`
+	Failures    int        `bson:"failures"`
+	LockedUntil time.Time  `bson:"locked_until"`
+	CreatedAt   time.Time  `bson:"created_at"`
+	UnlockedBy  *string    `bson:"unlocked_by"`
+	UnlockedAt  *time.Time `bson:"unlocked_at"`
+}
+
+// mongoAccountDeletion has Pending set to the email while the deletion is
+// pending. A unique sparse index on it allows one pending deletion per
+// account, like the partial index in Postgres.
+type mongoAccountDeletion struct {
+	Email        string     `bson:"email"`
+	Pending      string     `bson:"pending,omitempty"`
+	RequestedAt  time.Time  `bson:"requested_at"`
+	ScheduledFor time.Time  `bson:"scheduled_for"`
+	CompletedAt  *time.Time `bson:"completed_at"`
+}
+
+type mongoAuditEvent struct {
+	ID       int64                  `bson:"_id"`
+	At       time.Time              `bson:"at"`
+	Actor    string                 `bson:"actor"`
+	Action   string                 `bson:"action"`
+	Subject  string                 `bson:"subject"`
+	IP       string                 `bson:"ip"`
+	Metadata map[string]interface{} `bson:"metadata"`
+}
+
+// accountIndexes are the indexes of the account collections created by
+// NewMongoStore.
+func (s *MongoStore) accountIndexes() []mongoIndex {
+	return []mongoIndex{
+		{s.credentials, mongo.IndexModel{Keys: bson.D{{Key: "role", Value: 1}}}},
+		{s.sessions, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}}},
+		{s.apiTokens, mongo.IndexModel{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		{s.apiTokens, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: -1}}}},
+		{s.userTokens, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}, {Key: "purpose", Value: 1}}}},
+		{s.recoveryCodes, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}, {Key: "code_hash", Value: 1}}}},
+		{s.identities, mongo.IndexModel{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		{s.identities, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}}},
+		{s.lockouts, mongo.IndexModel{Keys: bson.D{{Key: "created_at", Value: -1}}}},
+		{s.deletions, mongo.IndexModel{Keys: bson.D{{Key: "pending", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)}},
+		{s.audit, mongo.IndexModel{Keys: bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{s.audit, mongo.IndexModel{Keys: bson.D{{Key: "actor", Value: 1}}}},
+		{s.audit, mongo.IndexModel{Keys: bson.D{{Key: "subject", Value: 1}}}},
+	}
+}
+
+func (s *MongoStore) CreateCredentials(ctx context.Context, email string, passwordHash string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.credentials.InsertOne(ctx, mongoCredentials{Email: email, Password: passwordHash, Role: defaultRole, CreatedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to insert user credentials: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) GetPasswordHash(ctx context.Context, email string) (string, error) {
+	c, err := s.getCredentials(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	return c.Password, nil
+}
+
+func (s *MongoStore) CredentialsExist(ctx context.Context, email string) (bool, error) {
+	return exists(ctx, s.credentials, email)
+}
+
+func (s *MongoStore) IsOnboarded(ctx context.Context, email string) (bool, error) {
+	c, err := s.getCredentials(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	return c.OnboardedAt != nil, nil
+}
+
+func (s *MongoStore) MarkOnboarded(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": email, "onboarded_at": nil}
+	if _, err := s.credentials.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"onboarded_at": time.Now()}}); err != nil {
+		return fmt.Errorf("failed to record onboarding: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) ImportCredential(ctx context.Context, email string, passwordHash string) (bool, string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	insert := bson.M{"$setOnInsert": bson.M{"password": passwordHash, "role": defaultRole, "created_at": time.Now()}}
+	res, err := s.credentials.UpdateOne(ctx, bson.M{"_id": email}, insert, options.Update().SetUpsert(true))
+	if err != nil {
+		return false, "", fmt.Errorf("failed to import credentials: %w", classify(err))
+	}
+	if res.UpsertedCount == 1 {
+		return true, "", nil
+	}
+
+	existing, err := s.GetPasswordHash(ctx, email)
+	if err != nil {
+		return false, "", err
+	}
+	return false, existing, nil
+}
+
+func (s *MongoStore) getCredentials(ctx context.Context, email string) (*mongoCredentials, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var c mongoCredentials
+	if err := s.credentials.FindOne(ctx, bson.M{"_id": email}).Decode(&c); err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", classify(err))
+	}
+	return &c, nil
+}
+
+func (s *MongoStore) CreateSession(ctx context.Context, tokenHash string, email string, expiresAt time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.sessions.InsertOne(ctx, mongoSession{TokenHash: tokenHash, Email: email, ExpiresAt: expiresAt, CreatedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) GetSessionEmail(ctx context.Context, tokenHash string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var session mongoSession
+	filter := bson.M{"_id": tokenHash, "revoked_at": nil, "expires_at": bson.M{"$gt": time.Now()}}
+	if err := s.sessions.FindOne(ctx, filter).Decode(&session); err != nil {
+		return "", fmt.Errorf("failed to read session: %w", classify(err))
+	}
+	return session.Email, nil
+}
+
+func (s *MongoStore) RevokeSession(ctx context.Context, tokenHash string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.sessions.UpdateOne(ctx, bson.M{"_id": tokenHash, "revoked_at": nil}, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) RevokeUserSessions(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.sessions.UpdateMany(ctx, bson.M{"email": email, "revoked_at": nil}, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	res, err := s.sessions.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"expires_at": bson.M{"$lt": dayAgo}},
+		bson.M{"revoked_at": bson.M{"$lt": dayAgo}},
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", classify(err))
+	}
+	return res.DeletedCount, nil
+}
+
+func (s *MongoStore) GetUserRole(ctx context.Context, email string) (string, error) {
+	c, err := s.getCredentials(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	return c.Role, nil
+}
+
+func (s *MongoStore) SetUserRole(ctx context.Context, email string, role string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.credentials.UpdateOne(ctx, bson.M{"_id": email}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", classify(err))
+	}
+	if res.MatchedCount == 0 {
+		return classify(mongo.ErrNoDocuments)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListUsersByRole(ctx context.Context, role string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	cursor, err := s.credentials.Find(ctx, bson.M{"role": role}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users by role: %w", classify(err))
+	}
+	var docs []mongoCredentials
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode credentials: %w", classify(err))
+	}
+
+	emails := make([]string, 0, len(docs))
+	for _, d := range docs {
+		emails = append(emails, d.Email)
+	}
+	return emails, nil
+}
+
+func (s *MongoStore) CreateAPIToken(ctx context.Context, email string, name string, tokenHash string, scopes []string) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	id, err := s.nextID(ctx, "api_tokens")
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate API token id: %w", err)
+	}
+	_, err = s.apiTokens.InsertOne(ctx, mongoAPIToken{
+		ID:        id,
+		Email:     email,
+		Name:      name,
+		TokenHash: tokenHash,
+		Scopes:    append([]string{}, scopes...),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create API token: %w", classify(err))
+	}
+	return id, nil
+}
+
+func (s *MongoStore) ListAPITokens(ctx context.Context, email string) ([]APIToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	sort := bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+	cursor, err := s.apiTokens.Find(ctx, bson.M{"email": email}, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", classify(err))
+	}
+	var docs []mongoAPIToken
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode API tokens: %w", classify(err))
+	}
+
+	tokens := make([]APIToken, 0, len(docs))
+	for _, d := range docs {
+		if d.Scopes == nil {
+			d.Scopes = []string{}
+		}
+		tokens = append(tokens, APIToken{ID: d.ID, Name: d.Name, Scopes: d.Scopes, CreatedAt: d.CreatedAt, LastUsedAt: d.LastUsedAt, RevokedAt: d.RevokedAt})
+	}
+	return tokens, nil
+}
+
+func (s *MongoStore) RevokeAPIToken(ctx context.Context, email string, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "email": email, "revoked_at": nil}
+	res, err := s.apiTokens.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", classify(err))
+	}
+	if res.MatchedCount == 0 {
+		return classify(mongo.ErrNoDocuments)
+	}
+	return nil
+}
+
+func (s *MongoStore) UseAPIToken(ctx context.Context, tokenHash string) (string, []string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var token mongoAPIToken
+	err := s.apiTokens.FindOneAndUpdate(ctx,
+		bson.M{"token_hash": tokenHash, "revoked_at": nil},
+		bson.M{"$set": bson.M{"last_used_at": time.Now()}},
+	).Decode(&token)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read API token: %w", classify(err))
+	}
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+	return token.Email, token.Scopes, nil
+}
+
+func (s *MongoStore) CreateUserToken(ctx context.Context, tokenHash string, email string, purpose string, expiresAt time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.userTokens.UpdateMany(ctx,
+		bson.M{"email": email, "purpose": purpose, "used_at": nil},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate previous tokens: %w", classify(err))
+	}
+
+	_, err = s.userTokens.InsertOne(ctx, mongoUserToken{TokenHash: tokenHash, Email: email, Purpose: purpose, ExpiresAt: expiresAt, CreatedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) ConsumeUserToken(ctx context.Context, tokenHash string, purpose string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	var token mongoUserToken
+	err := s.userTokens.FindOneAndUpdate(ctx,
+		bson.M{"_id": tokenHash, "purpose": purpose, "used_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("failed to consume token: %w", classify(err))
+	}
+	return token.Email, nil
+}
+
+// ResetPassword consumes the token first, so it works once even if a later
+// write fails and the user has to ask for a new link.
+func (s *MongoStore) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (string, error) {
+	email, err := s.ConsumeUserToken(ctx, tokenHash, TokenPasswordReset)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.credentials.UpdateOne(ctx, bson.M{"_id": email}, bson.M{"$set": bson.M{"password": passwordHash}}); err != nil {
+		return "", fmt.Errorf("failed to update password: %w", classify(err))
+	}
+	if err := s.RevokeUserSessions(ctx, email); err != nil {
+		return "", err
+	}
+	// A successful reset proves ownership, so lift any login lockout too
+	if err := s.ClearLoginFailures(ctx, LockoutScopeAccount, email); err != nil {
+		return "", err
+	}
+	return email, nil
+}
+
+func (s *MongoStore) SetEmailVerified(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": email, "email_verified_at": nil}
+	if _, err := s.credentials.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"email_verified_at": time.Now()}}); err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) IsEmailVerified(ctx context.Context, email string) (bool, error) {
+	c, err := s.getCredentials(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	return c.EmailVerifiedAt != nil, nil
+}
+
+// SaveTOTPSecret only matches a pending enrollment, so for an enabled one
+// the upsert collides with its _id.
+func (s *MongoStore) SaveTOTPSecret(ctx context.Context, email string, secret string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.totp.UpdateOne(ctx,
+		bson.M{"_id": email, "enabled_at": nil},
+		bson.M{"$set": bson.M{"secret": secret, "created_at": time.Now(), "last_used_step": int64(0)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP secret: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) GetTOTPSecret(ctx context.Context, email string) (*TOTPSecret, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var t mongoTOTP
+	if err := s.totp.FindOne(ctx, bson.M{"_id": email}).Decode(&t); err != nil {
+		return nil, fmt.Errorf("failed to read TOTP secret: %w", classify(err))
+	}
+	return &TOTPSecret{Secret: t.Secret, Enabled: t.EnabledAt != nil, LastUsedStep: t.LastUsedStep}, nil
+}
+
+func (s *MongoStore) IsTOTPEnabled(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	n, err := s.totp.CountDocuments(ctx, bson.M{"_id": email, "enabled_at": bson.M{"$ne": nil}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to read TOTP status: %w", classify(err))
+	}
+	return n > 0, nil
+}
+
+func (s *MongoStore) UseTOTPStep(ctx context.Context, email string, step int64) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": email, "last_used_step": bson.M{"$lt": step}}
+	res, err := s.totp.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_used_step": step}})
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP use: %w", classify(err))
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// EnableTOTP stores the recovery codes before enabling the enrollment, so
+// an enabled account always has them.
+func (s *MongoStore) EnableTOTP(ctx context.Context, email string, codeHashes []string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.recoveryCodes.DeleteMany(ctx, bson.M{"email": email}); err != nil {
+		return fmt.Errorf("failed to clear recovery codes: %w", classify(err))
+	}
+	if len(codeHashes) > 0 {
+		codes := make([]interface{}, 0, len(codeHashes))
+		for _, h := range codeHashes {
+			codes = append(codes, bson.M{"email": email, "code_hash": h, "used_at": nil})
+		}
+		if _, err := s.recoveryCodes.InsertMany(ctx, codes); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", classify(err))
+		}
+	}
+
+	if _, err := s.totp.UpdateOne(ctx, bson.M{"_id": email}, bson.M{"$set": bson.M{"enabled_at": time.Now()}}); err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) UseRecoveryCode(ctx context.Context, email string, codeHash string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"email": email, "code_hash": codeHash, "used_at": nil}
+	res, err := s.recoveryCodes.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": time.Now()}})
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", classify(err))
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+func (s *MongoStore) CountRecoveryCodes(ctx context.Context, email string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	n, err := s.recoveryCodes.CountDocuments(ctx, bson.M{"email": email, "used_at": nil})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", classify(err))
+	}
+	return int(n), nil
+}
+
+// DeleteTOTP removes the enrollment before the recovery codes, which are
+// useless without it.
+func (s *MongoStore) DeleteTOTP(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.totp.DeleteOne(ctx, bson.M{"_id": email}); err != nil {
+		return fmt.Errorf("failed to delete TOTP secret: %w", classify(err))
+	}
+	if _, err := s.recoveryCodes.DeleteMany(ctx, bson.M{"email": email}); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) GetIdentityEmail(ctx context.Context, provider string, subject string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var identity mongoIdentity
+	if err := s.identities.FindOne(ctx, bson.M{"provider": provider, "subject": subject}).Decode(&identity); err != nil {
+		return "", fmt.Errorf("failed to read identity: %w", classify(err))
+	}
+	return identity.Email, nil
+}
+
+// LinkIdentity follows the Postgres version step by step. A link failing
+// after the credentials were created or reclaimed leaves a verified account
+// without a password, which only the provider can sign in to.
+func (s *MongoStore) LinkIdentity(ctx context.Context, provider string, subject string, email string) (reclaimed bool, err error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	// An empty password hash never matches in bcrypt, so the account can
+	// only be used through the external provider until a password is set
+	insert := bson.M{"$setOnInsert": bson.M{"password": "", "role": defaultRole, "email_verified_at": now, "created_at": now}}
+	if _, err := s.credentials.UpdateOne(ctx, bson.M{"_id": email}, insert, options.Update().SetUpsert(true)); err != nil {
+		return false, fmt.Errorf("failed to create user credentials: %w", classify(err))
+	}
+
+	res, err := s.credentials.UpdateOne(ctx,
+		bson.M{"_id": email, "email_verified_at": nil},
+		bson.M{"$set": bson.M{"password": "", "email_verified_at": now}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reclaim unverified account: %w", classify(err))
+	}
+	if res.ModifiedCount > 0 {
+		reclaimed = true
+		if err := s.RevokeUserSessions(ctx, email); err != nil {
+			return false, err
+		}
+		if _, err := s.apiTokens.UpdateMany(ctx, bson.M{"email": email, "revoked_at": nil}, bson.M{"$set": bson.M{"revoked_at": now}}); err != nil {
+			return false, fmt.Errorf("failed to reclaim unverified account: %w", classify(err))
+		}
+		if _, err := s.userTokens.UpdateMany(ctx, bson.M{"email": email, "used_at": nil}, bson.M{"$set": bson.M{"used_at": now}}); err != nil {
+			return false, fmt.Errorf("failed to reclaim unverified account: %w", classify(err))
+		}
+		if err := s.DeleteTOTP(ctx, email); err != nil {
+			return false, err
+		}
+	}
+
+	_, err = s.identities.InsertOne(ctx, mongoIdentity{Provider: provider, Subject: subject, Email: email, CreatedAt: now})
+	if err != nil {
+		return false, fmt.Errorf("failed to link identity: %w", classify(err))
+	}
+	return reclaimed, nil
+}
+
+// CountLoginAttempt counts the attempt in one atomic update of the counter
+// document, so parallel attempts get consecutive counts. The lock is set
+// by a second update; an attempt counted in between sets its own.
+func (s *MongoStore) CountLoginAttempt(ctx context.Context, scope string, key string, window time.Duration, lockout func(failures int) time.Duration) (LoginCount, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	id := scope + ":" + key
+	now := time.Now().Truncate(time.Millisecond)
+	insert := bson.M{"$setOnInsert": bson.M{"scope": scope, "key": key, "failures": 0, "last_failure_at": now}}
+	if _, err := s.loginFailures.UpdateOne(ctx, bson.M{"_id": id}, insert, options.Update().SetUpsert(true)); err != nil {
+		return LoginCount{}, fmt.Errorf("failed to record login attempt: %w", classify(err))
+	}
+
+	var doc mongoLoginFailure
+	unlocked := bson.M{"_id": id, "$or": bson.A{bson.M{"locked_until": nil}, bson.M{"locked_until": bson.M{"$lte": now}}}}
+	count := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{"$last_failure_at", now.Add(-window)}},
+			1,
+			bson.M{"$add": bson.A{"$failures", 1}},
+		}},
+		"last_failure_at": now,
+		"locked_until":    nil,
+	}}}}
+	err := s.loginFailures.FindOneAndUpdate(ctx, unlocked, count, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		// Locked, so the attempt is refused without being counted
+		if err := s.loginFailures.FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+			return LoginCount{}, fmt.Errorf("failed to read login failures: %w", classify(err))
+		}
+		refused := LoginCount{Failures: doc.Failures, Refused: true}
+		if doc.LockedUntil != nil {
+			refused.LockedUntil = *doc.LockedUntil
+		}
+		return refused, nil
+	}
+	if err != nil {
+		return LoginCount{}, fmt.Errorf("failed to record login attempt: %w", classify(err))
+	}
+
+	result := LoginCount{Failures: doc.Failures}
+	if d := lockout(doc.Failures); d > 0 {
+		// Dates are stored with millisecond precision, which
+		// ReleaseLoginAttempt compares against
+		result.LockedUntil = now.Add(d).Truncate(time.Millisecond)
+		_, err := s.loginFailures.UpdateOne(ctx,
+			bson.M{"_id": id, "failures": doc.Failures},
+			bson.M{"$set": bson.M{"locked_until": result.LockedUntil}},
+		)
+		if err != nil {
+			return LoginCount{}, fmt.Errorf("failed to record login attempt: %w", classify(err))
+		}
+	}
+	return result, nil
+}
+
+func (s *MongoStore) ReleaseLoginAttempt(ctx context.Context, scope string, key string, count LoginCount) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var lockedUntil interface{}
+	if !count.LockedUntil.IsZero() {
+		lockedUntil = count.LockedUntil
+	}
+	release := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failures":     bson.M{"$max": bson.A{bson.M{"$subtract": bson.A{"$failures", 1}}, 0}},
+		"locked_until": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$locked_until", lockedUntil}}, nil, "$locked_until"}},
+	}}}}
+	if _, err := s.loginFailures.UpdateOne(ctx, bson.M{"_id": scope + ":" + key}, release); err != nil {
+		return fmt.Errorf("failed to release login attempt: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) RecordLockout(ctx context.Context, scope string, email string, ip string, failures int, lockedUntil time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	id, err := s.nextID(ctx, "lockout_events")
+	if err != nil {
+		return fmt.Errorf("failed to allocate lockout event id: %w", err)
+	}
+	_, err = s.lockouts.InsertOne(ctx, mongoLockoutEvent{
+		ID:          id,
+		Email:       email,
+		IP:          ip,
+		Scope:       scope,
+		Failures:    failures,
+		LockedUntil: lockedUntil,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record lockout: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) ClearLoginFailures(ctx context.Context, scope string, key string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.loginFailures.DeleteOne(ctx, bson.M{"_id": scope + ":" + key}); err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) UnlockAccount(ctx context.Context, email string, admin string) error {
+	if err := s.ClearLoginFailures(ctx, LockoutScopeAccount, email); err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.lockouts.UpdateMany(ctx,
+		bson.M{"email": email, "scope": LockoutScopeAccount, "unlocked_at": nil},
+		bson.M{"$set": bson.M{"unlocked_by": admin, "unlocked_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update lockout events: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) ListLockoutEvents(ctx context.Context, activeOnly bool, limit int) ([]LockoutEvent, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{}
+	if activeOnly {
+		filter = bson.M{"locked_until": bson.M{"$gt": time.Now()}, "unlocked_at": nil}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := s.lockouts.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lockout events: %w", classify(err))
+	}
+	var docs []mongoLockoutEvent
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode lockout events: %w", classify(err))
+	}
+
+	events := make([]LockoutEvent, 0, len(docs))
+	for _, d := range docs {
+		events = append(events, LockoutEvent(d))
+	}
+	return events, nil
+}
+
+func (s *MongoStore) InsertAuditEvent(ctx context.Context, e AuditEvent) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	id, err := s.nextID(ctx, "audit_events")
+	if err != nil {
+		return fmt.Errorf("failed to allocate audit event id: %w", err)
+	}
+	_, err = s.audit.InsertOne(ctx, mongoAuditEvent{
+		ID:       id,
+		At:       time.Now(),
+		Actor:    e.Actor,
+		Action:   e.Action,
+		Subject:  e.Subject,
+		IP:       e.IP,
+		Metadata: e.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) QueryAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	query := bson.M{}
+	if filter.Actor != "" {
+		query["actor"] = filter.Actor
+	}
+	if filter.Subject != "" {
+		query["subject"] = filter.Subject
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	at := bson.M{}
+	if !filter.From.IsZero() {
+		at["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		at["$lt"] = filter.To
+	}
+	if len(at) > 0 {
+		query["at"] = at
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	sort := bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}
+	cursor, err := s.audit.Find(ctx, query, options.Find().SetSort(sort).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", classify(err))
+	}
+	var docs []mongoAuditEvent
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode audit events: %w", classify(err))
+	}
+
+	events := make([]AuditEvent, 0, len(docs))
+	for _, d := range docs {
+		if d.Metadata == nil {
+			d.Metadata = map[string]interface{}{}
+		}
+		events = append(events, AuditEvent(d))
+	}
+	return events, nil
+}
+
+func (s *MongoStore) ReadCredentialsInfo(ctx context.Context, email string) (*CredentialsInfo, error) {
+	c, err := s.getCredentials(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	info := &CredentialsInfo{Email: email, Role: c.Role, HasPassword: c.Password != "", EmailVerifiedAt: c.EmailVerifiedAt, Identities: []string{}}
+
+	if info.TwoFactor, err = s.IsTOTPEnabled(ctx, email); err != nil {
+		return nil, err
+	}
+
+	qctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	sessions, err := s.sessions.CountDocuments(qctx, bson.M{"email": email, "revoked_at": nil, "expires_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sessions: %w", classify(err))
+	}
+	info.ActiveSessions = int(sessions)
+
+	cursor, err := s.identities.Find(qctx, bson.M{"email": email}, options.Find().SetSort(bson.D{{Key: "provider", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identities: %w", classify(err))
+	}
+	var identities []mongoIdentity
+	if err := cursor.All(qctx, &identities); err != nil {
+		return nil, fmt.Errorf("failed to decode identities: %w", classify(err))
+	}
+	for _, i := range identities {
+		info.Identities = append(info.Identities, i.Provider)
+	}
+
+	info.APITokens, err = s.ListAPITokens(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *MongoStore) RequestAccountDeletion(ctx context.Context, email string, grace time.Duration) (*AccountDeletion, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	var d mongoAccountDeletion
+	err := s.deletions.FindOneAndUpdate(ctx,
+		bson.M{"pending": email},
+		bson.M{"$setOnInsert": bson.M{"email": email, "requested_at": now, "scheduled_for": now.Add(grace), "completed_at": nil}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to schedule deletion: %w", classify(err))
+	}
+	return &AccountDeletion{RequestedAt: d.RequestedAt, ScheduledFor: d.ScheduledFor, CompletedAt: d.CompletedAt}, nil
+}
+
+func (s *MongoStore) GetAccountDeletion(ctx context.Context, email string) (*AccountDeletion, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var d mongoAccountDeletion
+	if err := s.deletions.FindOne(ctx, bson.M{"pending": email}).Decode(&d); err != nil {
+		return nil, fmt.Errorf("failed to read deletion: %w", classify(err))
+	}
+	return &AccountDeletion{RequestedAt: d.RequestedAt, ScheduledFor: d.ScheduledFor, CompletedAt: d.CompletedAt}, nil
+}
+
+func (s *MongoStore) CancelAccountDeletion(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.deletions.DeleteOne(ctx, bson.M{"pending": email})
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %w", classify(err))
+	}
+	if res.DeletedCount == 0 {
+		return classify(mongo.ErrNoDocuments)
+	}
+	return nil
+}
+
+func (s *MongoStore) ListDueAccountDeletions(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"pending": bson.M{"$exists": true}, "scheduled_for": bson.M{"$lte": time.Now()}}
+	cursor, err := s.deletions.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due deletions: %w", classify(err))
+	}
+	var docs []mongoAccountDeletion
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode deletions: %w", classify(err))
+	}
+
+	due := make([]string, 0, len(docs))
+	for _, d := range docs {
+		due = append(due, d.Pending)
+	}
+	return due, nil
+}
+
+// DeleteAccount removes what Postgres deletes by cascade, starting with the
+// sessions so the account loses access first. Every step can be repeated
+// and the deletion is marked complete last, so a failed run is finished by
+// the next one. Audit events are pseudonymised as in Postgres.
+func (s *MongoStore) DeleteAccount(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	steps := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{
+		{s.sessions, bson.M{"email": email}},
+		{s.apiTokens, bson.M{"email": email}},
+		{s.userTokens, bson.M{"email": email}},
+		{s.identities, bson.M{"email": email}},
+		{s.totp, bson.M{"_id": email}},
+		{s.recoveryCodes, bson.M{"email": email}},
+		{s.loginFailures, bson.M{"_id": LockoutScopeAccount + ":" + email}},
+		{s.lockouts, bson.M{"email": email}},
+		{s.credentials, bson.M{"_id": email}},
+	}
+	for _, step := range steps {
+		if _, err := step.collection.DeleteMany(ctx, step.filter); err != nil {
+			return fmt.Errorf("failed to delete account data: %w", classify(err))
+		}
+	}
+
+	erased := erasedEmail(email)
+	pseudonymise := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"actor":   bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$actor", email}}, erased, "$actor"}},
+		"subject": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$subject", email}}, erased, "$subject"}},
+		"ip":      bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$actor", email}}, "", "$ip"}},
+	}}}}
+	_, err := s.audit.UpdateMany(ctx, bson.M{"$or": bson.A{bson.M{"actor": email}, bson.M{"subject": email}}}, pseudonymise)
+	if err != nil {
+		return fmt.Errorf("failed to pseudonymise audit events: %w", classify(err))
+	}
+
+	_, err = s.deletions.UpdateOne(ctx,
+		bson.M{"pending": email},
+		bson.M{"$set": bson.M{"email": erased, "completed_at": time.Now()}, "$unset": bson.M{"pending": ""}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record deletion: %w", classify(err))
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore implements the repositories on MongoDB. Profiles and
+// credentials are keyed by email, meal entries embed their items and
+// entries get increasing integer ids from a counter document so they sort
+// the same way as in Postgres.
+type MongoStore struct {
+	profiles      *mongo.Collection
+	meals         *mongo.Collection
+	weights       *mongo.Collection
+	scores        *mongo.Collection
+	counters      *mongo.Collection
+	credentials   *mongo.Collection
+	sessions      *mongo.Collection
+	apiTokens     *mongo.Collection
+	userTokens    *mongo.Collection
+	totp          *mongo.Collection
+	recoveryCodes *mongo.Collection
+	identities    *mongo.Collection
+	loginFailures *mongo.Collection
+	lockouts      *mongo.Collection
+	deletions     *mongo.Collection
+	audit         *mongo.Collection
+}
+
+var _ Store = (*MongoStore)(nil)
+
+type mongoWeightEntry struct {
+	ID         int64     `bson:"_id"`
+	Email      string    `bson:"email"`
+	Weight     float64   `bson:"weight"`
+	MeasuredAt time.Time `bson:"measured_at"`
+	Source     string    `bson:"source"`
+}
+
+type mongoHealthScore struct {
+	ID          int64               `bson:"_id"`
+	Email       string              `bson:"email"`
+	Score       int                 `bson:"score"`
+	Previous    *int                `bson:"previous"`
+	Source      string              `bson:"source"`
+	Breakdown   []HealthScoreFactor `bson:"breakdown,omitempty"`
+	RuleVersion *string             `bson:"rule_version,omitempty"`
+	RecordedAt  time.Time           `bson:"recorded_at"`
+}
+
+type mongoMealEntry struct {
+	ID        int64      `bson:"_id"`
+	Email     string     `bson:"email"`
+	Date      *time.Time `bson:"date"`
+	Weight    *float64   `bson:"weight"`
+	Items     []MealItem `bson:"items"`
+	CreatedAt time.Time  `bson:"created_at"`
+}
+
+// mongoIndex is an index NewMongoStore creates on a collection.
+type mongoIndex struct {
+	collection *mongo.Collection
+	model      mongo.IndexModel
+}
+
+// NewMongoStore uses the collections of database name and creates the
+// indexes they need.
+func NewMongoStore(database *Database, name string) (*MongoStore, error) {
+	db := database.Client.Database(name)
+	s := &MongoStore{
+		profiles:      db.Collection("profiles"),
+		meals:         db.Collection("meal_entries"),
+		weights:       db.Collection("weight_entries"),
+		scores:        db.Collection("health_scores"),
+		counters:      db.Collection("counters"),
+		credentials:   db.Collection("credentials"),
+		sessions:      db.Collection("sessions"),
+		apiTokens:     db.Collection("api_tokens"),
+		userTokens:    db.Collection("user_tokens"),
+		totp:          db.Collection("totp"),
+		recoveryCodes: db.Collection("recovery_codes"),
+		identities:    db.Collection("identities"),
+		loginFailures: db.Collection("login_failures"),
+		lockouts:      db.Collection("lockout_events"),
+		deletions:     db.Collection("account_deletions"),
+		// Decode nested metadata as maps, so it encodes to JSON objects
+		audit: db.Collection("audit_events", options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})),
+	}
+
+	indexes := []mongoIndex{
+		{s.meals, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}, {Key: "_id", Value: 1}}}},
+		{s.weights, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}, {Key: "measured_at", Value: 1}}}},
+		{s.scores, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}, {Key: "_id", Value: 1}}}},
+	}
+	indexes = append(indexes, s.accountIndexes()...)
+
+	ctx, cancel := withTimeout(context.Background())
+	defer cancel()
+	for _, index := range indexes {
+		if _, err := index.collection.Indexes().CreateOne(ctx, index.model); err != nil {
+			return nil, fmt.Errorf("failed to create %s index: %w", index.collection.Name(), classify(err))
+		}
+	}
+	return s, nil
+}
+
+func (s *MongoStore) GetProfile(ctx context.Context, email string) (*UserProfile, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var p UserProfile
+	if err := s.profiles.FindOne(ctx, bson.M{"_id": email}).Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", classify(err))
+	}
+	return &p, nil
+}
+
+func (s *MongoStore) SaveProfile(ctx context.Context, profile *UserProfile) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"name":           profile.Name,
+		"gender":         profile.Gender,
+		"age":            profile.Age,
+		"activity_level": profile.ActivityLevel,
+		"goals":          profile.Goals,
+		"height":         profile.Height,
+		"weight":         profile.Weight,
+		"target_weight":  profile.TargetWeight,
+		"diseases":       profile.Diseases,
+		"healthscore":    profile.Healthscore,
+	}}
+	_, err := s.profiles.UpdateOne(ctx, bson.M{"_id": profile.Email}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to insert/update user data: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) ListProfiles(ctx context.Context) ([]UserProfile, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	cursor, err := s.profiles.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", classify(err))
+	}
+	profiles := []UserProfile{}
+	if err := cursor.All(ctx, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to decode profiles: %w", classify(err))
+	}
+	return profiles, nil
+}
+
+func (s *MongoStore) ProfileExists(ctx context.Context, email string) (bool, error) {
+	return exists(ctx, s.profiles, email)
+}
+
+func (s *MongoStore) UpdateDiet(ctx context.Context, email string, diet string) error {
+	return s.setProfileFields(ctx, email, bson.M{"diet_plan": diet})
+}
+
+func (s *MongoStore) DeleteProfile(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.meals.DeleteMany(ctx, bson.M{"email": email}); err != nil {
+		return fmt.Errorf("failed to delete meal entries: %w", classify(err))
+	}
+	if _, err := s.weights.DeleteMany(ctx, bson.M{"email": email}); err != nil {
+		return fmt.Errorf("failed to delete weight entries: %w", classify(err))
+	}
+	if _, err := s.scores.DeleteMany(ctx, bson.M{"email": email}); err != nil {
+		return fmt.Errorf("failed to delete health scores: %w", classify(err))
+	}
+	if _, err := s.profiles.DeleteOne(ctx, bson.M{"_id": email}); err != nil {
+		return fmt.Errorf("failed to delete profile: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *MongoStore) AddMealEntry(ctx context.Context, email string, entry MealEntry) (int64, error) {
+	// Meal entries belong to a profile, as the foreign key enforces in Postgres
+	ok, err := s.ProfileExists(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("failed to insert meal entry: %w: no profile for %s", ErrConflict, email)
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	id, err := s.nextID(ctx, "meal_entries")
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate meal entry id: %w", err)
+	}
+
+	items := entry.Items
+	if items == nil {
+		items = []MealItem{}
+	}
+	_, err = s.meals.InsertOne(ctx, mongoMealEntry{
+		ID:        id,
+		Email:     email,
+		Date:      entry.Date,
+		Weight:    entry.Weight,
+		Items:     items,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert meal entry: %w", classify(err))
+	}
+	return id, nil
+}
+
+func (s *MongoStore) ListMealEntries(ctx context.Context, email string) ([]MealEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	cursor, err := s.meals.Find(ctx, bson.M{"email": email}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read meal entries: %w", classify(err))
+	}
+	var docs []mongoMealEntry
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode meal entries: %w", classify(err))
+	}
+
+	entries := make([]MealEntry, 0, len(docs))
+	for _, d := range docs {
+		if d.Items == nil {
+			d.Items = []MealItem{}
+		}
+		entries = append(entries, MealEntry{ID: d.ID, Date: d.Date, Weight: d.Weight, Items: d.Items})
+	}
+	return entries, nil
+}
+
+// AddWeightEntry logs entry and, unless a later measurement exists, copies
+// it to the profile. Without transactions a concurrent log of a later
+// measurement may be overwritten; the next log corrects it.
+func (s *MongoStore) AddWeightEntry(ctx context.Context, email string, entry WeightEntry) (int64, error) {
+	ok, err := s.ProfileExists(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("failed to insert weight entry: %w: no profile for %s", ErrConflict, email)
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	id, err := s.nextID(ctx, "weight_entries")
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate weight entry id: %w", err)
+	}
+	_, err = s.weights.InsertOne(ctx, mongoWeightEntry{
+		ID:         id,
+		Email:      email,
+		Weight:     entry.Weight,
+		MeasuredAt: entry.MeasuredAt,
+		Source:     entry.Source,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert weight entry: %w", classify(err))
+	}
+
+	later, err := s.weights.CountDocuments(ctx,
+		bson.M{"email": email, "measured_at": bson.M{"$gt": entry.MeasuredAt}},
+		options.Count().SetLimit(1))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query weight entries: %w", classify(err))
+	}
+	if later == 0 {
+		if _, err := s.profiles.UpdateOne(ctx, bson.M{"_id": email}, bson.M{"$set": bson.M{"weight": entry.Weight}}); err != nil {
+			return 0, fmt.Errorf("failed to update profile weight: %w", classify(err))
+		}
+	}
+	return id, nil
+}
+
+func (s *MongoStore) ListWeightEntries(ctx context.Context, email string) ([]WeightEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	sort := bson.D{{Key: "measured_at", Value: 1}, {Key: "_id", Value: 1}}
+	cursor, err := s.weights.Find(ctx, bson.M{"email": email}, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read weight entries: %w", classify(err))
+	}
+	var docs []mongoWeightEntry
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode weight entries: %w", classify(err))
+	}
+
+	entries := make([]WeightEntry, 0, len(docs))
+	for _, d := range docs {
+		entries = append(entries, WeightEntry{ID: d.ID, Weight: d.Weight, MeasuredAt: d.MeasuredAt, Source: d.Source})
+	}
+	return entries, nil
+}
+
+// RecordHealthScore mirrors the Postgres version without its row lock:
+// concurrent changes of one user may both be recorded.
+func (s *MongoStore) RecordHealthScore(ctx context.Context, email string, change HealthScoreChange) (bool, error) {
+	profile, err := s.GetProfile(ctx, email)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	last := profile.Healthscore
+	var previous mongoHealthScore
+	err = s.scores.FindOne(ctx, bson.M{"email": email}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&previous)
+	switch {
+	case err == mongo.ErrNoDocuments:
+	case err != nil:
+		return false, fmt.Errorf("failed to read health score history: %w", classify(err))
+	default:
+		last = previous.Score
+	}
+	if err == nil && sameHealthScore(HealthScoreChange{Score: previous.Score, Breakdown: previous.Breakdown, RuleVersion: previous.RuleVersion}, change) {
+		return false, s.setProfileFields(ctx, email, bson.M{"healthscore": change.Score})
+	}
+
+	id, err := s.nextID(ctx, "health_scores")
+	if err != nil {
+		return false, fmt.Errorf("failed to allocate health score id: %w", err)
+	}
+	_, err = s.scores.InsertOne(ctx, mongoHealthScore{
+		ID:          id,
+		Email:       email,
+		Score:       change.Score,
+		Previous:    &last,
+		Source:      change.Source,
+		Breakdown:   change.Breakdown,
+		RuleVersion: change.RuleVersion,
+		RecordedAt:  time.Now(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to insert health score: %w", classify(err))
+	}
+	return true, s.setProfileFields(ctx, email, bson.M{"healthscore": change.Score})
+}
+
+func (s *MongoStore) ListHealthScores(ctx context.Context, email string) ([]HealthScoreChange, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	cursor, err := s.scores.Find(ctx, bson.M{"email": email}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read health scores: %w", classify(err))
+	}
+	var docs []mongoHealthScore
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode health scores: %w", classify(err))
+	}
+
+	changes := make([]HealthScoreChange, 0, len(docs))
+	for _, d := range docs {
+		changes = append(changes, HealthScoreChange{
+			ID:          d.ID,
+			Score:       d.Score,
+			Previous:    d.Previous,
+			Source:      d.Source,
+			Breakdown:   d.Breakdown,
+			RuleVersion: d.RuleVersion,
+			RecordedAt:  d.RecordedAt,
+		})
+	}
+	return changes, nil
+}
+
+func (s *MongoStore) SendMessage(ctx context.Context, email string, text string) error {
+	return s.setProfileFields(ctx, email, bson.M{"dm": text})
+}
+
+func (s *MongoStore) ListMessages(ctx context.Context) ([]Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"dm": bson.M{"$nin": bson.A{nil, ""}}}
+	sort := bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}
+	cursor, err := s.profiles.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", classify(err))
+	}
+	var profiles []UserProfile
+	if err := cursor.All(ctx, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to decode messages: %w", classify(err))
+	}
+
+	messages := make([]Message, 0, len(profiles))
+	for _, p := range profiles {
+		messages = append(messages, Message{Email: p.Email, Name: p.Name, Text: *p.DM})
+	}
+	return messages, nil
+}
+
+// nextID returns the next value of the named counter document, so ids
+// increase like a Postgres sequence.
+func (s *MongoStore) nextID(ctx context.Context, name string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := s.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, classify(err)
+	}
+	return counter.Seq, nil
+}
+
+// setProfileFields updates fields of an existing profile. Like an UPDATE in
+// Postgres it does nothing when the profile does not exist.
+func (s *MongoStore) setProfileFields(ctx context.Context, email string, fields bson.M) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.profiles.UpdateOne(ctx, bson.M{"_id": email}, bson.M{"$set": fields}); err != nil {
+		return fmt.Errorf("failed to update profile: %w", classify(err))
+	}
+	return nil
+}
+
+func exists(ctx context.Context, collection *mongo.Collection, id string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	n, err := collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to query %s: %w", collection.Name(), classify(err))
+	}
+	return n > 0, nil
+}
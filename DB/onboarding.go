@@ -0,0 +1,113 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+)
+
+// Onboarding states reported to the dashboard
+const (
+	OnboardingIncomplete = "incomplete"
+	OnboardingComplete   = "complete"
+)
+
+// IsOnboarded reports whether email has saved a profile since signing up.
+// It returns ErrNotFound when no credentials exist for email.
+func (s *PostgresStore) IsOnboarded(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var onboarded bool
+	err := DB.QueryRowContext(ctx, "SELECT onboarded_at IS NOT NULL FROM user_credentials WHERE email = $1", email).Scan(&onboarded)
+	if err != nil {
+		return false, fmt.Errorf("failed to read onboarding state: %w", classify(err))
+	}
+	return onboarded, nil
+}
+
+// MarkOnboarded records that email finished onboarding. Later calls keep the
+// original time.
+func (s *PostgresStore) MarkOnboarded(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "UPDATE user_credentials SET onboarded_at = COALESCE(onboarded_at, NOW()) WHERE email = $1", email)
+	if err != nil {
+		return fmt.Errorf("failed to record onboarding: %w", classify(err))
+	}
+	return nil
+}
+
+// SaveOnboardingProfile saves profile and marks its account onboarded. When
+// profiles and credentials both live in Postgres this is one transaction
+// holding the credentials row lock, so it cannot interleave with a signup or
+// account deletion of the same email. Otherwise the profile is written
+// first, so an account is never marked onboarded without one.
+func SaveOnboardingProfile(ctx context.Context, users UserRepository, credentials CredentialRepository, profile *UserProfile) error {
+	if _, ok := users.(*PostgresStore); ok {
+		if _, ok := credentials.(*PostgresStore); ok {
+			return saveOnboardingProfileTx(ctx, profile)
+		}
+	}
+
+	if err := users.SaveProfile(ctx, profile); err != nil {
+		return err
+	}
+	return credentials.MarkOnboarded(ctx, profile.Email)
+}
+
+func saveOnboardingProfileTx(ctx context.Context, profile *UserProfile) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var onboarded bool
+	err = tx.QueryRowContext(ctx, "SELECT onboarded_at IS NOT NULL FROM user_credentials WHERE email = $1 FOR UPDATE", profile.Email).Scan(&onboarded)
+	if err != nil {
+		return fmt.Errorf("failed to lock credentials: %w", classify(err))
+	}
+
+	if err := upsertProfile(ctx, tx, profile); err != nil {
+		return err
+	}
+	if !onboarded {
+		if _, err := tx.ExecContext(ctx, "UPDATE user_credentials SET onboarded_at = NOW() WHERE email = $1", profile.Email); err != nil {
+			return fmt.Errorf("failed to record onboarding: %w", classify(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit profile: %w", classify(err))
+	}
+	return nil
+}
+
+// OnboardingState returns OnboardingComplete or OnboardingIncomplete for
+// email. Accounts whose profile predates onboarding tracking, or was saved
+// to another backend, are marked onboarded on the way.
+func OnboardingState(ctx context.Context, users UserRepository, credentials CredentialRepository, email string) (string, error) {
+	onboarded, err := credentials.IsOnboarded(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if onboarded {
+		return OnboardingComplete, nil
+	}
+
+	exists, err := users.ProfileExists(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return OnboardingIncomplete, nil
+	}
+	if err := credentials.MarkOnboarded(ctx, email); err != nil {
+		return "", err
+	}
+	return OnboardingComplete, nil
+}
@@ -0,0 +1,55 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// QueryTimeout bounds every repository call, so a hung database fails the
+// request instead of stalling it. Set it with DB_QUERY_TIMEOUT.
+var QueryTimeout = envDuration("DB_QUERY_TIMEOUT", 5*time.Second)
+
+// configurePool applies the DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS,
+// DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME settings.
+func configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(envInt("DB_MAX_OPEN_CONNS", 25))
+	db.SetMaxIdleConns(envInt("DB_MAX_IDLE_CONNS", 5))
+	db.SetConnMaxLifetime(envDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute))
+	db.SetConnMaxIdleTime(envDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute))
+}
+
+// withTimeout derives the context of a single repository call from ctx,
+// which is usually the request context so client disconnects cancel it.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, QueryTimeout)
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		fmt.Printf("⚠️  Invalid %s %q, using %d\n", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		fmt.Printf("⚠️  Invalid %s %q, using %s\n", name, value, fallback)
+		return fallback
+	}
+	return d
+}
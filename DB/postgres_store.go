@@ -0,0 +1,148 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+)
+
+// PostgresStore implements the repositories on the Postgres connection in DB.
+type PostgresStore struct{}
+
+var _ Store = (*PostgresStore)(nil)
+
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{}
+}
+
+const profileColumns = `email, name, gender, age, activity_level, goals, height, weight,
+	target_weight, diseases, diet_plan, healthscore, dm`
+
+func scanProfile(row interface{ Scan(...interface{}) error }) (*UserProfile, error) {
+	var p UserProfile
+	err := row.Scan(&p.Email, &p.Name, &p.Gender, &p.Age, &p.ActivityLevel, &p.Goals, &p.Height,
+		&p.Weight, &p.TargetWeight, &p.Diseases, &p.DietPlan, &p.Healthscore, &p.DM)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *PostgresStore) GetProfile(ctx context.Context, email string) (*UserProfile, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	p, err := scanProfile(DB.QueryRowContext(ctx, "SELECT "+profileColumns+" FROM user_details WHERE email = $1", email))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", classify(err))
+	}
+	return p, nil
+}
+
+func (s *PostgresStore) SaveProfile(ctx context.Context, profile *UserProfile) error {
+	return InsertUserData(ctx, profile)
+}
+
+func (s *PostgresStore) ListProfiles(ctx context.Context) ([]UserProfile, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, "SELECT "+profileColumns+" FROM user_details ORDER BY email")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", classify(err))
+	}
+	defer rows.Close()
+
+	profiles := []UserProfile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan profile: %w", classify(err))
+		}
+		profiles = append(profiles, *p)
+	}
+	return profiles, classify(rows.Err())
+}
+
+func (s *PostgresStore) ProfileExists(ctx context.Context, email string) (bool, error) {
+	return CheckEmailExists(ctx, email)
+}
+
+func (s *PostgresStore) UpdateDiet(ctx context.Context, email string, diet string) error {
+	return UpdateDiet(ctx, email, diet)
+}
+
+// DeleteProfile removes the user_details row; meal, weight and health score
+// entries cascade with it.
+func (s *PostgresStore) DeleteProfile(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := DB.ExecContext(ctx, "DELETE FROM user_details WHERE email = $1", email); err != nil {
+		return fmt.Errorf("failed to delete profile: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *PostgresStore) CreateCredentials(ctx context.Context, email string, passwordHash string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "INSERT INTO user_credentials (email, password) VALUES ($1, $2)", email, passwordHash)
+	if err != nil {
+		return fmt.Errorf("failed to insert user credentials: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *PostgresStore) AddMealEntry(ctx context.Context, email string, entry MealEntry) (int64, error) {
+	return AddMealEntry(ctx, email, entry)
+}
+
+func (s *PostgresStore) ListMealEntries(ctx context.Context, email string) ([]MealEntry, error) {
+	return ListMealEntries(ctx, email)
+}
+
+func (s *PostgresStore) AddWeightEntry(ctx context.Context, email string, entry WeightEntry) (int64, error) {
+	return AddWeightEntry(ctx, email, entry)
+}
+
+func (s *PostgresStore) ListWeightEntries(ctx context.Context, email string) ([]WeightEntry, error) {
+	return ListWeightEntries(ctx, email)
+}
+
+func (s *PostgresStore) RecordHealthScore(ctx context.Context, email string, change HealthScoreChange) (bool, error) {
+	return RecordHealthScore(ctx, email, change)
+}
+
+func (s *PostgresStore) ListHealthScores(ctx context.Context, email string) ([]HealthScoreChange, error) {
+	return ListHealthScores(ctx, email)
+}
+
+func (s *PostgresStore) SendMessage(ctx context.Context, email string, text string) error {
+	return UpdateDM(ctx, email, text)
+}
+
+func (s *PostgresStore) ListMessages(ctx context.Context) ([]Message, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT email, name, dm FROM user_details
+		WHERE dm IS NOT NULL AND dm <> ''
+		ORDER BY name, email
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", classify(err))
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.Email, &m.Name, &m.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", classify(err))
+		}
+		messages = append(messages, m)
+	}
+	return messages, classify(rows.Err())
+}
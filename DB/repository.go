@@ -0,0 +1,255 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// The repositories below are what handlers depend on instead of the DB
+// global, so they can run against PostgresStore in production and against
+// MemoryStore in the handler tests and in demos (DATA_BACKEND=memory).
+// Every method takes the context of the request it serves and is bounded by
+// QueryTimeout. Failures are classified as ErrNotFound (a missing record,
+// which also matches sql.ErrNoRows), ErrConflict or ErrUnavailable.
+
+// UserProfile is the user_details row filled in through /form.
+type UserProfile struct {
+	Email         string  `json:"email" bson:"_id"`
+	Name          string  `json:"name" bson:"name"`
+	Gender        string  `json:"gender" bson:"gender"`
+	Age           int     `json:"age" bson:"age"`
+	ActivityLevel string  `json:"activity_level" bson:"activity_level"`
+	Goals         string  `json:"goals" bson:"goals"`
+	Height        float64 `json:"height" bson:"height"`
+	Weight        float64 `json:"weight" bson:"weight"`
+	TargetWeight  float64 `json:"target_weight" bson:"target_weight"`
+	Diseases      string  `json:"diseases" bson:"diseases"`
+	DietPlan      *string `json:"diet_plan" bson:"diet_plan,omitempty"`
+	Healthscore   int     `json:"healthscore" bson:"healthscore"`
+	DM            *string `json:"dm" bson:"dm,omitempty"`
+}
+
+// Message is the latest message a user sent to the nutritionists.
+type Message struct {
+	Email string
+	Name  string
+	Text  string
+}
+
+// UserRepository stores user profiles.
+type UserRepository interface {
+	// GetProfile returns the profile of email.
+	GetProfile(ctx context.Context, email string) (*UserProfile, error)
+	// SaveProfile creates or replaces the form fields and health score of
+	// a profile, keeping its diet plan and message.
+	SaveProfile(ctx context.Context, profile *UserProfile) error
+	ListProfiles(ctx context.Context) ([]UserProfile, error)
+	ProfileExists(ctx context.Context, email string) (bool, error)
+	UpdateDiet(ctx context.Context, email string, diet string) error
+	// DeleteProfile removes the profile of email with its meals, weights,
+	// health scores and message.
+	DeleteProfile(ctx context.Context, email string) error
+}
+
+// CredentialRepository stores login credentials and whether their owner
+// finished onboarding.
+type CredentialRepository interface {
+	// CreateCredentials returns ErrConflict when email is already taken.
+	CreateCredentials(ctx context.Context, email string, passwordHash string) error
+	GetPasswordHash(ctx context.Context, email string) (string, error)
+	CredentialsExist(ctx context.Context, email string) (bool, error)
+	IsOnboarded(ctx context.Context, email string) (bool, error)
+	MarkOnboarded(ctx context.Context, email string) error
+	// ImportCredential inserts an already hashed password unless email
+	// exists, returning the stored hash when it does.
+	ImportCredential(ctx context.Context, email string, passwordHash string) (bool, string, error)
+}
+
+// SessionRepository stores login sessions by the hash of their token.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, tokenHash string, email string, expiresAt time.Time) error
+	// GetSessionEmail returns ErrNotFound for unknown, expired or revoked
+	// sessions.
+	GetSessionEmail(ctx context.Context, tokenHash string) (string, error)
+	RevokeSession(ctx context.Context, tokenHash string) error
+	RevokeUserSessions(ctx context.Context, email string) error
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+}
+
+// RoleRepository stores the role of every account.
+type RoleRepository interface {
+	GetUserRole(ctx context.Context, email string) (string, error)
+	SetUserRole(ctx context.Context, email string, role string) error
+	ListUsersByRole(ctx context.Context, role string) ([]string, error)
+}
+
+// APITokenRepository stores personal API tokens by their hash.
+type APITokenRepository interface {
+	CreateAPIToken(ctx context.Context, email string, name string, tokenHash string, scopes []string) (int64, error)
+	ListAPITokens(ctx context.Context, email string) ([]APIToken, error)
+	RevokeAPIToken(ctx context.Context, email string, id int64) error
+	UseAPIToken(ctx context.Context, tokenHash string) (string, []string, error)
+}
+
+// UserTokenRepository stores the single-use password reset and email
+// verification tokens.
+type UserTokenRepository interface {
+	CreateUserToken(ctx context.Context, tokenHash string, email string, purpose string, expiresAt time.Time) error
+	ConsumeUserToken(ctx context.Context, tokenHash string, purpose string) (string, error)
+	// ResetPassword consumes a reset token, stores the new password hash
+	// and revokes the sessions and lockout of its owner.
+	ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (string, error)
+	SetEmailVerified(ctx context.Context, email string) error
+	IsEmailVerified(ctx context.Context, email string) (bool, error)
+}
+
+// TwoFactorRepository stores TOTP enrollments and recovery codes.
+type TwoFactorRepository interface {
+	SaveTOTPSecret(ctx context.Context, email string, secret string) error
+	GetTOTPSecret(ctx context.Context, email string) (*TOTPSecret, error)
+	IsTOTPEnabled(ctx context.Context, email string) (bool, error)
+	UseTOTPStep(ctx context.Context, email string, step int64) (bool, error)
+	EnableTOTP(ctx context.Context, email string, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, email string, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, email string) (int, error)
+	DeleteTOTP(ctx context.Context, email string) error
+}
+
+// IdentityRepository links external identities, e.g. Google accounts, to
+// emails.
+type IdentityRepository interface {
+	GetIdentityEmail(ctx context.Context, provider string, subject string) (string, error)
+	LinkIdentity(ctx context.Context, provider string, subject string, email string) (bool, error)
+}
+
+// LockoutRepository stores failed-login counters and lockout events.
+type LockoutRepository interface {
+	CountLoginAttempt(ctx context.Context, scope string, key string, window time.Duration, lockout func(failures int) time.Duration) (LoginCount, error)
+	ReleaseLoginAttempt(ctx context.Context, scope string, key string, count LoginCount) error
+	RecordLockout(ctx context.Context, scope string, email string, ip string, failures int, lockedUntil time.Time) error
+	ClearLoginFailures(ctx context.Context, scope string, key string) error
+	UnlockAccount(ctx context.Context, email string, admin string) error
+	ListLockoutEvents(ctx context.Context, activeOnly bool, limit int) ([]LockoutEvent, error)
+}
+
+// AuditRepository stores the append-only audit log.
+type AuditRepository interface {
+	// InsertAuditEvent appends e, setting its ID and time.
+	InsertAuditEvent(ctx context.Context, e AuditEvent) error
+	QueryAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+}
+
+// DeletionRepository stores account deletion requests and erases accounts.
+type DeletionRepository interface {
+	ReadCredentialsInfo(ctx context.Context, email string) (*CredentialsInfo, error)
+	RequestAccountDeletion(ctx context.Context, email string, grace time.Duration) (*AccountDeletion, error)
+	GetAccountDeletion(ctx context.Context, email string) (*AccountDeletion, error)
+	CancelAccountDeletion(ctx context.Context, email string) error
+	// ListDueAccountDeletions returns the emails whose grace period ended.
+	ListDueAccountDeletions(ctx context.Context) ([]string, error)
+	// DeleteAccount removes the credentials of email with everything
+	// attached to them and pseudonymises what is kept.
+	DeleteAccount(ctx context.Context, email string) error
+}
+
+// AccountRepository bundles everything stored about accounts besides their
+// profile data.
+type AccountRepository interface {
+	CredentialRepository
+	SessionRepository
+	RoleRepository
+	APITokenRepository
+	UserTokenRepository
+	TwoFactorRepository
+	IdentityRepository
+	LockoutRepository
+	AuditRepository
+	DeletionRepository
+}
+
+// Accounts is the account storage used by the Auth package and the account
+// handlers, which reach it from middleware and helpers that have no store
+// injected. It is set to the store picked by DATA_BACKEND on startup.
+var Accounts AccountRepository = NewPostgresStore()
+
+// MealRepository stores tracked meals.
+type MealRepository interface {
+	AddMealEntry(ctx context.Context, email string, entry MealEntry) (int64, error)
+	ListMealEntries(ctx context.Context, email string) ([]MealEntry, error)
+}
+
+// WeightRepository stores the weight log.
+type WeightRepository interface {
+	// AddWeightEntry logs a measurement. When it is the most recent one the
+	// profile weight follows it.
+	AddWeightEntry(ctx context.Context, email string, entry WeightEntry) (int64, error)
+	// ListWeightEntries returns the measurements of email, oldest first.
+	ListWeightEntries(ctx context.Context, email string) ([]WeightEntry, error)
+}
+
+// HealthScoreRepository stores the health score of a profile with its
+// history.
+type HealthScoreRepository interface {
+	// RecordHealthScore sets the score and appends change to the history
+	// unless the last entry has the same score, rule version and breakdown,
+	// reporting whether it did.
+	RecordHealthScore(ctx context.Context, email string, change HealthScoreChange) (bool, error)
+	// ListHealthScores returns the history of email, oldest first.
+	ListHealthScores(ctx context.Context, email string) ([]HealthScoreChange, error)
+}
+
+// MessageRepository stores messages from users to the nutritionists.
+type MessageRepository interface {
+	SendMessage(ctx context.Context, email string, text string) error
+	// ListMessages returns every user with a message.
+	ListMessages(ctx context.Context) ([]Message, error)
+}
+
+// Store bundles the repositories of one storage backend, so a deployment
+// needs no database besides the one it picked.
+type Store interface {
+	UserRepository
+	MealRepository
+	WeightRepository
+	HealthScoreRepository
+	MessageRepository
+	AccountRepository
+}
+
+// UsesPostgres reports whether DATA_BACKEND selects the Postgres store, the
+// only one that needs ConnectPsql and the migrations.
+func UsesPostgres() bool {
+	backend := os.Getenv("DATA_BACKEND")
+	return backend == "" || backend == "postgres"
+}
+
+// NewStoreFromEnv returns the store selected by DATA_BACKEND: "postgres"
+// (the default) uses the connection in DB, "mongo" connects to MONGO_URI and
+// keeps its collections in MONGO_DB (default "bb") and "memory" keeps
+// everything in process memory, lost on restart.
+func NewStoreFromEnv() (Store, error) {
+	switch backend := os.Getenv("DATA_BACKEND"); backend {
+	case "", "postgres":
+		return NewPostgresStore(), nil
+	case "mongo":
+		uri := os.Getenv("MONGO_URI")
+		if uri == "" {
+			return nil, fmt.Errorf("MONGO_URI is required when DATA_BACKEND=mongo")
+		}
+		name := os.Getenv("MONGO_DB")
+		if name == "" {
+			name = "bb"
+		}
+		database, err := NewDatabase(uri)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+		}
+		return NewMongoStore(database, name)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown DATA_BACKEND %q (postgres, mongo or memory)", backend)
+	}
+}
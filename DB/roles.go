@@ -0,0 +1,63 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// GetUserRole returns the role stored for email in user_credentials.
+// It returns ErrNotFound when no credentials exist for email.
+func (s *PostgresStore) GetUserRole(ctx context.Context, email string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var role string
+	err := DB.QueryRowContext(ctx, "SELECT role FROM user_credentials WHERE email = $1", email).Scan(&role)
+	if err != nil {
+		return "", fmt.Errorf("failed to read role: %w", classify(err))
+	}
+	return role, nil
+}
+
+// SetUserRole updates the role of an existing user.
+// It returns ErrNotFound when no credentials exist for email.
+func (s *PostgresStore) SetUserRole(ctx context.Context, email string, role string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, "UPDATE user_credentials SET role = $1 WHERE email = $2", role, email)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", classify(err))
+	}
+	if n == 0 {
+		return classify(sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ListUsersByRole returns the emails of every user holding role.
+func (s *PostgresStore) ListUsersByRole(ctx context.Context, role string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, "SELECT email FROM user_credentials WHERE role = $1 ORDER BY email", role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users by role: %w", classify(err))
+	}
+	defer rows.Close()
+
+	emails := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, classify(err)
+		}
+		emails = append(emails, email)
+	}
+	return emails, classify(rows.Err())
+}
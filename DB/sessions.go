@@ -0,0 +1,83 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CreateSession stores a new session for email. Only the SHA-256 hash of the
+// session token is persisted, so a leaked table cannot be replayed as cookies.
+func (s *PostgresStore) CreateSession(ctx context.Context, tokenHash string, email string, expiresAt time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO user_sessions (token_hash, email, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err := DB.ExecContext(ctx, query, tokenHash, email, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", classify(err))
+	}
+	return nil
+}
+
+// GetSessionEmail returns the email owning an active (not expired, not revoked)
+// session. It returns ErrNotFound when the session is unknown or inactive.
+func (s *PostgresStore) GetSessionEmail(ctx context.Context, tokenHash string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT email FROM user_sessions
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+	var email string
+	err := DB.QueryRowContext(ctx, query, tokenHash).Scan(&email)
+	if err != nil {
+		return "", fmt.Errorf("failed to read session: %w", classify(err))
+	}
+	return email, nil
+}
+
+// RevokeSession marks a single session as revoked.
+func (s *PostgresStore) RevokeSession(ctx context.Context, tokenHash string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "UPDATE user_sessions SET revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL", tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", classify(err))
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every active session belonging to email.
+func (s *PostgresStore) RevokeUserSessions(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "UPDATE user_sessions SET revoked_at = NOW() WHERE email = $1 AND revoked_at IS NULL", email)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", classify(err))
+	}
+	return nil
+}
+
+// DeleteExpiredSessions removes sessions that expired or were revoked more
+// than a day ago.
+func (s *PostgresStore) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, `
+		DELETE FROM user_sessions
+		WHERE expires_at < NOW() - INTERVAL '1 day'
+		   OR revoked_at < NOW() - INTERVAL '1 day'
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", classify(err))
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,145 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Purposes of single-use tokens stored in user_tokens
+const (
+	TokenPasswordReset = "password_reset"
+	TokenEmailVerify   = "email_verify"
+)
+
+// CreateUserToken stores the hash of a single-use token for email. Any
+// earlier unused token with the same purpose is invalidated so only the most
+// recent link works.
+func (s *PostgresStore) CreateUserToken(ctx context.Context, tokenHash string, email string, purpose string, expiresAt time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE email = $1 AND purpose = $2 AND used_at IS NULL
+	`, email, purpose)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate previous tokens: %w", classify(err))
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_tokens (token_hash, email, purpose, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, tokenHash, email, purpose, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", classify(err))
+	}
+
+	return classify(tx.Commit())
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns the
+// email it was issued for. It returns ErrNotFound when the token is
+// unknown, expired or already used.
+func (s *PostgresStore) ConsumeUserToken(ctx context.Context, tokenHash string, purpose string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var email string
+	err := DB.QueryRowContext(ctx, `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING email
+	`, tokenHash, purpose).Scan(&email)
+	if err != nil {
+		return "", fmt.Errorf("failed to consume token: %w", classify(err))
+	}
+	return email, nil
+}
+
+// ResetPassword consumes a password reset token and stores the new password
+// hash in one transaction, revoking every session of the user and lifting
+// any login lockout.
+// It returns ErrNotFound when the token is invalid.
+func (s *PostgresStore) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var email string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING email
+	`, tokenHash, TokenPasswordReset).Scan(&email)
+	if err != nil {
+		return "", fmt.Errorf("failed to consume token: %w", classify(err))
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE user_credentials SET password = $1 WHERE email = $2", passwordHash, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to update password: %w", classify(err))
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE user_sessions SET revoked_at = NOW() WHERE email = $1 AND revoked_at IS NULL", email)
+	if err != nil {
+		return "", fmt.Errorf("failed to revoke sessions: %w", classify(err))
+	}
+
+	// A successful reset proves ownership, so lift any login lockout too
+	_, err = tx.ExecContext(ctx, "DELETE FROM login_failures WHERE scope = $1 AND key = $2", LockoutScopeAccount, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to clear login failures: %w", classify(err))
+	}
+
+	return email, classify(tx.Commit())
+}
+
+// SetEmailVerified marks the email of a user as verified.
+func (s *PostgresStore) SetEmailVerified(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := DB.ExecContext(ctx, "UPDATE user_credentials SET email_verified_at = NOW() WHERE email = $1 AND email_verified_at IS NULL", email)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", classify(err))
+	}
+	return nil
+}
+
+// IsEmailVerified reports whether email has completed verification.
+func (s *PostgresStore) IsEmailVerified(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var verified bool
+	err := DB.QueryRowContext(ctx, "SELECT email_verified_at IS NOT NULL FROM user_credentials WHERE email = $1", email).Scan(&verified)
+	if err != nil {
+		return false, fmt.Errorf("failed to read email verification: %w", classify(err))
+	}
+	return verified, nil
+}
+
+// CredentialsExist reports whether a user_credentials row exists for email.
+func (s *PostgresStore) CredentialsExist(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM user_credentials WHERE email = $1)", email).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check credentials: %w", classify(err))
+	}
+	return exists, nil
+}
@@ -0,0 +1,169 @@
+package DB
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTwoFactorEnabled is returned when enrolling a user whose two-factor
+// authentication is already enabled
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+// TOTPSecret is the TOTP enrollment of a user. Enabled is false while the
+// enrollment awaits its confirmation code.
+type TOTPSecret struct {
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+// SaveTOTPSecret stores a new, not yet enabled TOTP secret for email,
+// replacing any pending enrollment. An enabled secret is never replaced.
+func (s *PostgresStore) SaveTOTPSecret(ctx context.Context, email string, secret string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, `
+		INSERT INTO user_totp (email, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (email) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+		WHERE user_totp.enabled_at IS NULL
+	`, email, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP secret: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP secret: %w", classify(err))
+	}
+	if n == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// GetTOTPSecret returns the TOTP enrollment of email.
+// It returns ErrNotFound when the user never enrolled.
+func (s *PostgresStore) GetTOTPSecret(ctx context.Context, email string) (*TOTPSecret, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var t TOTPSecret
+	err := DB.QueryRowContext(ctx, `
+		SELECT secret, enabled_at IS NOT NULL, last_used_step FROM user_totp WHERE email = $1
+	`, email).Scan(&t.Secret, &t.Enabled, &t.LastUsedStep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TOTP secret: %w", classify(err))
+	}
+	return &t, nil
+}
+
+// IsTOTPEnabled reports whether email has confirmed TOTP enrollment.
+func (s *PostgresStore) IsTOTPEnabled(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var enabled bool
+	err := DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM user_totp WHERE email = $1 AND enabled_at IS NOT NULL)", email).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to read TOTP status: %w", classify(err))
+	}
+	return enabled, nil
+}
+
+// UseTOTPStep records step as the last accepted time step, refusing a step
+// that is not newer than the previous one so a code can't be replayed.
+func (s *PostgresStore) UseTOTPStep(ctx context.Context, email string, step int64) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, "UPDATE user_totp SET last_used_step = $1 WHERE email = $2 AND last_used_step < $1", step, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP use: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	return n == 1, classify(err)
+}
+
+// EnableTOTP confirms the enrollment of email and replaces its recovery codes
+// with codeHashes in one transaction.
+func (s *PostgresStore) EnableTOTP(ctx context.Context, email string, codeHashes []string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE user_totp SET enabled_at = NOW() WHERE email = $1", email)
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", classify(err))
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE email = $1", email)
+	if err != nil {
+		return fmt.Errorf("failed to clear recovery codes: %w", classify(err))
+	}
+
+	for _, h := range codeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (email, code_hash) VALUES ($1, $2)", email, h)
+		if err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", classify(err))
+		}
+	}
+
+	return classify(tx.Commit())
+}
+
+// UseRecoveryCode marks an unused recovery code of email as used and reports
+// whether one matched.
+func (s *PostgresStore) UseRecoveryCode(ctx context.Context, email string, codeHash string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, `
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE email = $1 AND code_hash = $2 AND used_at IS NULL
+	`, email, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", classify(err))
+	}
+	n, err := res.RowsAffected()
+	return n == 1, classify(err)
+}
+
+// CountRecoveryCodes returns how many unused recovery codes email has left.
+func (s *PostgresStore) CountRecoveryCodes(ctx context.Context, email string) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var n int
+	err := DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_recovery_codes WHERE email = $1 AND used_at IS NULL", email).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", classify(err))
+	}
+	return n, nil
+}
+
+// DeleteTOTP removes the TOTP enrollment and recovery codes of email.
+func (s *PostgresStore) DeleteTOTP(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_totp WHERE email = $1", email); err != nil {
+		return fmt.Errorf("failed to delete TOTP secret: %w", classify(err))
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE email = $1", email); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", classify(err))
+	}
+	return classify(tx.Commit())
+}
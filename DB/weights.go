@@ -0,0 +1,87 @@
+package DB
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Weight entry sources: the profile form, a tracked meal or a direct log
+const (
+	WeightSourceForm   = "form"
+	WeightSourceMeal   = "meal"
+	WeightSourceManual = "manual"
+)
+
+// WeightEntry is one weight measurement in kg.
+type WeightEntry struct {
+	ID         int64     `json:"id"`
+	Weight     float64   `json:"weight"`
+	MeasuredAt time.Time `json:"measured_at"`
+	Source     string    `json:"source"`
+}
+
+// AddWeightEntry logs entry for email and returns its id. When entry is the
+// most recent measurement the profile weight is updated to match, in the
+// same transaction.
+func AddWeightEntry(ctx context.Context, email string, entry WeightEntry) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO weight_entries (email, weight, measured_at, source)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, email, entry.Weight, entry.MeasuredAt, entry.Source).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert weight entry: %w", classify(err))
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_details SET weight = $2
+		WHERE email = $1 AND NOT EXISTS (
+			SELECT 1 FROM weight_entries WHERE email = $1 AND measured_at > $3
+		)
+	`, email, entry.Weight, entry.MeasuredAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update profile weight: %w", classify(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit weight entry: %w", classify(err))
+	}
+	return id, nil
+}
+
+// ListWeightEntries returns the weight log of email, oldest first.
+func ListWeightEntries(ctx context.Context, email string) ([]WeightEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, weight, measured_at, source FROM weight_entries
+		WHERE email = $1
+		ORDER BY measured_at, id
+	`, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read weight entries: %w", classify(err))
+	}
+	defer rows.Close()
+
+	entries := []WeightEntry{}
+	for rows.Next() {
+		var e WeightEntry
+		if err := rows.Scan(&e.ID, &e.Weight, &e.MeasuredAt, &e.Source); err != nil {
+			return nil, fmt.Errorf("failed to scan weight entry: %w", classify(err))
+		}
+		entries = append(entries, e)
+	}
+	return entries, classify(rows.Err())
+}
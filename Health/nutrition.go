@@ -0,0 +1,109 @@
+package Health
+
+import (
+	"blissfulbites/DB"
+	"errors"
+	"math"
+	"strings"
+)
+
+// Goals of a calorie target
+const (
+	GoalLose     = "lose"
+	GoalMaintain = "maintain"
+	GoalGain     = "gain"
+)
+
+const (
+	// goalTolerance is how close to the target weight counts as there, in kg
+	goalTolerance = 0.5
+	// deficitCalories loses about 0.5 kg a week
+	deficitCalories = 500
+	// surplusCalories gains about 0.25 kg a week, mostly lean mass when
+	// combined with training
+	surplusCalories = 300
+	// Daily intake below these is not advised without medical supervision
+	minCaloriesFemale = 1200
+	minCaloriesMale   = 1500
+)
+
+// activityMultipliers turn BMR into TDEE for the activity levels of /form
+var activityMultipliers = map[string]float64{
+	"little":   1.2,
+	"moderate": 1.55,
+	"active":   1.725,
+}
+
+// ErrIncompleteProfile is returned when the profile lacks the age, height
+// or weight the targets are computed from.
+var ErrIncompleteProfile = errors.New("profile needs age, height and weight")
+
+// NutritionTargets are the daily energy needs of a profile in kcal.
+type NutritionTargets struct {
+	BMRMifflinStJeor   int     `json:"bmr_mifflin_st_jeor"`
+	BMRHarrisBenedict  int     `json:"bmr_harris_benedict"`
+	ActivityMultiplier float64 `json:"activity_multiplier"`
+	TDEE               int     `json:"tdee"`
+	Goal               string  `json:"goal"`
+	Adjustment         int     `json:"adjustment"`
+	DailyCalories      int     `json:"daily_calories"`
+	MinimumCalories    int     `json:"minimum_calories"`
+}
+
+// Targets computes the BMR of user with both Mifflin-St Jeor and the revised
+// Harris-Benedict equation, the TDEE from its activity level and a daily
+// calorie target moving it towards its target weight. TDEE and the target
+// use Mifflin-St Jeor, the more accurate of the two for today's population.
+// Genders other than male and female use the mean of both equations.
+func Targets(user DB.UserProfile) (NutritionTargets, error) {
+	if user.Age <= 0 || user.Height <= 0 || user.Weight <= 0 {
+		return NutritionTargets{}, ErrIncompleteProfile
+	}
+	w, h, a := user.Weight, user.Height, float64(user.Age)
+
+	mifflinMale := 10*w + 6.25*h - 5*a + 5
+	mifflinFemale := 10*w + 6.25*h - 5*a - 161
+	harrisMale := 88.362 + 13.397*w + 4.799*h - 5.677*a
+	harrisFemale := 447.593 + 9.247*w + 3.098*h - 4.330*a
+
+	var mifflin, harris float64
+	var minimum int
+	switch strings.ToLower(strings.TrimSpace(user.Gender)) {
+	case "male":
+		mifflin, harris, minimum = mifflinMale, harrisMale, minCaloriesMale
+	case "female":
+		mifflin, harris, minimum = mifflinFemale, harrisFemale, minCaloriesFemale
+	default:
+		mifflin, harris = (mifflinMale+mifflinFemale)/2, (harrisMale+harrisFemale)/2
+		minimum = (minCaloriesMale + minCaloriesFemale) / 2
+	}
+
+	multiplier, ok := activityMultipliers[strings.ToLower(strings.TrimSpace(user.ActivityLevel))]
+	if !ok {
+		multiplier = activityMultipliers["little"]
+	}
+	tdee := int(math.Round(mifflin * multiplier))
+
+	targets := NutritionTargets{
+		BMRMifflinStJeor:   int(math.Round(mifflin)),
+		BMRHarrisBenedict:  int(math.Round(harris)),
+		ActivityMultiplier: multiplier,
+		TDEE:               tdee,
+		Goal:               GoalMaintain,
+		MinimumCalories:    minimum,
+	}
+	switch {
+	case user.TargetWeight <= 0 || math.Abs(user.TargetWeight-user.Weight) <= goalTolerance:
+	case user.TargetWeight < user.Weight:
+		targets.Goal, targets.Adjustment = GoalLose, -deficitCalories
+	default:
+		targets.Goal, targets.Adjustment = GoalGain, surplusCalories
+	}
+
+	targets.DailyCalories = tdee + targets.Adjustment
+	if targets.DailyCalories < minimum {
+		targets.DailyCalories = minimum
+		targets.Adjustment = minimum - tdee
+	}
+	return targets, nil
+}
@@ -0,0 +1,67 @@
+package Health
+
+import (
+	"blissfulbites/DB"
+	"errors"
+	"testing"
+)
+
+func TestTargets(t *testing.T) {
+	tests := []struct {
+		name string
+		user DB.UserProfile
+		want NutritionTargets
+	}{
+		{
+			name: "man losing weight",
+			user: DB.UserProfile{Gender: "male", Age: 30, Height: 180, Weight: 80, TargetWeight: 75, ActivityLevel: "moderate"},
+			want: NutritionTargets{BMRMifflinStJeor: 1780, BMRHarrisBenedict: 1854, ActivityMultiplier: 1.55, TDEE: 2759, Goal: GoalLose, Adjustment: -500, DailyCalories: 2259, MinimumCalories: 1500},
+		},
+		{
+			name: "woman at her target",
+			user: DB.UserProfile{Gender: "Female", Age: 30, Height: 165, Weight: 60, TargetWeight: 60.4, ActivityLevel: "little"},
+			want: NutritionTargets{BMRMifflinStJeor: 1320, BMRHarrisBenedict: 1384, ActivityMultiplier: 1.2, TDEE: 1584, Goal: GoalMaintain, DailyCalories: 1584, MinimumCalories: 1200},
+		},
+		{
+			name: "deficit capped at the minimum",
+			user: DB.UserProfile{Gender: "female", Age: 70, Height: 150, Weight: 45, TargetWeight: 40, ActivityLevel: "little"},
+			want: NutritionTargets{BMRMifflinStJeor: 877, BMRHarrisBenedict: 1025, ActivityMultiplier: 1.2, TDEE: 1052, Goal: GoalLose, Adjustment: 148, DailyCalories: 1200, MinimumCalories: 1200},
+		},
+		{
+			name: "other gender gaining weight",
+			user: DB.UserProfile{Gender: "nonbinary", Age: 40, Height: 170, Weight: 70, TargetWeight: 75, ActivityLevel: " Active "},
+			want: NutritionTargets{BMRMifflinStJeor: 1485, BMRHarrisBenedict: 1532, ActivityMultiplier: 1.725, TDEE: 2561, Goal: GoalGain, Adjustment: 300, DailyCalories: 2861, MinimumCalories: 1350},
+		},
+		{
+			name: "no target and unknown activity",
+			user: DB.UserProfile{Gender: "male", Age: 30, Height: 180, Weight: 80, ActivityLevel: "sometimes"},
+			want: NutritionTargets{BMRMifflinStJeor: 1780, BMRHarrisBenedict: 1854, ActivityMultiplier: 1.2, TDEE: 2136, Goal: GoalMaintain, DailyCalories: 2136, MinimumCalories: 1500},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Targets(tt.user)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTargetsIncompleteProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		user DB.UserProfile
+	}{
+		{"no age", DB.UserProfile{Height: 170, Weight: 70}},
+		{"no height", DB.UserProfile{Age: 30, Weight: 70}},
+		{"no weight", DB.UserProfile{Age: 30, Height: 170}},
+	}
+	for _, tt := range tests {
+		if _, err := Targets(tt.user); !errors.Is(err, ErrIncompleteProfile) {
+			t.Errorf("%s: got error %v, want ErrIncompleteProfile", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package Health
+
+import (
+	"blissfulbites/DB"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultRules is used unless HEALTH_SCORE_RULES names another file
+//
+//go:embed healthscore_rules.json
+var defaultRules []byte
+
+// Rules is a versioned health score configuration. A score starts at Base,
+// every factor adds the points of the range the profile falls in, and the
+// total is clamped to Min..Max and divided by Scale.
+type Rules struct {
+	Version        string        `json:"version"`
+	Base           int           `json:"base"`
+	Min            int           `json:"min"`
+	Max            int           `json:"max"`
+	Scale          int           `json:"scale"`
+	BMI            []BMIBand     `json:"bmi"`
+	Age            []Range       `json:"age"`
+	Activity       ActivityRule  `json:"activity"`
+	Conditions     ConditionRule `json:"conditions"`
+	TargetDistance []Range       `json:"target_distance"`
+}
+
+// Range matches values below Below, or up to and including UpTo. The last
+// range of a list sets neither and matches everything else.
+type Range struct {
+	Label  string   `json:"label"`
+	Below  *float64 `json:"below,omitempty"`
+	UpTo   *float64 `json:"up_to,omitempty"`
+	Points int      `json:"points"`
+}
+
+// BMIBand holds the BMI ranges of a group of people. Gender and the age
+// bounds are optional; the first band matching a profile is used, and the
+// last band must match everyone.
+type BMIBand struct {
+	Gender string  `json:"gender,omitempty"`
+	MinAge int     `json:"min_age,omitempty"`
+	MaxAge int     `json:"max_age,omitempty"`
+	Ranges []Range `json:"ranges"`
+}
+
+// ActivityRule gives the points of each activity level, matched without
+// regard to case. Unknown levels get Default.
+type ActivityRule struct {
+	Levels  map[string]int `json:"levels"`
+	Default int            `json:"default"`
+}
+
+// ConditionRule gives the points of each medical condition: its entry in
+// Overrides if any, PerCondition otherwise. A non-zero MaxDeduction caps the
+// total deduction.
+type ConditionRule struct {
+	PerCondition int            `json:"per_condition"`
+	Overrides    map[string]int `json:"overrides,omitempty"`
+	MaxDeduction int            `json:"max_deduction,omitempty"`
+}
+
+// Result is a computed health score with the factors that produced it.
+type Result struct {
+	Score       int                    `json:"score"`
+	Total       int                    `json:"total"`
+	Base        int                    `json:"base"`
+	RuleVersion string                 `json:"rule_version"`
+	Factors     []DB.HealthScoreFactor `json:"factors"`
+}
+
+var active *Rules
+
+// InitializeRules loads and validates the rules in path, or the built-in
+// rules when path is empty, and makes them the active rules.
+func InitializeRules(path string) error {
+	data := defaultRules
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to read health score rules: %w", err)
+		}
+	}
+
+	rules, err := ParseRules(data)
+	if err != nil {
+		return err
+	}
+	active = rules
+	return nil
+}
+
+// ActiveRules returns the rules set by InitializeRules, or the built-in rules
+// if it was never called.
+func ActiveRules() *Rules {
+	if active == nil {
+		rules, err := ParseRules(defaultRules)
+		if err != nil {
+			panic(err)
+		}
+		active = rules
+	}
+	return active
+}
+
+// ParseRules decodes and validates a rules file.
+func ParseRules(data []byte) (*Rules, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var rules Rules
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("invalid health score rules: %w", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid health score rules %s: %w", rules.Version, err)
+	}
+
+	// Levels and conditions are matched in lower case
+	rules.Activity.Levels = lowerKeys(rules.Activity.Levels)
+	rules.Conditions.Overrides = lowerKeys(rules.Conditions.Overrides)
+	return &rules, nil
+}
+
+// Validate reports every problem of r.
+func (r *Rules) Validate() error {
+	var errs []error
+	if r.Version == "" {
+		errs = append(errs, errors.New("version is required"))
+	}
+	if r.Scale <= 0 {
+		errs = append(errs, errors.New("scale must be positive"))
+	}
+	if r.Max <= r.Min {
+		errs = append(errs, errors.New("max must be greater than min"))
+	}
+
+	if len(r.BMI) == 0 {
+		errs = append(errs, errors.New("bmi: at least one band is required"))
+	}
+	for i, band := range r.BMI {
+		if band.MinAge < 0 || band.MaxAge < 0 || (band.MaxAge != 0 && band.MaxAge < band.MinAge) {
+			errs = append(errs, fmt.Errorf("bmi band %d: invalid age bounds", i))
+		}
+		errs = append(errs, validateRanges(fmt.Sprintf("bmi band %d", i), band.Ranges)...)
+	}
+	if n := len(r.BMI); n > 0 {
+		last := r.BMI[n-1]
+		if last.Gender != "" || last.MinAge != 0 || last.MaxAge != 0 {
+			errs = append(errs, errors.New("bmi: the last band must match every profile"))
+		}
+	}
+
+	errs = append(errs, validateRanges("age", r.Age)...)
+	errs = append(errs, validateRanges("target_distance", r.TargetDistance)...)
+	if len(r.Activity.Levels) == 0 {
+		errs = append(errs, errors.New("activity: at least one level is required"))
+	}
+	if r.Conditions.MaxDeduction < 0 {
+		errs = append(errs, errors.New("conditions: max_deduction must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func validateRanges(name string, ranges []Range) []error {
+	if len(ranges) == 0 {
+		return []error{fmt.Errorf("%s: at least one range is required", name)}
+	}
+
+	var errs []error
+	var previous *float64
+	for i, r := range ranges {
+		bound := r.bound()
+		last := i == len(ranges)-1
+		switch {
+		case r.Below != nil && r.UpTo != nil:
+			errs = append(errs, fmt.Errorf("%s range %d: set below or up_to, not both", name, i))
+		case bound == nil && !last:
+			errs = append(errs, fmt.Errorf("%s range %d: only the last range may be unbounded", name, i))
+		case bound != nil && last:
+			errs = append(errs, fmt.Errorf("%s range %d: the last range must be unbounded", name, i))
+		case bound != nil && previous != nil && *bound <= *previous:
+			errs = append(errs, fmt.Errorf("%s range %d: bounds must increase", name, i))
+		}
+		if bound != nil {
+			previous = bound
+		}
+	}
+	return errs
+}
+
+func (r Range) bound() *float64 {
+	if r.Below != nil {
+		return r.Below
+	}
+	return r.UpTo
+}
+
+func (r Range) matches(value float64) bool {
+	switch {
+	case r.Below != nil:
+		return value < *r.Below
+	case r.UpTo != nil:
+		return value <= *r.UpTo
+	default:
+		return true
+	}
+}
+
+func match(ranges []Range, value float64) Range {
+	for _, r := range ranges {
+		if r.matches(value) {
+			return r
+		}
+	}
+	return ranges[len(ranges)-1]
+}
+
+func lowerKeys(m map[string]int) map[string]int {
+	lower := make(map[string]int, len(m))
+	for k, v := range m {
+		lower[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	return lower
+}
@@ -0,0 +1,85 @@
+package Health
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDefaultRules(t *testing.T) {
+	rules, err := ParseRules(defaultRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.Version == "" || len(rules.BMI) == 0 {
+		t.Errorf("got %+v, want the built-in rules", rules)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"not JSON", `{`, "invalid health score rules"},
+		{"unknown field", `{"version": "v1", "bonus": 5}`, "unknown field"},
+		{"invalid rules", `{"version": "v2"}`, "invalid health score rules v2"},
+	}
+	for _, tt := range tests {
+		_, err := ParseRules([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	rules, err := ParseRules([]byte(strings.Replace(string(defaultRules), `"moderate": -5`, `" Moderate ": -5`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if points, ok := rules.Activity.Levels["moderate"]; !ok || points != -5 {
+		t.Errorf("activity levels %v, want moderate matched in lower case", rules.Activity.Levels)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bound := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		change  func(r *Rules)
+		wantErr string
+	}{
+		{"valid", func(r *Rules) {}, ""},
+		{"no version", func(r *Rules) { r.Version = "" }, "version is required"},
+		{"zero scale", func(r *Rules) { r.Scale = 0 }, "scale must be positive"},
+		{"max not above min", func(r *Rules) { r.Max = r.Min }, "max must be greater than min"},
+		{"no bmi bands", func(r *Rules) { r.BMI = nil }, "at least one band"},
+		{"inverted age bounds", func(r *Rules) { r.BMI[0].MinAge, r.BMI[0].MaxAge = 60, 30 }, "invalid age bounds"},
+		{"last band not catch-all", func(r *Rules) { r.BMI = r.BMI[:1] }, "last band must match every profile"},
+		{"no age ranges", func(r *Rules) { r.Age = nil }, "age: at least one range"},
+		{"bounded last range", func(r *Rules) { r.Age[2].UpTo = bound(120) }, "last range must be unbounded"},
+		{"unbounded middle range", func(r *Rules) { r.Age[1].UpTo = nil }, "only the last range may be unbounded"},
+		{"both bounds", func(r *Rules) { r.Age[0].UpTo = bound(17) }, "not both"},
+		{"decreasing bounds", func(r *Rules) { r.TargetDistance[1].UpTo = bound(4) }, "bounds must increase"},
+		{"no activity levels", func(r *Rules) { r.Activity.Levels = nil }, "at least one level"},
+		{"negative max deduction", func(r *Rules) { r.Conditions.MaxDeduction = -1 }, "must not be negative"},
+	}
+	for _, tt := range tests {
+		rules, err := ParseRules(defaultRules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.change(rules)
+
+		err = rules.Validate()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
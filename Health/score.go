@@ -0,0 +1,94 @@
+package Health
+
+import (
+	"blissfulbites/DB"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Score computes the health score of user with the active rules.
+func Score(user DB.UserProfile, bmi float64) Result {
+	return ActiveRules().Score(user, bmi)
+}
+
+// Score computes the health score of user. Every factor is listed, with 0
+// points when it has no impact, so the factors explain the whole score.
+func (r *Rules) Score(user DB.UserProfile, bmi float64) Result {
+	bmiRange := match(r.bmiBand(user).Ranges, bmi)
+	ageRange := match(r.Age, float64(user.Age))
+
+	activityPoints, ok := r.Activity.Levels[strings.ToLower(strings.TrimSpace(user.ActivityLevel))]
+	if !ok {
+		activityPoints = r.Activity.Default
+	}
+
+	conditions := Conditions(user.Diseases)
+	conditionPoints := 0
+	for _, c := range conditions {
+		if points, ok := r.Conditions.Overrides[strings.ToLower(c)]; ok {
+			conditionPoints += points
+		} else {
+			conditionPoints += r.Conditions.PerCondition
+		}
+	}
+	if r.Conditions.MaxDeduction > 0 && conditionPoints < -r.Conditions.MaxDeduction {
+		conditionPoints = -r.Conditions.MaxDeduction
+	}
+
+	distance := math.Abs(user.Weight - user.TargetWeight)
+	distanceRange := match(r.TargetDistance, distance)
+
+	factors := []DB.HealthScoreFactor{
+		{Factor: "bmi", Value: fmt.Sprintf("%.1f, %s", bmi, bmiRange.Label), Points: bmiRange.Points},
+		{Factor: "age", Value: fmt.Sprintf("%d, %s", user.Age, ageRange.Label), Points: ageRange.Points},
+		{Factor: "activity", Value: user.ActivityLevel, Points: activityPoints},
+		{Factor: "conditions", Value: strings.Join(conditions, ", "), Points: conditionPoints},
+		{Factor: "target_distance", Value: fmt.Sprintf("%.1f kg, %s", distance, distanceRange.Label), Points: distanceRange.Points},
+	}
+
+	total := r.Base
+	for _, f := range factors {
+		total += f.Points
+	}
+	if total < r.Min {
+		total = r.Min
+	} else if total > r.Max {
+		total = r.Max
+	}
+
+	return Result{
+		Score:       total / r.Scale,
+		Total:       total,
+		Base:        r.Base,
+		RuleVersion: r.Version,
+		Factors:     factors,
+	}
+}
+
+func (r *Rules) bmiBand(user DB.UserProfile) BMIBand {
+	for _, band := range r.BMI {
+		if band.Gender != "" && !strings.EqualFold(band.Gender, user.Gender) {
+			continue
+		}
+		if user.Age < band.MinAge || (band.MaxAge != 0 && user.Age > band.MaxAge) {
+			continue
+		}
+		return band
+	}
+	return r.BMI[len(r.BMI)-1]
+}
+
+// Conditions splits the comma separated diseases of a profile, skipping
+// blanks and "none".
+func Conditions(diseases string) []string {
+	conditions := []string{}
+	for _, c := range strings.Split(diseases, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" || strings.EqualFold(c, "none") {
+			continue
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions
+}
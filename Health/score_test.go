@@ -0,0 +1,101 @@
+package Health
+
+import (
+	"blissfulbites/DB"
+	"reflect"
+	"testing"
+)
+
+func TestConditions(t *testing.T) {
+	tests := []struct {
+		diseases string
+		want     []string
+	}{
+		{"", []string{}},
+		{"   ", []string{}},
+		{"none", []string{}},
+		{"None", []string{}},
+		{"diabetes", []string{"diabetes"}},
+		{"diabetes, hypertension", []string{"diabetes", "hypertension"}},
+		{"diabetes,,none, asthma ", []string{"diabetes", "asthma"}},
+	}
+	for _, tt := range tests {
+		if got := Conditions(tt.diseases); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Conditions(%q) = %q, want %q", tt.diseases, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	rules, err := ParseRules(defaultRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := func(change func(p *DB.UserProfile)) DB.UserProfile {
+		p := DB.UserProfile{Gender: "female", Age: 34, ActivityLevel: "active", Weight: 60, TargetWeight: 58}
+		change(&p)
+		return p
+	}
+
+	tests := []struct {
+		name       string
+		user       DB.UserProfile
+		bmi        float64
+		wantScore  int
+		wantTotal  int
+		wantPoints map[string]int
+	}{
+		{"healthy", profile(func(p *DB.UserProfile) {}), 22, 10, 100, nil},
+		{"no diseases costs nothing", profile(func(p *DB.UserProfile) { p.Diseases = "" }), 22, 10, 100, map[string]int{"conditions": 0}},
+		{"two conditions", profile(func(p *DB.UserProfile) { p.Diseases = "diabetes, asthma" }), 22, 9, 90, map[string]int{"conditions": -10}},
+		{"overweight", profile(func(p *DB.UserProfile) {}), 27, 9, 90, map[string]int{"bmi": -10}},
+		{"same BMI is normal over 65", profile(func(p *DB.UserProfile) { p.Age = 70 }), 26, 9, 90, map[string]int{"bmi": 0, "age": -10}},
+		{"activity in any case", profile(func(p *DB.UserProfile) { p.ActivityLevel = " Little " }), 22, 8, 85, map[string]int{"activity": -15}},
+		{"unknown activity", profile(func(p *DB.UserProfile) { p.ActivityLevel = "sometimes" }), 22, 10, 100, map[string]int{"activity": 0}},
+		{"far from target", profile(func(p *DB.UserProfile) { p.TargetWeight = 45 }), 22, 9, 90, map[string]int{"target_distance": -10}},
+		{"clamped at min", profile(func(p *DB.UserProfile) {
+			p.Age, p.ActivityLevel, p.TargetWeight = 70, "little", 30
+			p.Diseases = "a, b, c, d, e, f, g, h, i, j, k, l"
+		}), 40, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		result := rules.Score(tt.user, tt.bmi)
+		if result.Score != tt.wantScore || result.Total != tt.wantTotal {
+			t.Errorf("%s: score %d (total %d), want %d (total %d)", tt.name, result.Score, result.Total, tt.wantScore, tt.wantTotal)
+		}
+		if result.RuleVersion != rules.Version || len(result.Factors) != 5 {
+			t.Errorf("%s: got version %q and %d factors", tt.name, result.RuleVersion, len(result.Factors))
+		}
+		for _, f := range result.Factors {
+			if want, ok := tt.wantPoints[f.Factor]; ok && f.Points != want {
+				t.Errorf("%s: %s scored %d, want %d", tt.name, f.Factor, f.Points, want)
+			}
+		}
+	}
+}
+
+func TestScoreCapsConditionDeduction(t *testing.T) {
+	rules, err := ParseRules(defaultRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules.Conditions.MaxDeduction = 12
+	rules.Conditions.Overrides = map[string]int{"asthma": -2}
+
+	tests := []struct {
+		diseases string
+		want     int
+	}{
+		{"asthma", -2},
+		{"diabetes, Asthma", -7},
+		{"diabetes, hypertension, obesity", -12},
+	}
+	for _, tt := range tests {
+		user := DB.UserProfile{Age: 30, ActivityLevel: "active", Diseases: tt.diseases}
+		for _, f := range rules.Score(user, 22).Factors {
+			if f.Factor == "conditions" && f.Points != tt.want {
+				t.Errorf("%q: conditions scored %d, want %d", tt.diseases, f.Points, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package Mail
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sender delivers plain text emails
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPSender sends mail through an SMTP server using PLAIN auth
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// LogSender writes mail to the log and, when Path is set, appends it to a
+// file. It is meant for local development where no SMTP server exists.
+type LogSender struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewSenderFromEnv selects a sender with MAIL_SENDER ("smtp", "file" or
+// "log", the default) and configures it from the SMTP_* and MAIL_* variables.
+func NewSenderFromEnv() (Sender, error) {
+	switch strings.ToLower(os.Getenv("MAIL_SENDER")) {
+	case "smtp":
+		s := &SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		if s.Host == "" || s.From == "" {
+			return nil, fmt.Errorf("SMTP_HOST and MAIL_FROM are required for the smtp mail sender")
+		}
+		if s.Port == "" {
+			s.Port = "587"
+		}
+		return s, nil
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			path = "mail.log"
+		}
+		return &LogSender{Path: path}, nil
+	case "", "log":
+		return &LogSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_SENDER %q", os.Getenv("MAIL_SENDER"))
+	}
+}
+
+// Send delivers the message through the configured SMTP server
+func (s *SMTPSender) Send(to, subject, body string) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.From, to, subject, body)
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	err := smtp.SendMail(s.Host+":"+s.Port, auth, s.From, []string{to}, []byte(msg))
+	if err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", to, err)
+	}
+	return nil
+}
+
+// Send logs the message and appends it to Path if set
+func (s *LogSender) Send(to, subject, body string) error {
+	log.Printf("📧 Mail to %s: %s\n%s", to, subject, body)
+	if s.Path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "--- %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), to, subject, body)
+	return err
+}
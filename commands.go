@@ -0,0 +1,170 @@
+package main
+
+import (
+	Auth "blissfulbites/Auth"
+	DB "blissfulbites/DB"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// runCommand executes a maintenance subcommand such as
+// `blissfulbites set-role admin@example.com admin`
+func runCommand(args []string) error {
+	switch args[0] {
+	case "set-role":
+		return setRoleCommand(args[1:])
+	case "list-role":
+		return listRoleCommand(args[1:])
+	case "migrate-users":
+		return migrateUsersCommand(args[1:])
+	case "migrate":
+		return migrateCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q (available: set-role, list-role, migrate-users, migrate)", args[0])
+	}
+}
+
+func setRoleCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: blissfulbites set-role <email> <user|nutritionist|admin>")
+	}
+	email, role := args[0], args[1]
+	if !Auth.ValidRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	err := DB.Accounts.SetUserRole(context.Background(), email, role)
+	if errors.Is(err, DB.ErrNotFound) {
+		return fmt.Errorf("no user with email %s, sign up first", email)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ %s is now %s\n", email, role)
+	return nil
+}
+
+func listRoleCommand(args []string) error {
+	if len(args) != 1 || !Auth.ValidRole(args[0]) {
+		return fmt.Errorf("usage: blissfulbites list-role <user|nutritionist|admin>")
+	}
+	emails, err := DB.Accounts.ListUsersByRole(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+	for _, email := range emails {
+		fmt.Println(email)
+	}
+	return nil
+}
+
+// migrateUsersCommand imports the JSONAuth users.json into the credentials
+// of the DATA_BACKEND store
+func migrateUsersCommand(args []string) error {
+	fs := flag.NewFlagSet("migrate-users", flag.ContinueOnError)
+	file := fs.String("file", "users.json", "path of the JSONAuth users file")
+	verify := fs.Bool("verify-hashes", false, "skip users whose password is not a valid bcrypt hash")
+	dryRun := fs.Bool("dry-run", false, "report what would be imported without writing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := Auth.MigrateJSONUsers(context.Background(), *file, Auth.MigrateOptions{VerifyHashes: *verify, DryRun: *dryRun})
+	if err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("✅ %s %d users\n", verb, len(report.Imported))
+	for _, email := range report.Imported {
+		fmt.Println("   +", email)
+	}
+	fmt.Printf("⏭️  %d users already imported\n", len(report.Unchanged))
+	if len(report.Conflicts) > 0 {
+		fmt.Printf("⚠️  %d users exist with a different password and were left untouched:\n", len(report.Conflicts))
+		for _, email := range report.Conflicts {
+			fmt.Println("   !", email)
+		}
+	}
+	if len(report.Invalid) > 0 {
+		fmt.Printf("❌ %d entries skipped:\n", len(report.Invalid))
+		emails := make([]string, 0, len(report.Invalid))
+		for email := range report.Invalid {
+			emails = append(emails, email)
+		}
+		sort.Strings(emails)
+		for _, email := range emails {
+			fmt.Printf("   - %s: %s\n", email, report.Invalid[email])
+		}
+	}
+	return nil
+}
+
+// migrateCommand inspects or moves the schema version:
+// `blissfulbites migrate status|up [n]|down [n]`
+func migrateCommand(args []string) error {
+	usage := fmt.Errorf("usage: blissfulbites migrate status|up [n]|down [n]")
+	if !DB.UsesPostgres() {
+		return fmt.Errorf("migrate only applies to DATA_BACKEND=postgres")
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return usage
+	}
+	steps := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return usage
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			return usage
+		}
+		statuses, err := DB.MigrationStatuses()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			switch {
+			case s.Unknown:
+				fmt.Printf("❓ %04d (unknown to this binary)  applied %s\n", s.Version, s.AppliedAt.Format(time.RFC3339))
+			case s.Applied:
+				fmt.Printf("✅ %04d_%s  applied %s\n", s.Version, s.Name, s.AppliedAt.Format(time.RFC3339))
+			default:
+				fmt.Printf("⏳ %04d_%s  pending\n", s.Version, s.Name)
+			}
+		}
+		return nil
+	case "up":
+		n, err := DB.MigrateUp(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Applied %d migrations\n", n)
+		return nil
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		n, err := DB.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Reverted %d migrations\n", n)
+		return nil
+	default:
+		return usage
+	}
+}
@@ -5,10 +5,14 @@ import (
 	Auth "blissfulbites/Auth"
 	Controllers "blissfulbites/Controllers"
 	DB "blissfulbites/DB"
+	Health "blissfulbites/Health"
+	Mail "blissfulbites/Mail"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -28,27 +32,54 @@ func main() {
 	port := os.Getenv("PORT")
 	fmt.Printf("🌟 Using PORT: %s\n", port)
 
-	// Initialize Groq model
-	groqApiKey := os.Getenv("GROQ_API_KEY")
-	fmt.Printf("🔑 Using Groq API key: %s\n", groqApiKey)
-	AI.InitializeGroqModel(groqApiKey)
-	fmt.Println("✨ Groq model initialized.")
+	// Connect to PostgreSQL only when it holds the data
+	if DB.UsesPostgres() {
+		fmt.Println("🗄️  Connecting to PostgreSQL database...")
+		err = DB.ConnectPsql(os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_PASS"), os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_DB"))
+		if err != nil {
+			log.Fatalf("❌ Failed to connect to PostgreSQL database: %s", err)
+		} else {
+			fmt.Println("✅ Connected to PostgreSQL database successfully.")
+		}
+
+		// Run database migrations, unless the migrate command manages them by hand
+		if len(os.Args) < 2 || os.Args[1] != "migrate" {
+			fmt.Println("🔄 Running database migrations...")
+			err = DB.MigrateDB()
+			if err != nil {
+				log.Fatalf("❌ Failed to run database migrations: %s", err)
+			}
+		}
+	}
 
-	// Connect to PostgreSQL database
-	fmt.Println("🗄️  Connecting to PostgreSQL database...")
-	err = DB.ConnectPsql(os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_PASS"), os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_DB"))
+	// Handlers, Auth and the maintenance commands reach all data through the
+	// store picked by DATA_BACKEND
+	store, err := DB.NewStoreFromEnv()
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to PostgreSQL database: %s", err)
-	} else {
-		fmt.Println("✅ Connected to PostgreSQL database successfully.")
+		log.Fatalf("❌ Failed to open data store: %s", err)
+	}
+	DB.Accounts = store
+
+	// Run a maintenance command instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalf("❌ %s", err)
+		}
+		return
+	}
+
+	// Load the health score rules, refusing to start with an invalid file
+	if err := Health.InitializeRules(os.Getenv("HEALTH_SCORE_RULES")); err != nil {
+		log.Fatalf("❌ %s", err)
 	}
+	fmt.Printf("📏 Health score rules %s loaded.\n", Health.ActiveRules().Version)
 
-	// Run database migrations
-	fmt.Println("🔄 Running database migrations...")
-	err = DB.MigrateDB()
+	// Initialize the AI providers picked by AI_PROVIDER and AI_IMAGE_PROVIDER
+	textAI, imageAI, err := AI.NewProvidersFromEnv(context.Background())
 	if err != nil {
-		log.Fatalf("❌ Failed to run database migrations: %s", err)
+		log.Fatalf("❌ Failed to initialize AI providers: %s", err)
 	}
+	fmt.Println("✨ AI providers initialized.")
 
 	// Set up Gin server
 	fmt.Println("⚙️  Setting up server...")
@@ -68,8 +99,38 @@ func main() {
 	r.Static("/images", "./static/images")
 	r.Static("/intlTelInput", "./static/intlTelInput")
 
-	// Initialize DBAuth instance
-	auth := Auth.NewDBAuth()
+	// Initialize DBAuth instance, login throttling and session handling
+	auth := Auth.NewDBAuth(store)
+	guard := Auth.NewLoginGuard()
+	Auth.InitializeSessions()
+	Auth.StartSessionJanitor(time.Hour)
+
+	// Set up mail delivery for password reset and email verification
+	mailer, err := Mail.NewSenderFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Failed to configure mail sender: %s", err)
+	}
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+	recovery := Auth.NewAccountRecovery(mailer, baseURL)
+
+	// Deleted accounts are kept for a grace period before being purged
+	deletionGrace := 14 * 24 * time.Hour
+	if grace := os.Getenv("ACCOUNT_DELETION_GRACE"); grace != "" {
+		if d, err := time.ParseDuration(grace); err == nil && d >= 0 {
+			deletionGrace = d
+		} else {
+			fmt.Printf("⚠️  Invalid ACCOUNT_DELETION_GRACE %q, using %s\n", grace, deletionGrace)
+		}
+	}
+	DB.StartDeletionJanitor(time.Hour, store)
+
+	// Create or promote the first admin if requested
+	if err := Auth.BootstrapAdmin(context.Background(), auth); err != nil {
+		log.Fatalf("❌ Failed to bootstrap admin: %s", err)
+	}
 
 	// Define client endpoints
 	r.GET("/", func(c *gin.Context) {
@@ -84,73 +145,135 @@ func main() {
 		c.HTML(http.StatusOK, "signup.html", gin.H{})
 	})
 
-	r.GET("/dashboard", func(c *gin.Context) {
+	// Pages and endpoints below require an authenticated session
+	pages := r.Group("/", Auth.RequireSessionPage())
+	api := r.Group("/", Auth.RequireSession())
+	// Endpoints also reachable with a personal API token of the right scope
+	scripted := r.Group("/", Auth.RequireSessionOrToken())
+
+	pages.GET("/dashboard", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "Home.html", gin.H{})
 	})
 
-	r.GET("/form", func(c *gin.Context) {
+	pages.GET("/form", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "form.html", gin.H{})
 	})
 
-	r.GET("/track", func(c *gin.Context) {
+	pages.GET("/track", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "track.html", gin.H{})
 	})
 
-	r.GET("/contact", func(c *gin.Context) {
+	pages.GET("/contact", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "Contact.html", gin.H{})
 	})
 
-	r.POST("/contactUs", func(c *gin.Context) {
-		Controllers.ContactHandler(c)
+	api.POST("/contactUs", func(c *gin.Context) {
+		Controllers.ContactHandler(c, store)
+	})
+
+	api.POST("/userFormDetails", func(c *gin.Context) {
+		Controllers.FormHandler(c, store, store, store, store)
+	})
+
+	scripted.POST("/trackMeal", Auth.RequireScope(Auth.ScopeMealsWrite), func(c *gin.Context) {
+		Controllers.AppendMealsHandler(c, store, store, imageAI)
+	})
+
+	scripted.POST("/weight", Auth.RequireScope(Auth.ScopeWeightWrite), func(c *gin.Context) {
+		Controllers.LogWeightHandler(c, store)
+	})
+
+	scripted.GET("/weightHistory", Auth.RequireScope(Auth.ScopeProfileRead), func(c *gin.Context) {
+		Controllers.WeightHistoryHandler(c, store, store)
+	})
+
+	scripted.GET("/healthScoreHistory", Auth.RequireScope(Auth.ScopeProfileRead), func(c *gin.Context) {
+		Controllers.HealthScoreHistoryHandler(c, store)
 	})
 
-	r.POST("/userFormDetails", func(c *gin.Context) {
-		Controllers.FormHandler(c)
+	scripted.GET("/nutritionTargets", Auth.RequireScope(Auth.ScopeProfileRead), func(c *gin.Context) {
+		Controllers.NutritionTargetsHandler(c, store)
 	})
 
-	r.POST("/trackMeal", func(c *gin.Context) {
-		Controllers.AppendMealsHandler(c)
+	scripted.GET("/dailyNutrition", Auth.RequireScope(Auth.ScopeProfileRead), func(c *gin.Context) {
+		Controllers.DailyNutritionHandler(c, store)
 	})
 
-	r.GET("/userDetails", func(c *gin.Context) {
-		Controllers.FormUserDataHandler(c)
+	scripted.GET("/userDetails", Auth.RequireScope(Auth.ScopeProfileRead), func(c *gin.Context) {
+		Controllers.FormUserDataHandler(c, store, store, store)
 	})
 
-	r.GET("/userBasicInfo", func(c *gin.Context) {
-		Controllers.GetUserBasicInfo(c)
+	api.GET("/userBasicInfo", func(c *gin.Context) {
+		Controllers.GetUserBasicInfo(c, store)
 	})
 
-	r.GET("/userBMI", func(c *gin.Context) {
-		Controllers.GetUserBMI(c)
+	api.GET("/userBMI", func(c *gin.Context) {
+		Controllers.GetUserBMI(c, store)
 	})
 
-	r.GET("/userHealthScore", func(c *gin.Context) {
-		Controllers.GetUserHealthScore(c)
+	api.GET("/userHealthScore", func(c *gin.Context) {
+		Controllers.GetUserHealthScore(c, store)
 	})
 
-	r.GET("/firstlogin", func(c *gin.Context) {
-		Controllers.FirstLoginHandler(c)
+	api.GET("/me", func(c *gin.Context) {
+		Controllers.CurrentUserHandler(c, store, store)
 	})
 
-	r.POST("/genDietPlan", func(c *gin.Context) {
-		Controllers.GenDietPlan(c)
+	api.GET("/firstlogin", func(c *gin.Context) {
+		Controllers.FirstLoginHandler(c, store, store)
 	})
 
-	// Define admin endpoints
-	r.GET("/admin", func(c *gin.Context) {
-		Controllers.AllUsersDataHandler(c)
+	scripted.POST("/genDietPlan", Auth.RequireScope(Auth.ScopeDietWrite), func(c *gin.Context) {
+		Controllers.GenDietPlan(c, store, textAI)
 	})
 
-	r.GET("/dm", func(c *gin.Context) {
-		Controllers.DmHandler(c)
+	scripted.POST("/genDietPlan/stream", Auth.RequireScope(Auth.ScopeDietWrite), func(c *gin.Context) {
+		Controllers.StreamDietPlanHandler(c, store, textAI)
 	})
 
-	r.GET("/user", func(c *gin.Context) {
+	// Define admin endpoints, restricted by role permissions
+	pages.GET("/admin", Auth.RequirePermission(Auth.PermViewAllUsers), func(c *gin.Context) {
+		Controllers.AllUsersDataHandler(c, store)
+	})
+
+	pages.GET("/dm", Auth.RequirePermission(Auth.PermViewMessages), func(c *gin.Context) {
+		Controllers.DmHandler(c, store)
+	})
+
+	pages.GET("/user", Auth.RequirePermission(Auth.PermViewAllUsers), func(c *gin.Context) {
 		c.HTML(http.StatusOK, "user.html", gin.H{})
 	})
 
-	r.POST("/updateDiet", func(c *gin.Context) {
-		Controllers.UpdateDietHandler(c)
+	api.GET("/admin/userDetails", Auth.RequirePermission(Auth.PermViewAllUsers), func(c *gin.Context) {
+		Controllers.AdminUserDetailsHandler(c, store, store, store)
+	})
+
+	api.GET("/admin/healthScoreHistory", Auth.RequirePermission(Auth.PermViewAllUsers), func(c *gin.Context) {
+		Controllers.AdminHealthScoreHistoryHandler(c, store)
+	})
+
+	api.POST("/updateDiet", Auth.RequirePermission(Auth.PermUpdateDiet), func(c *gin.Context) {
+		Controllers.UpdateDietHandler(c, store, store)
+	})
+
+	api.GET("/admin/lockouts", Auth.RequirePermission(Auth.PermUnlockAccounts), func(c *gin.Context) {
+		Controllers.LockoutsHandler(c)
+	})
+
+	api.POST("/admin/unlock", Auth.RequirePermission(Auth.PermUnlockAccounts), func(c *gin.Context) {
+		Controllers.UnlockAccountHandler(c)
+	})
+
+	api.POST("/admin/2fa/reset", Auth.RequirePermission(Auth.PermResetTwoFactor), func(c *gin.Context) {
+		Controllers.AdminResetTwoFactorHandler(c)
+	})
+
+	api.POST("/admin/roles", Auth.RequirePermission(Auth.PermManageRoles), func(c *gin.Context) {
+		Controllers.SetRoleHandler(c)
+	})
+
+	api.GET("/admin/audit", Auth.RequirePermission(Auth.PermViewAudit), func(c *gin.Context) {
+		Controllers.AuditLogHandler(c)
 	})
 
 	// Add POST route for signup
@@ -163,8 +286,25 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 			return
 		}
-		success := auth.Signup(json.Username, json.Password)
+		if !Auth.ValidEmail(json.Username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Please enter a valid email address"})
+			return
+		}
+		if err := Auth.CheckPassword(json.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		success := auth.Signup(c.Request.Context(), json.Username, json.Password)
 		if success {
+			if err := Auth.IssueSession(c, json.Username); err != nil {
+				fmt.Println("[Signup] Failed to issue session:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup succeeded but session could not be created"})
+				return
+			}
+			Auth.AuditAs(c, json.Username, DB.AuditSignup, json.Username, nil)
+			if err := recovery.SendVerification(c.Request.Context(), json.Username); err != nil {
+				fmt.Println("[Signup] Failed to send verification email:", err)
+			}
 			c.JSON(http.StatusOK, gin.H{"message": "Signup successful"})
 		} else {
 			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists or error occurred"})
@@ -181,14 +321,217 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 			return
 		}
-		success := auth.Login(json.Username, json.Password)
+		// Refuse early while the account or client IP is locked out
+		attempt, err := guard.Begin(c.Request.Context(), json.Username, c.ClientIP())
+		if err != nil {
+			fmt.Println("[Signin] Failed to check lockout:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't sign in right now"})
+			return
+		}
+		if attempt.Wait > 0 {
+			Auth.AuditAs(c, "anonymous", DB.AuditLoginLocked, json.Username, nil)
+			c.Header("Retry-After", Auth.RetryAfterSeconds(attempt.Wait))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, please try again later"})
+			return
+		}
+
+		success := auth.Login(c.Request.Context(), json.Username, json.Password)
+		if !success {
+			Auth.AuditAs(c, "anonymous", DB.AuditLoginFailure, json.Username, nil)
+			if err := attempt.Fail(c.Request.Context()); err != nil {
+				fmt.Println("[Signin] Failed to record failure:", err)
+			}
+		} else if err := attempt.Pass(c.Request.Context()); err != nil {
+			fmt.Println("[Signin] Failed to release attempt:", err)
+		}
 		if success {
+			// Accounts with 2FA finish signing in at /signin/2fa
+			mfa, err := DB.Accounts.IsTOTPEnabled(c.Request.Context(), json.Username)
+			if err != nil {
+				fmt.Println("[Signin] Failed to read 2FA status:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't sign in right now"})
+				return
+			}
+			if mfa {
+				Auth.AuditAs(c, json.Username, DB.AuditLoginSuccess, json.Username, gin.H{"step": "password"})
+				Auth.StartMFAChallenge(c, json.Username)
+				c.JSON(http.StatusOK, gin.H{"message": "Enter your authentication code", "mfa_required": true})
+				return
+			}
+
+			// Only a finished login resets the account counter, so the password
+			// step can't be used to clear failed 2FA attempts
+			if err := guard.RecordSuccess(c.Request.Context(), json.Username); err != nil {
+				fmt.Println("[Signin] Failed to reset failures:", err)
+			}
+			if err := Auth.IssueSession(c, json.Username); err != nil {
+				fmt.Println("[Signin] Failed to issue session:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't create session"})
+				return
+			}
+			Auth.AuditAs(c, json.Username, DB.AuditLoginSuccess, json.Username, gin.H{"method": "password"})
 			c.JSON(http.StatusOK, gin.H{"message": "Signin successful"})
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		}
 	})
 
+	// Second sign-in step for accounts with two-factor authentication
+	r.POST("/signin/2fa", func(c *gin.Context) {
+		var json struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&json); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		email, ok := Auth.PendingMFAUser(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in with your password first"})
+			return
+		}
+
+		attempt, err := guard.Begin(c.Request.Context(), email, c.ClientIP())
+		if err != nil {
+			fmt.Println("[Signin 2FA] Failed to check lockout:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't sign in right now"})
+			return
+		}
+		if attempt.Wait > 0 {
+			Auth.AuditAs(c, "anonymous", DB.AuditLoginLocked, email, gin.H{"step": "2fa"})
+			c.Header("Retry-After", Auth.RetryAfterSeconds(attempt.Wait))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, please try again later"})
+			return
+		}
+
+		if err := Auth.VerifySecondFactor(c.Request.Context(), email, json.Code); err != nil {
+			if err != Auth.ErrInvalidCode {
+				fmt.Println("[Signin 2FA] Failed to verify code:", err)
+			}
+			Auth.AuditAs(c, "anonymous", DB.AuditSecondFactorFail, email, nil)
+			if err := attempt.Fail(c.Request.Context()); err != nil {
+				fmt.Println("[Signin 2FA] Failed to record failure:", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+			return
+		}
+		if err := attempt.Pass(c.Request.Context()); err != nil {
+			fmt.Println("[Signin 2FA] Failed to release attempt:", err)
+		}
+		if err := guard.RecordSuccess(c.Request.Context(), email); err != nil {
+			fmt.Println("[Signin 2FA] Failed to reset failures:", err)
+		}
+
+		Auth.FinishMFAChallenge(c)
+		if err := Auth.IssueSession(c, email); err != nil {
+			fmt.Println("[Signin 2FA] Failed to issue session:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't create session"})
+			return
+		}
+		Auth.AuditAs(c, email, DB.AuditLoginSuccess, email, gin.H{"method": "2fa"})
+		c.JSON(http.StatusOK, gin.H{"message": "Signin successful"})
+	})
+
+	// Personal API tokens, managed only from a browser session
+	api.GET("/tokens", func(c *gin.Context) {
+		Controllers.ListAPITokensHandler(c)
+	})
+
+	api.POST("/tokens", func(c *gin.Context) {
+		Controllers.CreateAPITokenHandler(c)
+	})
+
+	api.DELETE("/tokens/:id", func(c *gin.Context) {
+		Controllers.RevokeAPITokenHandler(c)
+	})
+
+	// Self-service data export and account deletion
+	api.GET("/account/export", func(c *gin.Context) {
+		Controllers.ExportAccountHandler(c, store, store, store, store)
+	})
+
+	api.GET("/account/delete", func(c *gin.Context) {
+		Controllers.DeletionStatusHandler(c)
+	})
+
+	api.POST("/account/delete", func(c *gin.Context) {
+		Controllers.DeleteAccountHandler(c, deletionGrace)
+	})
+
+	api.POST("/account/delete/cancel", func(c *gin.Context) {
+		Controllers.CancelDeletionHandler(c)
+	})
+
+	// Two-factor enrollment for the signed-in user
+	api.GET("/2fa", func(c *gin.Context) {
+		Controllers.TwoFactorStatusHandler(c)
+	})
+
+	api.POST("/2fa/enroll", func(c *gin.Context) {
+		Controllers.TwoFactorEnrollHandler(c)
+	})
+
+	api.POST("/2fa/confirm", func(c *gin.Context) {
+		Controllers.TwoFactorConfirmHandler(c)
+	})
+
+	api.POST("/2fa/disable", func(c *gin.Context) {
+		Controllers.TwoFactorDisableHandler(c)
+	})
+
+	// Password reset and email verification
+	r.GET("/password/reset", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "reset.html", gin.H{"token": c.Query("token")})
+	})
+
+	r.POST("/password/forgot", func(c *gin.Context) {
+		Controllers.ForgotPasswordHandler(c, recovery)
+	})
+
+	r.POST("/password/reset", func(c *gin.Context) {
+		Controllers.ResetPasswordHandler(c, recovery)
+	})
+
+	r.GET("/verify", func(c *gin.Context) {
+		Controllers.VerifyEmailHandler(c, recovery)
+	})
+
+	api.POST("/verify/send", func(c *gin.Context) {
+		Controllers.SendVerificationHandler(c, recovery)
+	})
+
+	// Google OpenID Connect login, enabled when GOOGLE_OAUTH_CLIENT_ID is set
+	if googleAuth := Auth.NewGoogleAuth(); googleAuth != nil {
+		r.GET("/auth/google/login", func(c *gin.Context) {
+			googleAuth.LoginHandler(c)
+		})
+		r.GET("/auth/google/callback", func(c *gin.Context) {
+			googleAuth.CallbackHandler(c)
+		})
+		fmt.Printf("🔑 Google login enabled (issuer %s)\n", googleAuth.Issuer)
+	}
+
+	// Revoke the current session
+	r.POST("/logout", func(c *gin.Context) {
+		if err := Auth.Logout(c); err != nil {
+			fmt.Println("[Logout] Failed to revoke session:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't revoke session"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	})
+
+	// Revoke every session of the current user, e.g. after a lost device
+	api.POST("/logoutAll", func(c *gin.Context) {
+		if err := Auth.LogoutAll(c); err != nil {
+			fmt.Println("[LogoutAll] Failed to revoke sessions:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't revoke sessions"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere"})
+	})
+
 	// Handle favicon request
 	r.GET("/favicon.ico", func(c *gin.Context) {
 		c.String(http.StatusNoContent, "")
@@ -15,6 +15,17 @@ document.addEventListener('DOMContentLoaded', async () => {
     console.log("[Auth] Session found for:", userEmail);
 
     try {
+        // Users who signed up but never saved their profile finish onboarding first
+        const meResponse = await fetch('/me');
+        if (meResponse.ok) {
+            const me = await meResponse.json();
+            if (me.onboarding === 'incomplete') {
+                console.log("[Auth] Onboarding incomplete, redirecting to form");
+                window.location.href = "/form";
+                return;
+            }
+        }
+
         // Initial data fetch
         console.log("[Init] Fetching initial user data");
         await fetchUserDetails(userEmail);
@@ -70,9 +81,9 @@ document.addEventListener('DOMContentLoaded', async () => {
                     };
                     console.log("[API] Prepared diet plan request data:", dietPlanData);
 
-                    // Call diet plan generation API
-                    console.log("[API] Calling diet plan generation endpoint");
-                    const dietResponse = await fetch('/genDietPlan', {
+                    // Stream the diet plan so it shows up as it is written
+                    console.log("[API] Calling diet plan streaming endpoint");
+                    const dietResponse = await fetch('/genDietPlan/stream', {
                         method: 'POST',
                         headers: {
                             'Content-Type': 'application/json'
@@ -85,23 +96,17 @@ document.addEventListener('DOMContentLoaded', async () => {
                         throw new Error(errorData.error || `Diet plan generation failed: ${dietResponse.status}`);
                     }
 
-                    const dietData = await dietResponse.json();
-                    console.log("[API] Diet plan received:", dietData);
-
-                    // Update UI with diet plan
-                    if (dietPlanElement && dietData.diet_plan) {
-                        if (typeof dietData.diet_plan === 'string') {
-                            // Clean up and format the diet plan text
-                            const cleanDietPlan = formatDietPlan(dietData.diet_plan);
-                            dietPlanElement.innerHTML = cleanDietPlan;
-                        } else if (Array.isArray(dietData.diet_plan) || typeof dietData.diet_plan === 'object') {
-                            dietPlanElement.innerHTML = JSON.stringify(dietData.diet_plan, null, 2);
-                        } else {
-                            throw new Error('Invalid diet plan data type received');
+                    const dietPlan = await readDietPlanStream(dietResponse, (partialPlan) => {
+                        if (dietPlanElement) {
+                            dietPlanElement.textContent = partialPlan;
                         }
+                    });
+                    console.log("[API] Diet plan received:", dietPlan);
+
+                    // Update UI with the formatted diet plan
+                    if (dietPlanElement) {
+                        dietPlanElement.innerHTML = formatDietPlan(dietPlan);
                         console.log("[UI] Diet plan displayed successfully");
-                    } else {
-                        throw new Error('Invalid diet plan data received');
                     }
                 } catch (error) {
                     console.error('[Error] Diet plan generation failed:', error);
@@ -251,6 +256,50 @@ function extractCalorieValues(trackData) {
     return calorieMap;
 }
 
+// Reads the Server-Sent Events of /genDietPlan/stream, passing the plan so
+// far to onProgress, and resolves with the saved plan
+async function readDietPlanStream(response, onProgress) {
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    let plan = '';
+
+    while (true) {
+        const { value, done } = await reader.read();
+        if (done) {
+            throw new Error('Diet plan stream ended unexpectedly');
+        }
+        buffer += decoder.decode(value, { stream: true });
+
+        // Events are separated by a blank line
+        let boundary;
+        while ((boundary = buffer.indexOf('\n\n')) >= 0) {
+            const rawEvent = buffer.slice(0, boundary);
+            buffer = buffer.slice(boundary + 2);
+
+            let event = 'message';
+            let data = '';
+            rawEvent.split('\n').forEach(line => {
+                if (line.startsWith('event:')) {
+                    event = line.slice(6).trim();
+                } else if (line.startsWith('data:')) {
+                    data += line.slice(5);
+                }
+            });
+            const payload = data ? JSON.parse(data) : {};
+
+            if (event === 'token') {
+                plan += payload.text;
+                onProgress(plan);
+            } else if (event === 'done') {
+                return payload.diet_plan;
+            } else if (event === 'error') {
+                throw new Error(payload.error || 'Diet plan generation failed');
+            }
+        }
+    }
+}
+
 // Function to format the diet plan text
 function formatDietPlan(dietPlan) {
     // Remove excessive stars and clean up formatting
@@ -294,7 +343,9 @@ if (logout) {
     logout.addEventListener('click', () => {
         console.log("[Auth] User clicked logout");
         sessionStorage.removeItem('userEmail');
-        window.location.href = "/login";
+        fetch('/logout', { method: 'POST' }).finally(() => {
+            window.location.href = "/login";
+        });
     });
 }
 
@@ -303,6 +354,8 @@ if (logout2) {
     logout2.addEventListener('click', () => {
         console.log("[Auth] User clicked mobile logout");
         sessionStorage.removeItem('userEmail');
-        window.location.href = "/login";
+        fetch('/logout', { method: 'POST' }).finally(() => {
+            window.location.href = "/login";
+        });
     });
 }
\ No newline at end of file
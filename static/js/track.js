@@ -62,9 +62,11 @@ document.getElementById('trackForm').addEventListener('submit', function (event)
         method: 'POST',
         body: data
     })
-        .then(response => {
+        .then(async response => {
             if (!response.ok) {
-                throw new Error('Network response was not ok');
+                // Show why the meals couldn't be tracked, e.g. an unreadable photo
+                const body = await response.json().catch(() => ({}));
+                throw new Error(body.error || 'Network response was not ok');
             }
             return response.json();
         })
@@ -80,7 +82,7 @@ document.getElementById('trackForm').addEventListener('submit', function (event)
 
         })
         .catch(error => {
-            alert(error);
+            alert(error.message);
         });
 });
 function createTrackDataContainer(elementId, trackData) {
@@ -3,7 +3,7 @@ const urlParams = new URLSearchParams(window.location.search);
 const email = urlParams.get('email');
 console.log(email)
 document.getElementById("email").value = email;
-fetch(`/userDetails?email=${email}`)
+fetch(`/admin/userDetails?email=${encodeURIComponent(email)}`)
     .then(response => response.json())
     .then(user => {
         // Display user details on the page
@@ -27,6 +27,12 @@ fetch(`/userDetails?email=${email}`)
         diseases.innerHTML = `${user.diseases}`;
         const curr_hs = document.getElementById('curr_hs');
         curr_hs.innerHTML = `${user.healthscore}`;
+        // Explain the computed score factor by factor on hover
+        if (user.healthscore_breakdown) {
+            curr_hs.title = user.healthscore_breakdown.factors
+                .map(f => `${f.factor} (${f.value}): ${f.points} points`)
+                .join('\n');
+        }
         const curr_diet = document.getElementById('curr_diet');
         curr_diet.innerHTML = `${user.diet_plan}`;
         